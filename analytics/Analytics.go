@@ -0,0 +1,362 @@
+// Package analytics reports the performance of an account from its transaction history: the P/L of each
+// trade and instrument, win rate, expectancy, drawdown, Sharpe and Sortino ratios and holding times
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/calendar"
+	"github.com/burbru/goanda/models"
+)
+
+// TradingDaysPerYear annualizes the daily Sharpe and Sortino ratios, currencies trade 5 days a week
+const TradingDaysPerYear = 260
+
+// TradeRecord is the P/L of a trade, the amounts are in the account currency
+type TradeRecord struct {
+	TradeID    string
+	Instrument string
+	// Units are the initial units, negative for a short trade
+	Units     int64
+	OpenTime  time.Time
+	OpenPrice float64
+	// CloseTime is zero while the trade is open
+	CloseTime         time.Time
+	AverageClosePrice float64
+	RealizedPL        float64
+	Financing         float64
+	Commission        float64
+	// NetPL is RealizedPL + Financing - Commission
+	NetPL float64
+
+	closedUnits int64
+}
+
+// Closed reports whether the trade is closed
+func (t *TradeRecord) Closed() bool {
+	return !t.CloseTime.IsZero()
+}
+
+// HoldingTime returns the time the trade was open, zero while it is open
+func (t *TradeRecord) HoldingTime() time.Duration {
+	if !t.Closed() {
+		return 0
+	}
+	return t.CloseTime.Sub(t.OpenTime)
+}
+
+// InstrumentStats are the P/L of the closed trades of an instrument
+type InstrumentStats struct {
+	Instrument string
+	Trades     int
+	Wins       int
+	Losses     int
+	RealizedPL float64
+	Financing  float64
+	Commission float64
+	NetPL      float64
+}
+
+// EquityPoint is the balance at the end of the trading day starting at Time (see calendar.Align),
+// Transfers are the funds transferred up to it
+type EquityPoint struct {
+	Time      time.Time
+	Balance   float64
+	Transfers float64
+}
+
+// Report is the performance of an account, computed from the closed trades for the trade statistics and
+// from the balance for the drawdown and the ratios. Only the realized P/L is known from the transactions,
+// the open trades do not count
+type Report struct {
+	Trades      []TradeRecord
+	Instruments []InstrumentStats
+
+	ClosedTrades int
+	Wins         int
+	Losses       int
+	WinRate      float64
+	AverageWin   float64
+	AverageLoss  float64
+	// Expectancy is the average NetPL of the closed trades
+	Expectancy float64
+	// ProfitFactor is the sum of the wins divided by the sum of the losses, +Inf without losses
+	ProfitFactor float64
+
+	RealizedPL float64
+	Financing  float64
+	Commission float64
+	NetPL      float64
+
+	// MaxDrawdown is the largest fall of the balance from a peak after each transaction, transfers
+	// excluded, MaxDrawdownPercent is the largest fall relative to the balance of its peak
+	MaxDrawdown        float64
+	MaxDrawdownPercent float64
+	// Sharpe and Sortino are annualized ratios of the daily returns of the balance, transfers excluded
+	Sharpe  float64
+	Sortino float64
+
+	AverageHoldingTime time.Duration
+	MedianHoldingTime  time.Duration
+
+	Equity []EquityPoint
+}
+
+// Analyze computes the Report of transactions ordered by ID, such as the ones of GetTransactionsSinceID
+// or of a backtest. The trades opened before the first transaction are ignored
+func Analyze(transactions []models.Transaction) Report {
+	a := analyzer{trades: make(map[string]*TradeRecord)}
+	for i := range transactions {
+		a.apply(&transactions[i])
+	}
+	return a.report()
+}
+
+// analyzer replays the transactions
+type analyzer struct {
+	trades map[string]*TradeRecord
+	order  []string
+
+	totals     Report
+	transfers  float64
+	hasBalance bool
+	// peak is the highest balance, moved by the transfers since
+	peak   float64
+	equity []EquityPoint
+}
+
+func (a *analyzer) apply(t *models.Transaction) {
+	switch t.Type {
+	case models.TransactionTypeOrderFill:
+		a.fill(t)
+		a.balanceChange(t, t.PL+t.Financing-t.Commission, 0)
+	case models.TransactionTypeDailyFinancing:
+		for _, position := range t.PositionFinancings {
+			for _, financing := range position.OpenTradeFinancings {
+				if trade := a.trades[financing.TradeID]; trade != nil {
+					trade.Financing += financing.Financing
+				}
+			}
+		}
+		a.totals.Financing += t.Financing
+		a.balanceChange(t, t.Financing, 0)
+	case models.TransactionTypeTransferFunds:
+		a.balanceChange(t, t.Amount, t.Amount)
+	}
+}
+
+// fill opens, reduces and closes the trades of a fill, its commission is shared by units
+func (a *analyzer) fill(t *models.Transaction) {
+	var units int64
+	if t.TradeOpened != nil {
+		units += abs(t.TradeOpened.Units)
+	}
+	if t.TradeReduced != nil {
+		units += abs(t.TradeReduced.Units)
+	}
+	for _, closed := range t.TradesClosed {
+		units += abs(closed.Units)
+	}
+	commission := func(tradeUnits int64) float64 {
+		if units == 0 {
+			return 0
+		}
+		return t.Commission * float64(abs(tradeUnits)) / float64(units)
+	}
+
+	reduce := func(reduced models.TradeReduce, closed bool) {
+		trade := a.trades[reduced.TradeID]
+		if trade == nil {
+			return
+		}
+		reducedUnits := abs(reduced.Units)
+		trade.AverageClosePrice = (trade.AverageClosePrice*float64(trade.closedUnits) + reduced.Price*float64(reducedUnits)) / float64(trade.closedUnits+reducedUnits)
+		trade.closedUnits += reducedUnits
+		trade.RealizedPL += reduced.RealizedPL
+		trade.Financing += reduced.Financing
+		trade.Commission += commission(reduced.Units)
+		if closed {
+			trade.CloseTime = t.Time
+		}
+	}
+	for _, closed := range t.TradesClosed {
+		reduce(closed, true)
+	}
+	if t.TradeReduced != nil {
+		reduce(*t.TradeReduced, false)
+	}
+	if opened := t.TradeOpened; opened != nil {
+		a.trades[opened.TradeID] = &TradeRecord{
+			TradeID:    opened.TradeID,
+			Instrument: t.Instrument,
+			Units:      opened.Units,
+			OpenTime:   t.Time,
+			OpenPrice:  opened.Price,
+			Commission: commission(opened.Units),
+		}
+		a.order = append(a.order, opened.TradeID)
+	}
+	a.totals.RealizedPL += t.PL
+	a.totals.Financing += t.Financing
+	a.totals.Commission += t.Commission
+}
+
+// balanceChange records the balance after a transaction changing it by change, of which transfer
+// was transferred to or from the account
+func (a *analyzer) balanceChange(t *models.Transaction, change float64, transfer float64) {
+	day := calendar.Align(t.Time, api.D)
+	if !a.hasBalance {
+		// the balance before the first transaction starts the curve
+		a.hasBalance = true
+		a.peak = t.AccountBalance - change
+		a.equity = append(a.equity, EquityPoint{Time: day.AddDate(0, 0, -1), Balance: t.AccountBalance - change})
+	}
+	a.transfers += transfer
+
+	// the peak moves with the transfers, so that they are not counted as drawdowns or recoveries
+	a.peak += transfer
+	if t.AccountBalance > a.peak {
+		a.peak = t.AccountBalance
+	}
+	drawdown := a.peak - t.AccountBalance
+	if drawdown > a.totals.MaxDrawdown {
+		a.totals.MaxDrawdown = drawdown
+	}
+	if a.peak > 0 && drawdown/a.peak*100 > a.totals.MaxDrawdownPercent {
+		a.totals.MaxDrawdownPercent = drawdown / a.peak * 100
+	}
+
+	point := EquityPoint{Time: day, Balance: t.AccountBalance, Transfers: a.transfers}
+	if n := len(a.equity); a.equity[n-1].Time.Equal(day) {
+		a.equity[n-1] = point
+		return
+	}
+	a.equity = append(a.equity, point)
+}
+
+func (a *analyzer) report() Report {
+	r := a.totals
+	r.Equity = a.equity
+	r.NetPL = r.RealizedPL + r.Financing - r.Commission
+
+	byInstrument := make(map[string]*InstrumentStats)
+	var names []string
+	var grossWins, grossLosses float64
+	var holdingTimes []time.Duration
+	for _, id := range a.order {
+		trade := a.trades[id]
+		trade.NetPL = trade.RealizedPL + trade.Financing - trade.Commission
+		r.Trades = append(r.Trades, *trade)
+		if !trade.Closed() {
+			continue
+		}
+
+		stats, ok := byInstrument[trade.Instrument]
+		if !ok {
+			stats = &InstrumentStats{Instrument: trade.Instrument}
+			byInstrument[trade.Instrument] = stats
+			names = append(names, trade.Instrument)
+		}
+		stats.Trades++
+		stats.RealizedPL += trade.RealizedPL
+		stats.Financing += trade.Financing
+		stats.Commission += trade.Commission
+		stats.NetPL += trade.NetPL
+
+		r.ClosedTrades++
+		if trade.NetPL > 0 {
+			r.Wins++
+			stats.Wins++
+			grossWins += trade.NetPL
+		} else if trade.NetPL < 0 {
+			r.Losses++
+			stats.Losses++
+			grossLosses -= trade.NetPL
+		}
+		holdingTimes = append(holdingTimes, trade.HoldingTime())
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.Instruments = append(r.Instruments, *byInstrument[name])
+	}
+
+	if r.ClosedTrades > 0 {
+		r.WinRate = float64(r.Wins) / float64(r.ClosedTrades)
+		r.Expectancy = (grossWins - grossLosses) / float64(r.ClosedTrades)
+	}
+	if r.Wins > 0 {
+		r.AverageWin = grossWins / float64(r.Wins)
+	}
+	if r.Losses > 0 {
+		r.AverageLoss = -grossLosses / float64(r.Losses)
+		r.ProfitFactor = grossWins / grossLosses
+	} else if r.Wins > 0 {
+		r.ProfitFactor = math.Inf(1)
+	}
+
+	if len(holdingTimes) > 0 {
+		var total time.Duration
+		for _, holdingTime := range holdingTimes {
+			total += holdingTime
+		}
+		r.AverageHoldingTime = total / time.Duration(len(holdingTimes))
+		sort.Slice(holdingTimes, func(i, j int) bool { return holdingTimes[i] < holdingTimes[j] })
+		middle := len(holdingTimes) / 2
+		r.MedianHoldingTime = holdingTimes[middle]
+		if len(holdingTimes)%2 == 0 {
+			r.MedianHoldingTime = (holdingTimes[middle-1] + holdingTimes[middle]) / 2
+		}
+	}
+
+	r.Sharpe, r.Sortino = ratios(a.equity)
+	return r
+}
+
+// ratios returns the annualized Sharpe and Sortino ratios of the daily returns of the balance, the
+// transfers of a day are not counted as returns
+func ratios(equity []EquityPoint) (float64, float64) {
+	var returns []float64
+	for i := 1; i < len(equity); i++ {
+		previous := equity[i-1].Balance
+		if previous <= 0 {
+			continue
+		}
+		pl := equity[i].Balance - previous - (equity[i].Transfers - equity[i-1].Transfers)
+		returns = append(returns, pl/previous)
+	}
+	if len(returns) < 2 {
+		return 0, 0
+	}
+	mean, variance, downside := 0.0, 0.0, 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	deviation := math.Sqrt(variance / float64(len(returns)-1))
+	downsideDeviation := math.Sqrt(downside / float64(len(returns)))
+	annualize := math.Sqrt(TradingDaysPerYear)
+	var sharpe, sortino float64
+	if deviation > 0 {
+		sharpe = mean / deviation * annualize
+	}
+	if downsideDeviation > 0 {
+		sortino = mean / downsideDeviation * annualize
+	}
+	return sharpe, sortino
+}
+
+func abs(units int64) int64 {
+	if units < 0 {
+		return -units
+	}
+	return units
+}
@@ -0,0 +1,131 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/burbru/goanda/models"
+)
+
+var start = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func transfer(id string, at time.Time, amount float64, balance float64) models.Transaction {
+	return models.Transaction{ID: id, Type: models.TransactionTypeTransferFunds, Time: at, Amount: amount, AccountBalance: balance}
+}
+
+func openTrade(id string, at time.Time, tradeID string, units int64, price float64, commission float64, balance float64) models.Transaction {
+	return models.Transaction{
+		ID: id, Type: models.TransactionTypeOrderFill, Time: at, Instrument: "EUR_USD", Units: units, Price: price,
+		Commission: commission, AccountBalance: balance,
+		TradeOpened: &models.TradeOpen{TradeID: tradeID, Units: units, Price: price},
+	}
+}
+
+func closeTrade(id string, at time.Time, tradeID string, units int64, price float64, pl float64, balance float64) models.Transaction {
+	return models.Transaction{
+		ID: id, Type: models.TransactionTypeOrderFill, Time: at, Instrument: "EUR_USD", Units: units, Price: price,
+		PL: pl, AccountBalance: balance,
+		TradesClosed: []models.TradeReduce{{TradeID: tradeID, Units: units, Price: price, RealizedPL: pl}},
+	}
+}
+
+func almostEqual(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestAnalyzeTrades(t *testing.T) {
+	report := Analyze([]models.Transaction{
+		transfer("1", start, 10000, 10000),
+		openTrade("2", start.Add(time.Hour), "2", 1000, 1.2, 1, 9999),
+		{
+			ID: "3", Type: models.TransactionTypeDailyFinancing, Time: start.Add(10 * time.Hour), Financing: -0.5, AccountBalance: 9998.5,
+			PositionFinancings: []models.PositionFinancing{{Instrument: "EUR_USD", Financing: -0.5, OpenTradeFinancings: []models.OpenTradeFinancing{{TradeID: "2", Financing: -0.5}}}},
+		},
+		closeTrade("4", start.Add(24*time.Hour), "2", -1000, 1.21, 10, 10008.5),
+		openTrade("5", start.Add(25*time.Hour), "5", -2000, 1.21, 0, 10008.5),
+		closeTrade("6", start.Add(27*time.Hour), "5", 2000, 1.22, -20, 9988.5),
+		openTrade("7", start.Add(28*time.Hour), "7", 500, 1.22, 0, 9988.5),
+	})
+
+	if len(report.Trades) != 3 || report.ClosedTrades != 2 {
+		t.Fatalf("trades %d closed %d, want 3 and 2", len(report.Trades), report.ClosedTrades)
+	}
+	first := report.Trades[0]
+	if !almostEqual(first.NetPL, 8.5) || !almostEqual(first.Financing, -0.5) || !almostEqual(first.Commission, 1) {
+		t.Errorf("first trade %+v, want NetPL 8.5", first)
+	}
+	if first.HoldingTime() != 23*time.Hour {
+		t.Errorf("holding time %s, want 23h", first.HoldingTime())
+	}
+	if report.Trades[2].Closed() {
+		t.Error("open trade closed")
+	}
+	if report.Wins != 1 || report.Losses != 1 || !almostEqual(report.WinRate, 0.5) {
+		t.Errorf("wins %d losses %d win rate %g", report.Wins, report.Losses, report.WinRate)
+	}
+	if !almostEqual(report.Expectancy, -5.75) || !almostEqual(report.ProfitFactor, 8.5/20) {
+		t.Errorf("expectancy %g profit factor %g", report.Expectancy, report.ProfitFactor)
+	}
+	if !almostEqual(report.NetPL, -11.5) || !almostEqual(report.RealizedPL, -10) {
+		t.Errorf("net P/L %g realized P/L %g, want -11.5 and -10", report.NetPL, report.RealizedPL)
+	}
+	if len(report.Instruments) != 1 || report.Instruments[0].Trades != 2 {
+		t.Errorf("instruments %+v", report.Instruments)
+	}
+}
+
+func TestAnalyzeDrawdown(t *testing.T) {
+	report := Analyze([]models.Transaction{
+		transfer("1", start, 10000, 10000),
+		openTrade("2", start.Add(time.Hour), "2", 1000, 1.2, 0, 10000),
+		closeTrade("3", start.Add(2*time.Hour), "2", -1000, 1.3, 100, 10100),
+		openTrade("4", start.Add(3*time.Hour), "4", 1000, 1.3, 0, 10100),
+		// the fall within the day counts, although the day closes above it
+		closeTrade("5", start.Add(4*time.Hour), "4", -1000, 1.2, -100, 10000),
+		transfer("6", start.Add(5*time.Hour), 5000, 15000),
+		openTrade("7", start.Add(6*time.Hour), "7", 1000, 1.2, 0, 15000),
+		closeTrade("8", start.Add(7*time.Hour), "7", -1000, 1.25, 50, 15050),
+	})
+
+	if !almostEqual(report.MaxDrawdown, 100) {
+		t.Errorf("max drawdown %g, want 100", report.MaxDrawdown)
+	}
+	if want := 100 / 10100.0 * 100; !almostEqual(report.MaxDrawdownPercent, want) {
+		t.Errorf("max drawdown percent %g, want %g", report.MaxDrawdownPercent, want)
+	}
+}
+
+func TestAnalyzeWithdrawalIsNotDrawdown(t *testing.T) {
+	report := Analyze([]models.Transaction{
+		transfer("1", start, 10000, 10000),
+		transfer("2", start.Add(time.Hour), -4000, 6000),
+		openTrade("3", start.Add(2*time.Hour), "3", 1000, 1.2, 0, 6000),
+		closeTrade("4", start.Add(3*time.Hour), "3", -1000, 1.17, -30, 5970),
+	})
+
+	if !almostEqual(report.MaxDrawdown, 30) || !almostEqual(report.MaxDrawdownPercent, 0.5) {
+		t.Errorf("max drawdown %g (%g%%), want 30 (0.5%%)", report.MaxDrawdown, report.MaxDrawdownPercent)
+	}
+}
+
+func TestAnalyzeEquity(t *testing.T) {
+	report := Analyze([]models.Transaction{
+		transfer("1", start, 10000, 10000),
+		openTrade("2", start.Add(time.Hour), "2", 1000, 1.2, 0, 10000),
+		closeTrade("3", start.Add(24*time.Hour), "2", -1000, 1.21, 10, 10010),
+		openTrade("4", start.Add(25*time.Hour), "4", 1000, 1.21, 0, 10010),
+		closeTrade("5", start.Add(48*time.Hour), "4", -1000, 1.2, -10, 10000),
+	})
+
+	if len(report.Equity) != 4 {
+		t.Fatalf("equity points %d, want 4: %+v", len(report.Equity), report.Equity)
+	}
+	if last := report.Equity[3]; last.Balance != 10000 || last.Transfers != 10000 {
+		t.Errorf("last equity point %+v", last)
+	}
+	// the deposit is not a return, the returns are +0.1% and -0.1%
+	if math.IsInf(report.Sharpe, 0) || math.Abs(report.Sharpe) > 0.1 || math.Abs(report.Sortino) > 0.1 {
+		t.Errorf("sharpe %g sortino %g, want about 0", report.Sharpe, report.Sortino)
+	}
+}
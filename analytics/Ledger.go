@@ -0,0 +1,55 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ledgerHeader are the columns of the ledger, the times are RFC3339 and the holding time is in seconds
+var ledgerHeader = []string{
+	"tradeID", "instrument", "units", "openTime", "openPrice", "closeTime", "averageClosePrice",
+	"realizedPL", "financing", "commission", "netPL", "holdingTime",
+}
+
+// WriteCSV writes the ledger of the trades as CSV, one line per trade in the order they were opened.
+// The close columns are empty for the open trades
+func (r *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(ledgerHeader); err != nil {
+		return err
+	}
+	for i := range r.Trades {
+		trade := &r.Trades[i]
+		record := []string{
+			trade.TradeID,
+			trade.Instrument,
+			strconv.FormatInt(trade.Units, 10),
+			trade.OpenTime.UTC().Format(time.RFC3339Nano),
+			formatFloat(trade.OpenPrice),
+			"",
+			"",
+			formatFloat(trade.RealizedPL),
+			formatFloat(trade.Financing),
+			formatFloat(trade.Commission),
+			formatFloat(trade.NetPL),
+			"",
+		}
+		if trade.Closed() {
+			record[5] = trade.CloseTime.UTC().Format(time.RFC3339Nano)
+			record[6] = formatFloat(trade.AverageClosePrice)
+			record[11] = strconv.FormatFloat(trade.HoldingTime().Seconds(), 'f', -1, 64)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatFloat formats an amount or a price with the digits needed to read it back
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
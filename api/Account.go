@@ -7,10 +7,10 @@ import (
 	"github.com/burbru/goanda/models"
 )
 
-// GetPricing fetches the prricing for a list of instruments
+// GetPricing fetches the prricing for a list of instruments, with the home conversions of their currencies
 func (api *API) GetPricing(instruments []string) (*models.Prices, error) {
 	instrumentsQstr := strings.Join(instruments, ",")
-	data, err := SendRequest("GET", api.context.ApiURL+"/v3/accounts/"+api.context.Account+"/pricing?instruments="+instrumentsQstr, nil)
+	data, err := api.get(api.context.ApiURL + "/v3/accounts/" + api.context.Account + "/pricing?instruments=" + instrumentsQstr + "&includeHomeConversions=true")
 	if err != nil {
 		return nil, err
 	}
@@ -20,7 +20,7 @@ func (api *API) GetPricing(instruments []string) (*models.Prices, error) {
 
 func (api *API) GetCandles(instrument string, num int, granularity string, priceComponent PriceComponent) (*models.Candles, error) {
 	qStr := fmt.Sprintf("?price=%s&granularity=%s&count=%d", priceComponent, granularity, num)
-	data, err := SendRequest("GET", api.context.ApiURL+"/v3/accounts/"+api.context.Account+"/instruments/"+instrument+"/candles"+qStr, nil)
+	data, err := api.get(api.context.ApiURL + "/v3/accounts/" + api.context.Account + "/instruments/" + instrument + "/candles" + qStr)
 	if err != nil {
 		return nil, err
 	}
@@ -139,8 +139,7 @@ func (r *CandlesRequest) Send() (*models.Candles, error) {
 	if r.weeklyAlignment != "" {
 		qStr += "&weeklyAlignment=" + r.weeklyAlignment
 	}
-	PrintWithColor("GET %s\n", Green, r.api.context.ApiURL+"/v3/accounts/"+r.api.context.Account+"/instruments/"+r.instrument+"/candles"+qStr)
-	data, err := SendRequest("GET", r.api.context.ApiURL+"/v3/accounts/"+r.api.context.Account+"/instruments/"+r.instrument+"/candles"+qStr, nil)
+	data, err := r.api.get(r.api.context.ApiURL + "/v3/accounts/" + r.api.context.Account + "/instruments/" + r.instrument + "/candles" + qStr)
 	if err != nil {
 		return nil, err
 	}
@@ -152,7 +151,7 @@ func (r *CandlesRequest) Send() (*models.Candles, error) {
 
 // Get the list of instruments for the account
 func (api *API) GetInstruments() (*models.Instruments, error) {
-	data, err := SendRequest("GET", api.context.ApiURL+"/v3/accounts/"+api.context.Account+"/instruments", nil)
+	data, err := api.get(api.context.ApiURL + "/v3/accounts/" + api.context.Account + "/instruments")
 	if err != nil {
 		return nil, err
 	}
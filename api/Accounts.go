@@ -0,0 +1,187 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/burbru/goanda/models"
+)
+
+// AccountInfo is an account of a token, with its properties and its summary
+type AccountInfo struct {
+	models.Account
+	Summary models.AccountSummary
+}
+
+// AccountSelector selects accounts by ID, alias, currency or tag, the empty fields match any account
+type AccountSelector struct {
+	ID       string
+	Alias    string
+	Currency string
+	Tag      string
+}
+
+// Matches reports whether an account matches the selector, the alias and currency are case insensitive
+func (selector AccountSelector) Matches(account AccountInfo) bool {
+	if selector.ID != "" && account.ID != selector.ID {
+		return false
+	}
+	if selector.Alias != "" && !strings.EqualFold(account.Summary.Alias, selector.Alias) {
+		return false
+	}
+	if selector.Currency != "" && !strings.EqualFold(account.Summary.Currency, selector.Currency) {
+		return false
+	}
+	if selector.Tag != "" {
+		for _, tag := range account.Tags {
+			if tag == selector.Tag {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// DiscoverAccounts lists the accounts of the token of the Context, with their summary
+func (context *Context) DiscoverAccounts() ([]AccountInfo, error) {
+	tokenApi := context.CreateAPI()
+	accounts, err := tokenApi.GetAccounts()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]AccountInfo, len(accounts.Accounts))
+	for i, account := range accounts.Accounts {
+		accountApi := context.accountAPI(account.ID)
+		summary, err := accountApi.GetAccountSummary()
+		if err != nil {
+			return nil, err
+		}
+		infos[i] = AccountInfo{Account: account, Summary: *summary}
+	}
+	return infos, nil
+}
+
+// SelectAccounts returns the accounts of the token of the Context matching the selector
+func (context *Context) SelectAccounts(selector AccountSelector) ([]AccountInfo, error) {
+	accounts, err := context.DiscoverAccounts()
+	if err != nil {
+		return nil, err
+	}
+	var selected []AccountInfo
+	for _, account := range accounts {
+		if selector.Matches(account) {
+			selected = append(selected, account)
+		}
+	}
+	return selected, nil
+}
+
+// ResolveAccount sets the Account of the Context to the account of the token matching the selector.
+// An empty selector keeps the Account when it is set, and picks the first account of the token otherwise.
+// No account, or several accounts, matching a selector is an error
+func (context *Context) ResolveAccount(selector AccountSelector) error {
+	if selector == (AccountSelector{}) {
+		if context.Account != "" {
+			return nil
+		}
+		tokenApi := context.CreateAPI()
+		accounts, err := tokenApi.GetAccounts()
+		if err != nil {
+			return err
+		}
+		if len(accounts.Accounts) == 0 {
+			return errors.New("oanda: no account for the token")
+		}
+		context.Account = accounts.Accounts[0].ID
+		return nil
+	}
+
+	accounts, err := context.SelectAccounts(selector)
+	if err != nil {
+		return err
+	}
+	switch len(accounts) {
+	case 0:
+		return fmt.Errorf("oanda: no account matches %+v", selector)
+	case 1:
+		context.Account = accounts[0].ID
+		return nil
+	}
+	ids := make([]string, len(accounts))
+	for i, account := range accounts {
+		ids[i] = account.ID
+	}
+	return fmt.Errorf("oanda: accounts %s match %+v", strings.Join(ids, ", "), selector)
+}
+
+// accountAPI creates an api instance for an account of the token of the Context
+func (context *Context) accountAPI(accountID string) *API {
+	accountContext := *context
+	accountContext.Account = accountID
+	accountApi := accountContext.CreateAPI()
+	return &accountApi
+}
+
+// MultiAccount is a handle on several accounts of a token, to run the same calls on all of them
+type MultiAccount struct {
+	Accounts []AccountInfo
+	apis     map[string]*API
+}
+
+// CreateMultiAccount creates a MultiAccount on the accounts of the token of the Context matching the selector
+func (context *Context) CreateMultiAccount(selector AccountSelector) (*MultiAccount, error) {
+	accounts, err := context.SelectAccounts(selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("oanda: no account matches %+v", selector)
+	}
+	multi := &MultiAccount{Accounts: accounts, apis: make(map[string]*API)}
+	for _, account := range accounts {
+		multi.apis[account.ID] = context.accountAPI(account.ID)
+	}
+	return multi, nil
+}
+
+// API returns the api instance of an account, nil when the account is not part of the MultiAccount
+func (multi *MultiAccount) API(accountID string) *API {
+	return multi.apis[accountID]
+}
+
+// SetRetryPolicy sets the RetryPolicy of the api instances of all the accounts
+func (multi *MultiAccount) SetRetryPolicy(policy RetryPolicy) {
+	for _, accountApi := range multi.apis {
+		accountApi.SetRetryPolicy(policy)
+	}
+}
+
+// SetObserver sets the Observer of the api instances of all the accounts
+func (multi *MultiAccount) SetObserver(observer Observer) {
+	for _, accountApi := range multi.apis {
+		accountApi.SetObserver(observer)
+	}
+}
+
+// Each calls f concurrently for each account with its api instance, and returns the errors by account ID
+func (multi *MultiAccount) Each(f func(account AccountInfo, api *API) error) map[string]error {
+	errs := make(map[string]error)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, account := range multi.Accounts {
+		wg.Add(1)
+		go func(account AccountInfo) {
+			defer wg.Done()
+			if err := f(account, multi.apis[account.ID]); err != nil {
+				mutex.Lock()
+				errs[account.ID] = err
+				mutex.Unlock()
+			}
+		}(account)
+	}
+	wg.Wait()
+	return errs
+}
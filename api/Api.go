@@ -1,161 +1,88 @@
 package api
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-
 	"github.com/burbru/goanda/models"
 )
 
 // API is an api instance with a context to call endpoints
 type API struct {
-	context Context
+	context  Context
+	retry    RetryPolicy
+	observer Observer
+}
+
+// Account returns the ID of the account of the api instance
+func (api *API) Account() string {
+	return api.context.Account
+}
+
+// URL returns the REST URL of the environment of the api instance
+func (api *API) URL() string {
+	return api.context.ApiURL
 }
 
 // GetOpenPositions gets the open Positions on the account
 func (api *API) GetOpenPositions() (*models.AccountPositions, error) {
-	client := &http.Client{}
-	account := api.context.Account
-	apiURL := api.context.ApiURL
-	token := api.context.Token
-	req, errr := http.NewRequest("GET", apiURL+"/v3/accounts/"+account+"/openPositions", nil)
-	if errr != nil {
-		return nil, errr
-	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+token)
-	response, err := client.Do(req)
+	data, err := api.get(api.context.ApiURL + "/v3/accounts/" + api.context.Account + "/openPositions")
 	if err != nil {
-		fmt.Printf("The HTTP request failed with error %s\n", err)
 		return nil, err
 	}
-	data, errb := io.ReadAll(response.Body)
-	if errb != nil {
-		return nil, errb
-	} //fmt.Println(string(data))
-	positions, errp := parseAccountOpenPositions(&data)
-	//fmt.Println(positions)
-
-	return &positions, errp
+	positions, err := parseAccountOpenPositions(&data)
+	return &positions, err
 }
 
 // GetPosition gets the Position on the account
 func (api *API) GetPosition(instrument string) (*models.AccountPosition, error) {
-	client := &http.Client{}
-	account := api.context.Account
-	apiURL := api.context.ApiURL
-	token := api.context.Token
-	req, errr := http.NewRequest("GET", apiURL+"/v3/accounts/"+account+"/positions/"+instrument, nil)
-	if errr != nil {
-		return nil, errr
-	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+token)
-	response, err := client.Do(req)
+	data, err := api.get(api.context.ApiURL + "/v3/accounts/" + api.context.Account + "/positions/" + instrument)
 	if err != nil {
-		fmt.Printf("The HTTP request failed with error %s\n", err)
 		return nil, err
 	}
-	data, errb := io.ReadAll(response.Body)
-	if errb != nil {
-		return nil, errb
-	}
-	//fmt.Println(string(data))
-	positions, errp := parseAccountPosition(&data)
-	//fmt.Println(positions)
-
-	return &positions, errp
+	position, err := parseAccountPosition(&data)
+	return &position, err
 }
 
-// PostMarketOrder posts a Market orderr a number of candles for a given instrument and granularity
+// PostMarketOrder posts a Market order for a number of units of an instrument, see CreateOrder
 func (api *API) PostMarketOrder(instrument string, units int64) (error, error) {
-
-	orderReq := models.OrderRequest{
-		Order: models.MakeMarketOrder(instrument, units),
-	}
-	payload, _ := json.Marshal(orderReq)
-
-	// TODO DEDUPLICATE THIS
-	client := &http.Client{}
-	account := api.context.Account
-	apiURL := api.context.ApiURL
-	token := api.context.Token
-	req, errr := http.NewRequest("POST", apiURL+"/v3/accounts/"+account+"/orders",
-		bytes.NewBuffer(payload))
-	if errr != nil {
-		return nil, errr
-	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+token)
-	response, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("The HTTP request failed with error %s\n", err)
-		return nil, err
-	}
-	data, errp := io.ReadAll(response.Body)
-
-	fmt.Println(string(data))
-	//	orderStatus, _ := parseOrderStatus(&data)
-	//fmt.Println(positions)
-
-	return nil, errp
+	_, err := api.CreateOrder(models.MakeMarketOrder(instrument, units))
+	return nil, err
 }
 
 // GetPositionBook fetches the last PositionBook for instruments
 func (api *API) GetPositionBook(instrument string) (*models.PositionBook, error) {
-
-	// TODO DEDUPLICATE THIS
-	client := &http.Client{}
-	apiURL := api.context.ApiURL
-	token := api.context.Token
-	req, errr := http.NewRequest("GET", apiURL+"/v3/instruments/"+instrument+"/positionBook", nil)
-	if errr != nil {
-		return nil, errr
-	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+token)
-	response, err := client.Do(req)
+	data, err := api.get(api.context.ApiURL + "/v3/instruments/" + instrument + "/positionBook")
 	if err != nil {
-		fmt.Printf("The HTTP request failed with error %s\n", err)
 		return nil, err
 	}
-	data, errb := io.ReadAll(response.Body)
-	if errb != nil {
-		return nil, errb
-	}
-	//fmt.Println(string(data))
-	positionBook, errp := parsePositionBook(&data)
-	//fmt.Println(positions)
-
-	return &positionBook, errp
+	positionBook, err := parsePositionBook(&data)
+	return &positionBook, err
 }
 
 // GetAccounts gets the list of accounts for the provided token
 func (api *API) GetAccounts() (*models.Accounts, error) {
-	client := &http.Client{}
-	apiURL := api.context.ApiURL
-	token := api.context.Token
-	req, errr := http.NewRequest("GET", apiURL+"/v3/accounts", nil)
-	if errr != nil {
-		return nil, errr
-	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+token)
-	response, err := client.Do(req)
+	data, err := api.get(api.context.ApiURL + "/v3/accounts")
 	if err != nil {
-		fmt.Printf("The HTTP request failed with error %s\n", err)
 		return nil, err
 	}
-	data, errb := io.ReadAll(response.Body)
-	if errb != nil {
-		return nil, errb
+	accounts, err := parseAccounts(&data)
+	return &accounts, err
+}
+
+// GetAccountDetails gets the full state of the account: summary, open trades, pending orders and positions
+func (api *API) GetAccountDetails() (*models.AccountDetails, error) {
+	data, err := api.get(api.context.ApiURL + "/v3/accounts/" + api.context.Account)
+	if err != nil {
+		return nil, err
 	}
-	fmt.Println(string(data))
-	accounts, errp := parseAccounts(&data)
-	//fmt.Println(positions)
+	details, err := parseAccountDetails(&data)
+	return &details.Account, err
+}
 
-	return &accounts, errp
+// GetAccountChanges gets the changes of the account since a transaction ID, and its current price dependent state
+func (api *API) GetAccountChanges(sinceTransactionID string) (*models.AccountChangesResponse, error) {
+	data, err := api.get(api.context.ApiURL + "/v3/accounts/" + api.context.Account + "/changes?sinceTransactionID=" + sinceTransactionID)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := parseAccountChanges(&data)
+	return &changes, err
 }
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/burbru/goanda/models"
+)
+
+// Broker is the trading interface of an account: orders, trades, positions and summary.
+// It is implemented by API, and by simulated brokers (see the paper sub-package)
+type Broker interface {
+	CreateOrder(order models.Order) (*models.OrderCreateResponse, error)
+	CancelOrder(orderID string) (*models.Transaction, error)
+	GetOpenTrades() (*models.Trades, error)
+	CloseTrade(tradeID string, units int64) (*models.OrderCreateResponse, error)
+	GetOpenPositions() (*models.AccountPositions, error)
+	GetPosition(instrument string) (*models.AccountPosition, error)
+	GetAccountSummary() (*models.AccountSummary, error)
+}
+
+var _ Broker = (*API)(nil)
+
+// CreateOrder posts an order for the account, a rejected order returns the response with its
+// OrderRejectTransaction along with the *APIError. A unique client ID is assigned to orders without one,
+// so that an order whose request fails after reaching OANDA is resolved by its client ID instead of
+// being reported as failed, see OrderOutcomeError and RetryPolicy
+func (api *API) CreateOrder(order models.Order) (*models.OrderCreateResponse, error) {
+	order = withClientID(order)
+	payload, err := json.Marshal(models.OrderRequest{Order: order})
+	if err != nil {
+		return nil, err
+	}
+	data, outcome, err := api.postOrder(payload, order.ClientExtensions.ID)
+	if outcome != nil {
+		if outcome.OrderRejectTransaction != nil {
+			return outcome, &APIError{StatusCode: http.StatusBadRequest, ErrorCode: outcome.ErrorCode, ErrorMessage: outcome.ErrorMessage}
+		}
+		return outcome, nil
+	}
+	var apiErr *APIError
+	if err != nil && (data == nil || !errors.As(err, &apiErr)) {
+		return nil, err
+	}
+	response, errp := parseOrderCreateResponse(&data)
+	if err != nil {
+		return &response, err
+	}
+	return &response, errp
+}
+
+// GetOrder gets a pending, filled or cancelled order by ID, or by client ID prefixed with @
+func (api *API) GetOrder(orderID string) (*models.Order, error) {
+	data, err := api.get(api.context.ApiURL + "/v3/accounts/" + api.context.Account + "/orders/" + orderID)
+	if err != nil {
+		return nil, err
+	}
+	response, err := parseOrderResponse(&data)
+	return &response.Order, err
+}
+
+// GetPendingOrders gets the pending orders of the account
+func (api *API) GetPendingOrders() (*models.Orders, error) {
+	data, err := api.get(api.context.ApiURL + "/v3/accounts/" + api.context.Account + "/pendingOrders")
+	if err != nil {
+		return nil, err
+	}
+	orders, err := parseOrders(&data)
+	return &orders, err
+}
+
+// GetTransactionsSinceID gets the transactions of the account with an ID greater than id
+func (api *API) GetTransactionsSinceID(id string) (*models.Transactions, error) {
+	data, err := api.get(api.context.ApiURL + "/v3/accounts/" + api.context.Account + "/transactions/sinceid?id=" + id)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := parseTransactions(&data)
+	return &transactions, err
+}
+
+// CancelOrder cancels a pending order by ID, or by client ID prefixed with @
+func (api *API) CancelOrder(orderID string) (*models.Transaction, error) {
+	data, err := api.send("PUT", api.context.ApiURL+"/v3/accounts/"+api.context.Account+"/orders/"+orderID+"/cancel", nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := parseOrderCancelResponse(&data)
+	return response.OrderCancelTransaction, err
+}
+
+// GetOpenTrades gets the open Trades on the account
+func (api *API) GetOpenTrades() (*models.Trades, error) {
+	data, err := api.get(api.context.ApiURL + "/v3/accounts/" + api.context.Account + "/openTrades")
+	if err != nil {
+		return nil, err
+	}
+	trades, err := parseTrades(&data)
+	return &trades, err
+}
+
+// CloseTrade closes units of an open trade, all the units are closed when units is 0
+func (api *API) CloseTrade(tradeID string, units int64) (*models.OrderCreateResponse, error) {
+	closeReq := models.TradeCloseRequest{Units: "ALL"}
+	if units != 0 {
+		closeReq.Units = strconv.FormatInt(units, 10)
+	}
+	payload, err := json.Marshal(closeReq)
+	if err != nil {
+		return nil, err
+	}
+	data, err := api.send("PUT", api.context.ApiURL+"/v3/accounts/"+api.context.Account+"/trades/"+tradeID+"/close", payload)
+	if err != nil {
+		return nil, err
+	}
+	response, err := parseOrderCreateResponse(&data)
+	return &response, err
+}
+
+// GetAccountSummary gets the summary of the account
+func (api *API) GetAccountSummary() (*models.AccountSummary, error) {
+	data, err := api.get(api.context.ApiURL + "/v3/accounts/" + api.context.Account + "/summary")
+	if err != nil {
+		return nil, err
+	}
+	summary, err := parseAccountSummary(&data)
+	return &summary.Account, err
+}
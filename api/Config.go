@@ -0,0 +1,229 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Environment is an OANDA environment, it selects the API_URL_* and STREAM_URL_* endpoints
+type Environment string
+
+// The OANDA environments
+const (
+	EnvironmentPractice Environment = "practice"
+	EnvironmentLive     Environment = "live"
+)
+
+// The environment variables read by LoadContext
+const (
+	EnvConfig      = "OANDA_CONFIG"
+	EnvProfile     = "OANDA_PROFILE"
+	EnvEnvironment = "OANDA_ENVIRONMENT"
+	EnvApiURL      = "OANDA_API_URL"
+	EnvStreamURL   = "OANDA_STREAM_URL"
+	EnvToken       = "OANDA_API_KEY"
+	EnvAccount     = "OANDA_ACCOUNT"
+	EnvApplication = "OANDA_APPLICATION"
+	EnvAllowLive   = "OANDA_ALLOW_LIVE"
+)
+
+// ErrLiveTradingDisabled is returned when a Context targets the live environment without AllowLive
+var ErrLiveTradingDisabled = errors.New("oanda: live trading is not enabled, set allowLive or " + EnvAllowLive + "=true")
+
+// ParseEnvironment parses an environment name, practice (or demo) and live (or trade)
+func ParseEnvironment(name string) (Environment, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "practice", "demo", "fxpractice":
+		return EnvironmentPractice, nil
+	case "live", "trade", "fxtrade":
+		return EnvironmentLive, nil
+	}
+	return "", fmt.Errorf("oanda: unknown environment %q", name)
+}
+
+// URLs returns the REST and streaming endpoints of the environment
+func (e Environment) URLs() (apiURL string, streamURL string) {
+	if e == EnvironmentLive {
+		return API_URL_LIVE, STREAM_URL_LIVE
+	}
+	return API_URL_DEMO, STREAM_URL_DEMO
+}
+
+// Profile is a named configuration of a Context, the endpoints default to the ones of the Environment
+type Profile struct {
+	Environment Environment `json:"environment"`
+	ApiURL      string      `json:"apiURL"`
+	StreamURL   string      `json:"streamURL"`
+	Token       string      `json:"token"`
+	Account     string      `json:"account"`
+	Application string      `json:"application"`
+}
+
+// Config is the content of a configuration file, holding named profiles:
+//
+//	profile: practice
+//	profiles:
+//	  practice:
+//	    environment: practice
+//	    account: 101-004-1234567-001
+//	  live:
+//	    environment: live
+type Config struct {
+	// Profile is the name of the profile loaded when none is requested
+	Profile string `json:"profile"`
+	// AllowLive enables the profiles of the live environment
+	AllowLive bool               `json:"allowLive"`
+	Profiles  map[string]Profile `json:"profiles"`
+}
+
+// ParseConfig parses a configuration file in the JSON, YAML or TOML format. The YAML and TOML parsers
+// are minimal, they support nested tables of strings and booleans
+func ParseConfig(data []byte, format string) (*Config, error) {
+	var values map[string]interface{}
+	var err error
+	switch strings.TrimPrefix(strings.ToLower(format), ".") {
+	case "json":
+		config := &Config{}
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("oanda: invalid json config: %w", err)
+		}
+		return config, nil
+	case "yaml", "yml":
+		values, err = parseYAML(data)
+	case "toml":
+		values, err = parseTOML(data)
+	default:
+		return nil, fmt.Errorf("oanda: unsupported config format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the generic values are decoded as json, with the same field names
+	data, err = json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("oanda: invalid %s config: %w", format, err)
+	}
+	return config, nil
+}
+
+// LoadConfig reads a configuration file, its format is given by its extension
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data, filepath.Ext(path))
+}
+
+// LoadContext loads the Context of a profile from the configuration file at path, and from the
+// environment variables which override the profile. The path defaults to OANDA_CONFIG, no file is
+// read when both are empty. The profile defaults to OANDA_PROFILE, then to the Profile of the file.
+// The Context must have a token, and live trading must be enabled for the live environment
+func LoadContext(path string, profile string) (Context, error) {
+	return loadContext(path, profile, os.Getenv)
+}
+
+func loadContext(path string, profile string, getenv func(string) string) (Context, error) {
+	if path == "" {
+		path = getenv(EnvConfig)
+	}
+	config := &Config{}
+	if path != "" {
+		var err error
+		if config, err = LoadConfig(path); err != nil {
+			return Context{}, err
+		}
+	}
+	if profile == "" {
+		profile = getenv(EnvProfile)
+	}
+	if profile == "" {
+		profile = config.Profile
+	}
+	var p Profile
+	if profile != "" {
+		var ok bool
+		if p, ok = config.Profiles[profile]; !ok {
+			return Context{}, fmt.Errorf("oanda: unknown profile %q", profile)
+		}
+	}
+
+	override := func(value *string, key string) {
+		if v := getenv(key); v != "" {
+			*value = v
+		}
+	}
+	environment := string(p.Environment)
+	override(&environment, EnvEnvironment)
+	override(&p.ApiURL, EnvApiURL)
+	override(&p.StreamURL, EnvStreamURL)
+	override(&p.Token, EnvToken)
+	override(&p.Account, EnvAccount)
+	override(&p.Application, EnvApplication)
+	allowLive := config.AllowLive
+	if v := getenv(EnvAllowLive); v != "" {
+		allowLive = v == "true" || v == "1"
+	}
+
+	env := EnvironmentPractice
+	if environment != "" {
+		var err error
+		if env, err = ParseEnvironment(environment); err != nil {
+			return Context{}, err
+		}
+	}
+	apiURL, streamURL := env.URLs()
+	if p.ApiURL == "" {
+		p.ApiURL = apiURL
+	}
+	if p.StreamURL == "" {
+		p.StreamURL = streamURL
+	}
+	if p.Application == "" {
+		p.Application = "goanda"
+	}
+
+	ctx := Context{
+		ApiURL:       p.ApiURL,
+		StreamApiURL: p.StreamURL,
+		Token:        p.Token,
+		Account:      p.Account,
+		Application:  p.Application,
+	}
+	if err := ctx.Validate(); err != nil {
+		return Context{}, err
+	}
+	// a live profile may target a proxy, its endpoints are not the live ones
+	if (env == EnvironmentLive || ctx.IsLive()) && !allowLive {
+		return Context{}, ErrLiveTradingDisabled
+	}
+	return ctx, nil
+}
+
+// Validate checks that the Context has a token and valid endpoints
+func (context *Context) Validate() error {
+	if context.Token == "" {
+		return errors.New("oanda: the context has no token, set " + EnvToken)
+	}
+	for _, endpoint := range []string{context.ApiURL, context.StreamApiURL} {
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("oanda: invalid endpoint %q", endpoint)
+		}
+	}
+	return nil
+}
+
+// IsLive reports whether the endpoints of the Context are the ones of the live environment
+func (context *Context) IsLive() bool {
+	return strings.TrimSuffix(context.ApiURL, "/") == API_URL_LIVE || strings.TrimSuffix(context.StreamApiURL, "/") == STREAM_URL_LIVE
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses a YAML document made of nested mappings, indented with spaces, of scalar values
+func parseYAML(data []byte) (map[string]interface{}, error) {
+	type level struct {
+		indent int
+		values map[string]interface{}
+	}
+	root := make(map[string]interface{})
+	stack := []level{{indent: -1, values: root}}
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(stripComment(line), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("oanda: yaml line %d: tabs are not allowed for indentation", n+1)
+		}
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			return nil, fmt.Errorf("oanda: yaml line %d: sequences are not supported", n+1)
+		}
+		i := strings.Index(trimmed, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("oanda: yaml line %d: expected key: value", n+1)
+		}
+		key, err := unquote(strings.TrimSpace(trimmed[:i]))
+		if err != nil {
+			return nil, fmt.Errorf("oanda: yaml line %d: %w", n+1, err)
+		}
+		value := strings.TrimSpace(trimmed[i+1:])
+
+		indent := len(line) - len(trimmed)
+		for indent <= stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1].values
+		if value == "" {
+			child := make(map[string]interface{})
+			parent[key] = child
+			stack = append(stack, level{indent: indent, values: child})
+			continue
+		}
+		if parent[key], err = scalar(value); err != nil {
+			return nil, fmt.Errorf("oanda: yaml line %d: %w", n+1, err)
+		}
+	}
+	return root, nil
+}
+
+// parseTOML parses a TOML document made of tables and key = value pairs of scalar values, with bare keys.
+// The quoted keys are rejected, as they may contain the dots and equal signs splitting the keys
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	table := root
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("oanda: toml line %d: invalid table", n+1)
+			}
+			table = root
+			for _, name := range strings.Split(line[1:len(line)-1], ".") {
+				name, err := bareKey(strings.TrimSpace(name))
+				if err != nil {
+					return nil, fmt.Errorf("oanda: toml line %d: %w", n+1, err)
+				}
+				child, ok := table[name].(map[string]interface{})
+				if !ok {
+					child = make(map[string]interface{})
+					table[name] = child
+				}
+				table = child
+			}
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("oanda: toml line %d: expected key = value", n+1)
+		}
+		key, err := bareKey(strings.TrimSpace(line[:i]))
+		if err != nil {
+			return nil, fmt.Errorf("oanda: toml line %d: %w", n+1, err)
+		}
+		if table[key], err = scalar(strings.TrimSpace(line[i+1:])); err != nil {
+			return nil, fmt.Errorf("oanda: toml line %d: %w", n+1, err)
+		}
+	}
+	return root, nil
+}
+
+// bareKey returns a TOML key, which must be bare
+func bareKey(key string) (string, error) {
+	if strings.ContainsAny(key, `"'`) {
+		return "", fmt.Errorf("quoted key %s not supported", key)
+	}
+	if key == "" {
+		return "", errors.New("empty key")
+	}
+	return key, nil
+}
+
+// scalar parses a quoted string, a boolean, or returns the raw value as a string
+func scalar(value string) (interface{}, error) {
+	switch value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return unquote(value)
+}
+
+// unquote removes the double or single quotes of a value
+func unquote(value string) (string, error) {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return strconv.Unquote(value)
+	}
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return value[1 : len(value)-1], nil
+	}
+	if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'") {
+		return "", fmt.Errorf("unterminated string %s", value)
+	}
+	return value, nil
+}
+
+// stripComment removes a # comment which is not inside quotes
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
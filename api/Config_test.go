@@ -0,0 +1,88 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testConfig = `
+profile: practice
+profiles:
+  practice:
+    environment: practice
+    token: practice-token
+    account: 101-004-1234567-001
+  live:
+    environment: live
+    token: live-token
+  proxy:
+    environment: live
+    token: live-token
+    apiURL: https://proxy.example.com
+    streamURL: https://proxy.example.com
+`
+
+func writeConfig(t *testing.T) (string, func()) {
+	dir, err := os.MkdirTemp("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "oanda.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func environ(values map[string]string) func(string) string {
+	return func(key string) string { return values[key] }
+}
+
+func TestLoadContextProfile(t *testing.T) {
+	path, remove := writeConfig(t)
+	defer remove()
+
+	ctx, err := loadContext(path, "", environ(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.ApiURL != API_URL_DEMO || ctx.Token != "practice-token" || ctx.Account != "101-004-1234567-001" {
+		t.Errorf("context %+v", ctx)
+	}
+
+	ctx, err = loadContext(path, "", environ(map[string]string{EnvToken: "env-token", EnvAccount: "101-004-7654321-001"}))
+	if err != nil || ctx.Token != "env-token" || ctx.Account != "101-004-7654321-001" {
+		t.Errorf("context %+v %v, want the environment variables", ctx, err)
+	}
+}
+
+func TestLoadContextLiveGuard(t *testing.T) {
+	path, remove := writeConfig(t)
+	defer remove()
+
+	for _, profile := range []string{"live", "proxy"} {
+		if _, err := loadContext(path, profile, environ(nil)); err != ErrLiveTradingDisabled {
+			t.Errorf("%s: %v, want ErrLiveTradingDisabled", profile, err)
+		}
+		ctx, err := loadContext(path, profile, environ(map[string]string{EnvAllowLive: "true"}))
+		if err != nil {
+			t.Errorf("%s: %v with live trading allowed", profile, err)
+		}
+		if profile == "proxy" && ctx.ApiURL != "https://proxy.example.com" {
+			t.Errorf("%s: %s, want the proxy", profile, ctx.ApiURL)
+		}
+	}
+}
+
+func TestParseConfigTOMLQuotedKeys(t *testing.T) {
+	config, err := ParseConfig([]byte("profile = \"practice\"\n[profiles.practice]\ntoken = 'practice-token' # comment\n"), "toml")
+	if err != nil || config.Profile != "practice" || config.Profiles["practice"].Token != "practice-token" {
+		t.Fatalf("config %+v %v", config, err)
+	}
+	for _, toml := range []string{"\"profile\" = \"practice\"\n", "[\"profiles.practice\"]\ntoken = \"t\"\n", "[profiles.'practice']\n"} {
+		if _, err := ParseConfig([]byte(toml), "toml"); err == nil {
+			t.Errorf("%q parsed, want the quoted key rejected", toml)
+		}
+	}
+}
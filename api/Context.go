@@ -7,6 +7,8 @@ type Context struct {
 	Token        string
 	Account      string
 	Application  string
+	// Logger receives the logs of the api instances created from the Context, nothing is logged when nil
+	Logger Logger
 }
 
 // CreateAPI Creates an api instance from the Context
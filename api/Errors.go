@@ -0,0 +1,30 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// APIError is an error response of the v20 REST api
+type APIError struct {
+	StatusCode   int    `json:"-"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+	Body         []byte `json:"-"`
+	// RetryAfter is the delay requested by an HTTP 429 response
+	RetryAfter time.Duration `json:"-"`
+}
+
+func newAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode, Body: body}
+	json.Unmarshal(body, apiErr)
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	if e.ErrorCode != "" {
+		return fmt.Sprintf("oanda: HTTP %d %s: %s", e.StatusCode, e.ErrorCode, e.ErrorMessage)
+	}
+	return fmt.Sprintf("oanda: HTTP %d: %s", e.StatusCode, e.ErrorMessage)
+}
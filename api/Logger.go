@@ -0,0 +1,58 @@
+package api
+
+import "strings"
+
+// Logger is a leveled logger with structured fields, each method takes a message followed by alternating
+// keys and values. It is the method set of *slog.Logger, which can be used as the Logger of a Context
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// NopLogger discards the logs, it is used when no Logger is set
+type NopLogger struct{}
+
+func (NopLogger) Debug(msg string, args ...interface{}) {}
+func (NopLogger) Info(msg string, args ...interface{})  {}
+func (NopLogger) Warn(msg string, args ...interface{})  {}
+func (NopLogger) Error(msg string, args ...interface{}) {}
+
+// redactLogger replaces the token in the string and error values logged
+type redactLogger struct {
+	logger Logger
+	token  string
+}
+
+func (l redactLogger) Debug(msg string, args ...interface{}) { l.logger.Debug(msg, l.redact(args)...) }
+func (l redactLogger) Info(msg string, args ...interface{})  { l.logger.Info(msg, l.redact(args)...) }
+func (l redactLogger) Warn(msg string, args ...interface{})  { l.logger.Warn(msg, l.redact(args)...) }
+func (l redactLogger) Error(msg string, args ...interface{}) { l.logger.Error(msg, l.redact(args)...) }
+
+func (l redactLogger) redact(args []interface{}) []interface{} {
+	if l.token == "" {
+		return args
+	}
+	redacted := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			arg = strings.ReplaceAll(v, l.token, "[REDACTED]")
+		case error:
+			if strings.Contains(v.Error(), l.token) {
+				arg = strings.ReplaceAll(v.Error(), l.token, "[REDACTED]")
+			}
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
+
+// logger returns the Logger of the Context redacting its token, or a silent Logger when none is set
+func (context *Context) logger() Logger {
+	if context.Logger == nil {
+		return NopLogger{}
+	}
+	return redactLogger{logger: context.Logger, token: context.Token}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"strings"
+	"time"
+)
+
+// Observer receives the events of the REST calls and of the streams, to collect metrics.
+// Its methods are called synchronously and must not block
+type Observer interface {
+	// ObserveRequest is called for each request sent, with the status code of the response (0 when no
+	// response was received), its latency and the error returned. The endpoint is the path of the request
+	// with the account, instrument, order and trade IDs replaced by placeholders
+	ObserveRequest(method string, endpoint string, status int, latency time.Duration, err error)
+	// ObserveStreamConnect is called when a stream connects, or fails to connect with err
+	ObserveStreamConnect(stream string, err error)
+	// ObserveStreamDisconnect is called when the connection of a stream is lost
+	ObserveStreamDisconnect(stream string, err error)
+	// ObserveHeartbeat is called for each heartbeat, with the gap since the previous heartbeat or the connection
+	ObserveHeartbeat(stream string, gap time.Duration)
+	// ObserveBacklog is called before a message is sent to the channel of a stream, with the number of
+	// messages waiting in the channel
+	ObserveBacklog(stream string, backlog int)
+}
+
+// NopObserver ignores all the events, it can be embedded to implement only some methods of Observer
+type NopObserver struct{}
+
+func (NopObserver) ObserveRequest(method string, endpoint string, status int, latency time.Duration, err error) {
+}
+func (NopObserver) ObserveStreamConnect(stream string, err error)     {}
+func (NopObserver) ObserveStreamDisconnect(stream string, err error)  {}
+func (NopObserver) ObserveHeartbeat(stream string, gap time.Duration) {}
+func (NopObserver) ObserveBacklog(stream string, backlog int)         {}
+
+// SetObserver sets the Observer of the REST calls of the api instance
+func (api *API) SetObserver(observer Observer) {
+	api.observer = observer
+}
+
+// SetObserver sets the Observer of the pricing streams
+func (streamApi *StreamAPI) SetObserver(observer Observer) {
+	streamApi.observer = observer
+}
+
+// SetObserver sets the Observer of the transaction streams
+func (streamApi *TransactionStreamAPI) SetObserver(observer Observer) {
+	streamApi.observer = observer
+}
+
+func observerOrNop(observer Observer) Observer {
+	if observer == nil {
+		return NopObserver{}
+	}
+	return observer
+}
+
+// endpointPlaceholders are the placeholders of the path segments following a collection
+var endpointPlaceholders = map[string]string{
+	"accounts":    "{accountID}",
+	"instruments": "{instrument}",
+	"positions":   "{instrument}",
+	"orders":      "{orderSpecifier}",
+	"trades":      "{tradeSpecifier}",
+}
+
+// Endpoint returns the endpoint of a request path, with the IDs replaced by placeholders:
+// /v3/accounts/{accountID}/orders/{orderSpecifier}/cancel
+func Endpoint(path string) string {
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		if placeholder, ok := endpointPlaceholders[segments[i-1]]; ok && segments[i] != "" {
+			segments[i] = placeholder
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/burbru/goanda/models"
+)
+
+// orderScanDepth is the number of recent transactions searched for an order not found by its client ID
+const orderScanDepth = 1000
+
+// OrderOutcomeError is returned when an order creation failed with Err after the request may have reached
+// OANDA, and its outcome could not be determined. The order can be looked up later with GetOrder("@" + ClientID)
+type OrderOutcomeError struct {
+	ClientID string
+	Err      error
+}
+
+func (e *OrderOutcomeError) Error() string {
+	return fmt.Sprintf("oanda: outcome of order %s unknown: %v", e.ClientID, e.Err)
+}
+
+func (e *OrderOutcomeError) Unwrap() error {
+	return e.Err
+}
+
+// NewClientID returns a unique client order ID
+func NewClientID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "goanda-" + hex.EncodeToString(b)
+}
+
+// withClientID returns the order with a client ID, a copy of its ClientExtensions is made when one is assigned
+func withClientID(order models.Order) models.Order {
+	if order.ClientExtensions != nil && order.ClientExtensions.ID != "" {
+		return order
+	}
+	extensions := models.ClientExtensions{}
+	if order.ClientExtensions != nil {
+		extensions = *order.ClientExtensions
+	}
+	extensions.ID = NewClientID()
+	order.ClientExtensions = &extensions
+	return order
+}
+
+// ambiguous reports whether a failed order creation may have reached OANDA: a network error or a 5xx status
+func ambiguous(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	return Retryable(err)
+}
+
+// resolveOrder determines the outcome of an order by client ID, looking it up by @clientID and then in
+// the recent transactions of the account. It returns a nil response when the order was not received
+func (api *API) resolveOrder(clientID string) (*models.OrderCreateResponse, error) {
+	order, err := api.GetOrder("@" + clientID)
+	var apiErr *APIError
+	if err == nil {
+		transactions, err := api.GetTransactionsSinceID(previousID(order.ID))
+		if err != nil {
+			return nil, err
+		}
+		return orderOutcome(transactions, order.ID)
+	}
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		return nil, err
+	}
+
+	// rejected orders only exist as transactions
+	summary, err := api.GetAccountSummary()
+	if err != nil {
+		return nil, err
+	}
+	last, _ := strconv.ParseInt(summary.LastTransactionID, 10, 64)
+	since := last - orderScanDepth
+	if since < 0 {
+		since = 0
+	}
+	transactions, err := api.GetTransactionsSinceID(strconv.FormatInt(since, 10))
+	if err != nil {
+		return nil, err
+	}
+	for _, transaction := range transactions.Transactions {
+		if transaction.ClientExtensions != nil && transaction.ClientExtensions.ID == clientID {
+			return orderOutcome(transactions, transaction.ID)
+		}
+	}
+	return nil, nil
+}
+
+// orderOutcome rebuilds the creation response of an order from the transactions following its creation
+// or rejection transaction orderID
+func orderOutcome(transactions *models.Transactions, orderID string) (*models.OrderCreateResponse, error) {
+	response := &models.OrderCreateResponse{LastTransactionID: transactions.LastTransactionID}
+	for i := range transactions.Transactions {
+		transaction := &transactions.Transactions[i]
+		switch {
+		case transaction.ID == orderID && strings.HasSuffix(transaction.Type, "_REJECT"):
+			response.OrderRejectTransaction = transaction
+		case transaction.ID == orderID:
+			response.OrderCreateTransaction = transaction
+		case transaction.OrderID != orderID:
+		case transaction.Type == models.TransactionTypeOrderFill && response.OrderFillTransaction == nil:
+			response.OrderFillTransaction = transaction
+		case transaction.Type == models.TransactionTypeOrderCancel && response.OrderCancelTransaction == nil:
+			response.OrderCancelTransaction = transaction
+		}
+		if transaction.BatchID == orderID {
+			response.RelatedTransactionIDs = append(response.RelatedTransactionIDs, transaction.ID)
+		}
+	}
+	if reject := response.OrderRejectTransaction; reject != nil {
+		response.ErrorCode = reject.RejectReason
+		response.ErrorMessage = "The order was rejected"
+	} else if response.OrderCreateTransaction == nil {
+		return nil, errors.New("oanda: transactions of order " + orderID + " not found")
+	}
+	return response, nil
+}
+
+func previousID(id string) string {
+	n, _ := strconv.ParseInt(id, 10, 64)
+	if n > 0 {
+		n--
+	}
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,109 @@
+package api_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+	"github.com/burbru/goanda/oandatest"
+)
+
+func newOrderServer() (*oandatest.Server, api.API) {
+	server := oandatest.NewServer(oandatest.Config{Account: accountConfig()})
+	server.SetPrice(eurusd(1.2, 1.2002))
+	ctx := server.Context()
+	return server, ctx.CreateAPI()
+}
+
+func countOrders(server *oandatest.Server) int {
+	n := 0
+	for _, transaction := range server.Account.Transactions() {
+		if transaction.Type == "MARKET_ORDER" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCreateOrderResolvedByClientID(t *testing.T) {
+	server, client := newOrderServer()
+	defer server.Close()
+	// the order is processed but its response is lost
+	server.AddFault(oandatest.Fault{Method: "POST", Path: "/orders", Status: http.StatusBadGateway, Count: 1, Process: true})
+
+	order := marketOrder(1000)
+	order.ClientExtensions = &models.ClientExtensions{ID: "my-order"}
+	response, err := client.CreateOrder(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.OrderCreateTransaction == nil || response.OrderFillTransaction == nil || response.OrderFillTransaction.TradeOpened == nil {
+		t.Fatalf("response %+v, want the order and its fill", response)
+	}
+	if n := countOrders(server); n != 1 {
+		t.Errorf("%d orders, want 1", n)
+	}
+	if n := countRequests(server, "GET", "/v3/accounts/sim/orders/@my-order"); n != 1 {
+		t.Errorf("%d lookups by client ID, want 1", n)
+	}
+}
+
+func TestCreateOrderRetriedWhenNotReceived(t *testing.T) {
+	server, client := newOrderServer()
+	defer server.Close()
+	client.SetRetryPolicy(api.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2, Orders: true})
+	server.AddFault(oandatest.Fault{Method: "POST", Path: "/orders", Status: http.StatusServiceUnavailable, Count: 1})
+
+	response, err := client.CreateOrder(marketOrder(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.OrderFillTransaction == nil {
+		t.Fatalf("response %+v, want a fill", response)
+	}
+	if n := countOrders(server); n != 1 {
+		t.Errorf("%d orders, want 1", n)
+	}
+	if n := countRequests(server, "POST", "/v3/accounts/sim/orders"); n != 2 {
+		t.Errorf("%d order requests, want 2", n)
+	}
+}
+
+func TestCreateOrderOutcomeUnknown(t *testing.T) {
+	server, client := newOrderServer()
+	defer server.Close()
+	server.AddFault(oandatest.Fault{Method: "POST", Path: "/orders", Status: http.StatusServiceUnavailable, Count: 1, Process: true})
+	server.AddFault(oandatest.Fault{Method: "GET", Path: "/orders/@", Status: http.StatusServiceUnavailable, Count: 1})
+
+	order := marketOrder(1000)
+	order.ClientExtensions = &models.ClientExtensions{ID: "my-order"}
+	_, err := client.CreateOrder(order)
+	var outcomeErr *api.OrderOutcomeError
+	if !errors.As(err, &outcomeErr) || outcomeErr.ClientID != "my-order" {
+		t.Fatalf("error %v, want an OrderOutcomeError", err)
+	}
+	// the order can be looked up later
+	found, err := client.GetOrder("@my-order")
+	if err != nil || found.State != models.OrderStateFilled {
+		t.Errorf("order %+v %v, want filled", found, err)
+	}
+}
+
+func TestCreateOrderRejected(t *testing.T) {
+	server, client := newOrderServer()
+	defer server.Close()
+
+	order := marketOrder(1000)
+	order.Instrument = "XXX_YYY"
+	response, err := client.CreateOrder(order)
+	var apiErr *api.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("error %v, want HTTP 400", err)
+	}
+	if response == nil || response.OrderRejectTransaction == nil || response.ErrorCode != models.ReasonInstrumentUnknown {
+		t.Errorf("response %+v, want the reject", response)
+	}
+}
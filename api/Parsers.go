@@ -62,3 +62,57 @@ func parseInstruments(msg *[]byte) (models.Instruments, error) {
 
 	return ins, err
 }
+
+func parseTrades(msg *[]byte) (models.Trades, error) {
+	var t models.Trades
+	err := json.Unmarshal(*msg, &t)
+	return t, err
+}
+
+func parseAccountSummary(msg *[]byte) (models.AccountSummaryResponse, error) {
+	var s models.AccountSummaryResponse
+	err := json.Unmarshal(*msg, &s)
+	return s, err
+}
+
+func parseOrderCreateResponse(msg *[]byte) (models.OrderCreateResponse, error) {
+	var r models.OrderCreateResponse
+	err := json.Unmarshal(*msg, &r)
+	return r, err
+}
+
+func parseOrderCancelResponse(msg *[]byte) (models.OrderCancelResponse, error) {
+	var r models.OrderCancelResponse
+	err := json.Unmarshal(*msg, &r)
+	return r, err
+}
+
+func parseOrderResponse(msg *[]byte) (models.OrderResponse, error) {
+	var r models.OrderResponse
+	err := json.Unmarshal(*msg, &r)
+	return r, err
+}
+
+func parseOrders(msg *[]byte) (models.Orders, error) {
+	var r models.Orders
+	err := json.Unmarshal(*msg, &r)
+	return r, err
+}
+
+func parseTransactions(msg *[]byte) (models.Transactions, error) {
+	var r models.Transactions
+	err := json.Unmarshal(*msg, &r)
+	return r, err
+}
+
+func parseAccountDetails(msg *[]byte) (models.AccountDetailsResponse, error) {
+	var r models.AccountDetailsResponse
+	err := json.Unmarshal(*msg, &r)
+	return r, err
+}
+
+func parseAccountChanges(msg *[]byte) (models.AccountChangesResponse, error) {
+	var r models.AccountChangesResponse
+	err := json.Unmarshal(*msg, &r)
+	return r, err
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OANDA allows 100 requests per second on a connection, and 2 new connections per second
+const (
+	DefaultRequestRate    = 100
+	DefaultConnectionRate = 2
+)
+
+// RateLimiter is a token bucket: up to burst requests at once, refilled at rate per second.
+// Requests acquire a token before being sent and do not wait for each other to complete
+type RateLimiter struct {
+	mutex       sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	stats       RateLimiterStats
+}
+
+// RateLimiterStats are the metrics of a RateLimiter
+type RateLimiterStats struct {
+	// Requests is the number of tokens acquired
+	Requests int64
+	// Waits is the number of requests which had to wait for a token
+	Waits int64
+	// TotalWait and MaxWait are the total and the longest time waited for a token
+	TotalWait time.Duration
+	MaxWait   time.Duration
+	// Throttled is the number of HTTP 429 responses
+	Throttled int64
+}
+
+// NewRateLimiter creates a RateLimiter allowing rate requests per second, with bursts of burst requests
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available, or the context is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	wait := l.reserve()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token, possibly in advance, and returns the time to wait for it
+func (l *RateLimiter) reserve() time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens--
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	if pause := l.pausedUntil.Sub(now); pause > wait {
+		wait = pause
+	}
+	l.stats.Requests++
+	if wait > 0 {
+		l.stats.Waits++
+		l.stats.TotalWait += wait
+		if wait > l.stats.MaxWait {
+			l.stats.MaxWait = wait
+		}
+	}
+	return wait
+}
+
+// Pause stops giving tokens for a duration, as requested by a Retry-After header
+func (l *RateLimiter) Pause(d time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.stats.Throttled++
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Stats returns the metrics of the RateLimiter
+func (l *RateLimiter) Stats() RateLimiterStats {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.stats
+}
+
+// NewTransport creates an http.Transport opening at most DefaultConnectionRate new connections per second,
+// and keeping enough idle connections to reuse them for concurrent requests
+func NewTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 20
+	connLimiter := NewRateLimiter(DefaultConnectionRate, DefaultConnectionRate)
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport.DialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		if err := connLimiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return transport
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an http date, 1 second if missing
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return time.Second
+}
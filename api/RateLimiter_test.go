@@ -0,0 +1,97 @@
+package api_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+	"github.com/burbru/goanda/oandatest"
+)
+
+func marketOrder(units int64) models.Order {
+	return models.Order{Type: models.OrderTypeMarket, Instrument: "EUR_USD", Units: units, TimeInForce: models.TimeInForceFOK}
+}
+
+func countRequests(server *oandatest.Server, method string, path string) int {
+	n := 0
+	for _, request := range server.Requests() {
+		if request.Method == method && request.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+func TestThrottledRequest(t *testing.T) {
+	server := oandatest.NewServer(oandatest.Config{Account: accountConfig()})
+	defer server.Close()
+	api.SetRateLimiter(api.NewRateLimiter(api.DefaultRequestRate, api.DefaultRequestRate))
+	server.AddFault(oandatest.Fault{Path: "/summary", Status: http.StatusTooManyRequests, RetryAfter: time.Second, Count: 1})
+	ctx := server.Context()
+	client := ctx.CreateAPI()
+	path := "/v3/accounts/sim/summary"
+
+	// a throttled request is not retried by default
+	_, err := client.GetAccountSummary()
+	var apiErr *api.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.RetryAfter != time.Second {
+		t.Fatalf("error %v, want HTTP 429 with a Retry-After of 1s", err)
+	}
+	if n := countRequests(server, "GET", path); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+
+	limiter := api.NewRateLimiter(api.DefaultRequestRate, api.DefaultRequestRate)
+	api.SetRateLimiter(limiter)
+	client.SetRetryPolicy(api.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, Multiplier: 2})
+	server.AddFault(oandatest.Fault{Path: "/summary", Status: http.StatusTooManyRequests, RetryAfter: time.Second, Count: 1})
+	start := time.Now()
+	summary, err := client.GetAccountSummary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Balance != 10000 {
+		t.Errorf("balance %g", summary.Balance)
+	}
+	// the request is sent again after the Retry-After delay rather than the backoff
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("sent again after %s, want the 1s of Retry-After", elapsed)
+	}
+	if n := countRequests(server, "GET", path); n != 3 {
+		t.Errorf("%d requests, want 1 + 2 attempts", n)
+	}
+	if stats := limiter.Stats(); stats.Throttled != 1 {
+		t.Errorf("throttled %d, want 1", stats.Throttled)
+	}
+}
+
+func TestThrottledOrderNotResolved(t *testing.T) {
+	server := oandatest.NewServer(oandatest.Config{Account: accountConfig()})
+	defer server.Close()
+	api.SetRateLimiter(api.NewRateLimiter(api.DefaultRequestRate, api.DefaultRequestRate))
+	server.SetPrice(eurusd(1.2, 1.2002))
+	// a throttled order was not processed, it is sent again without a lookup of its client ID
+	server.AddFault(oandatest.Fault{Method: "POST", Path: "/orders", Status: http.StatusTooManyRequests, RetryAfter: time.Second, Count: 1})
+	ctx := server.Context()
+	client := ctx.CreateAPI()
+	client.SetRetryPolicy(api.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, Multiplier: 2, Orders: true})
+
+	response, err := client.CreateOrder(marketOrder(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.OrderFillTransaction == nil {
+		t.Errorf("response %+v, want a fill", response)
+	}
+	if n := countRequests(server, "POST", "/v3/accounts/sim/orders"); n != 2 {
+		t.Errorf("%d order requests, want 2", n)
+	}
+	for _, request := range server.Requests() {
+		if request.Method == "GET" {
+			t.Errorf("lookup %s of a throttled order", request.Path)
+		}
+	}
+}
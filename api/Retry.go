@@ -0,0 +1,130 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/burbru/goanda/models"
+)
+
+// RetryPolicy configures the retries of the REST calls failing with a network error, HTTP 429 or a 5xx status.
+// GET requests are sent again after an exponential backoff, or after the Retry-After delay of an HTTP 429
+// when it is longer. Order creations are sent again only when Orders
+// is set, and a lookup by @clientID confirms the order was not already received
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one, requests are not retried below 2
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Orders enables the safe retry of the order creations
+	Orders bool
+}
+
+// DefaultRetryPolicy makes up to 4 attempts, waiting 250ms, 500ms and 1s between them
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 250 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Orders:         true,
+}
+
+// Backoff returns the delay before the attempt following attempt, counted from 1
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		backoff *= p.Multiplier
+		if p.MaxBackoff > 0 && backoff >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(backoff)
+}
+
+// delay returns the Backoff of attempt, or the Retry-After delay of err when it is longer
+func (p RetryPolicy) delay(attempt int, err error) time.Duration {
+	backoff := p.Backoff(attempt)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > backoff {
+		return apiErr.RetryAfter
+	}
+	return backoff
+}
+
+// Retryable reports whether err is transient: a network error, or an *APIError with HTTP 429 or a 5xx status
+func Retryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Op != "parse"
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// SetRetryPolicy sets the RetryPolicy of the api instance, requests are not retried by default
+func (api *API) SetRetryPolicy(policy RetryPolicy) {
+	api.retry = policy
+}
+
+// get sends a GET request, retried according to the RetryPolicy
+func (api *API) get(reqUrl string) ([]byte, error) {
+	for attempt := 1; ; attempt++ {
+		data, err := api.send("GET", reqUrl, nil)
+		if err == nil || attempt >= api.retry.MaxAttempts || !Retryable(err) {
+			return data, err
+		}
+		backoff := api.retry.delay(attempt, err)
+		// the path only, as the other logs, the query parameters are not logged
+		path := reqUrl
+		if parsedURL, err := url.Parse(reqUrl); err == nil {
+			path = parsedURL.Path
+		}
+		api.context.logger().Info("oanda request retried", "method", "GET", "path", path, "attempt", attempt+1, "backoff", backoff)
+		time.Sleep(backoff)
+	}
+}
+
+// postOrder posts an order payload with a client ID. When the request fails after it may have reached OANDA,
+// the outcome of the order is resolved by its client ID and returned instead of the data, an outcome which
+// cannot be resolved returns an *OrderOutcomeError. An order which was not received is posted again when
+// the RetryPolicy allows it
+func (api *API) postOrder(payload []byte, clientID string) ([]byte, *models.OrderCreateResponse, error) {
+	reqUrl := api.context.ApiURL + "/v3/accounts/" + api.context.Account + "/orders"
+	for attempt := 1; ; attempt++ {
+		data, err := api.send("POST", reqUrl, payload)
+		if err == nil || !Retryable(err) {
+			return data, nil, err
+		}
+		retry := api.retry.Orders && attempt < api.retry.MaxAttempts
+		if retry {
+			time.Sleep(api.retry.delay(attempt, err))
+		}
+
+		// a throttled request was not processed, any other failure may have reached OANDA
+		if ambiguous(err) {
+			response, errr := api.resolveOrder(clientID)
+			if errr != nil {
+				api.context.logger().Error("oanda order outcome unknown", "clientID", clientID, "error", err, "lookupError", errr)
+				return nil, nil, &OrderOutcomeError{ClientID: clientID, Err: err}
+			}
+			if response != nil {
+				api.context.logger().Info("oanda order resolved", "clientID", clientID, "error", err)
+				return nil, response, nil
+			}
+		}
+		if !retry {
+			return data, nil, err
+		}
+		api.context.logger().Info("oanda order retried", "clientID", clientID, "attempt", attempt+1)
+	}
+}
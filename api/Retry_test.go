@@ -0,0 +1,77 @@
+package api_test
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/oandatest"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := api.DefaultRetryPolicy
+	for attempt, want := range map[int]time.Duration{1: 250 * time.Millisecond, 2: 500 * time.Millisecond, 3: time.Second, 10: 5 * time.Second} {
+		if backoff := policy.Backoff(attempt); backoff != want {
+			t.Errorf("backoff %d: %s, want %s", attempt, backoff, want)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for _, test := range []struct {
+		err       error
+		retryable bool
+	}{
+		{&api.APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{&api.APIError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&api.APIError{StatusCode: http.StatusBadRequest}, false},
+		{&api.APIError{StatusCode: http.StatusNotFound}, false},
+		{&url.Error{Op: "Get", Err: errors.New("connection reset")}, true},
+		{&url.Error{Op: "parse", Err: errors.New("invalid")}, false},
+		{errors.New("other"), false},
+	} {
+		if retryable := api.Retryable(test.err); retryable != test.retryable {
+			t.Errorf("%v: retryable %t, want %t", test.err, retryable, test.retryable)
+		}
+	}
+}
+
+func TestRetryGet(t *testing.T) {
+	server := oandatest.NewServer(oandatest.Config{Account: accountConfig()})
+	defer server.Close()
+	ctx := server.Context()
+	client := ctx.CreateAPI()
+	path := "/v3/accounts/sim/summary"
+
+	// requests are not retried by default
+	server.AddFault(oandatest.Fault{Path: "/summary", Status: http.StatusServiceUnavailable, Count: 1})
+	_, err := client.GetAccountSummary()
+	var apiErr *api.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("error %v, want HTTP 503", err)
+	}
+	if n := countRequests(server, "GET", path); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+
+	client.SetRetryPolicy(api.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2})
+	server.AddFault(oandatest.Fault{Path: "/summary", Status: http.StatusServiceUnavailable, Count: 2})
+	if _, err := client.GetAccountSummary(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRequests(server, "GET", path); n != 4 {
+		t.Errorf("%d requests, want 1 + 3 attempts", n)
+	}
+
+	// a client error is not retried
+	server.AddFault(oandatest.Fault{Path: "/summary", Status: http.StatusBadRequest, Count: 1})
+	if _, err := client.GetAccountSummary(); err == nil {
+		t.Fatal("no error")
+	}
+	if n := countRequests(server, "GET", path); n != 5 {
+		t.Errorf("%d requests, want 5", n)
+	}
+}
@@ -2,9 +2,10 @@ package api
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
-	"fmt"
-	"log"
+	"errors"
+	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -14,69 +15,169 @@ import (
 
 // StreamAPI is an api instance with a context to call endpoints
 type StreamAPI struct {
-	context Context
+	context  Context
+	observer Observer
 }
 
 type priceProcessor func(p *models.ClientPrice)
 type heartbeatProcessor func(p *models.PricingHeartbeat)
 
-// TickStream starts a stream of ticks, hiding the Prices structs which are autoRestarted
+// TickStream starts a stream of ticks, hiding the Prices structs which are autoRestarted.
+// The prices without bids or asks, sent while an instrument is not tradeable, are skipped
 func (streamApi *StreamAPI) TickStream(instruments []string, tchan chan models.Tick, hchan chan models.PricingHeartbeat) {
 	pchan := make(chan models.ClientPrice)
 	// AutoRestart for PricingStream
-	go autoRestart("PricingStream", 0, func() { streamApi.PricingStream(instruments, pchan, hchan) })
+	go autoRestart(streamApi.context.logger(), "PricingStream", 0, func() { streamApi.PricingStream(instruments, pchan, hchan) })
 
-	fmt.Println("Starting loop on Prices")
 	for {
 		price := <-pchan
-		tchan <- models.ClientPrice2Tick(&price)
+		if tick := models.ClientPrice2Tick(&price); tick.Complete() {
+			tchan <- tick
+		}
+	}
+}
+
+// StartPricingStream starts a stream of prices in the background, which is autoRestarted
+func (streamApi *StreamAPI) StartPricingStream(instruments []string, pchan chan models.ClientPrice, hchan chan models.PricingHeartbeat) {
+	go autoRestart(streamApi.context.logger(), "PricingStream", 0, func() { streamApi.PricingStream(instruments, pchan, hchan) })
+}
+
+// StartPricingStreamContext starts a stream of prices in the background as StartPricingStream does, until ctx
+// is done: the connection is then closed, and the stream is no longer restarted nor waits for pchan and hchan
+func (streamApi *StreamAPI) StartPricingStreamContext(ctx context.Context, instruments []string, pchan chan models.ClientPrice, hchan chan models.PricingHeartbeat) {
+	go autoRestart(streamApi.context.logger(), "PricingStream", 0, func() { streamApi.pricingStream(ctx, instruments, pchan, hchan) })
+}
+
+// StreamPrices starts a stream of prices, which is autoRestarted, and calls onPrice for each price and
+// onHeartbeat for each heartbeat when it is not nil. It blocks until the server refuses the stream,
+// for instance with HTTP 401, and returns the *APIError
+func (streamApi *StreamAPI) StreamPrices(instruments []string, onPrice func(models.ClientPrice), onHeartbeat func(models.PricingHeartbeat)) error {
+	pchan := make(chan models.ClientPrice, 100)
+	hchan := make(chan models.PricingHeartbeat, 10)
+	done := make(chan error, 1)
+	go autoRestart(streamApi.context.logger(), "PricingStream", 0, func() { done <- streamApi.pricingStream(context.Background(), instruments, pchan, hchan) })
+
+	for {
+		select {
+		case price := <-pchan:
+			onPrice(price)
+		case heartbeat := <-hchan:
+			if onHeartbeat != nil {
+				onHeartbeat(heartbeat)
+			}
+		case err := <-done:
+			return err
+		}
 	}
 }
 
 // AutoRestart for the PricingStream function as connection reset can result in panic
-func autoRestart(name string, nPanics int64, f func()) {
+func autoRestart(logger Logger, name string, nPanics int64, f func()) {
 	defer func() {
 		if v := recover(); v != nil {
 			// A panic is detected.
-			log.Printf("%s is crashed. Panic #%d. Restarting in 5 seconds.", name, nPanics+1)
+			logger.Warn("oanda stream restarting", "stream", name, "panic", nPanics+1, "delay", 5*time.Second)
 			time.Sleep(5 * time.Second)
-			go autoRestart(name, nPanics+1, f) // restart
+			go autoRestart(logger, name, nPanics+1, f) // restart
 		}
 	}()
 	f()
 }
 
-// PricingStream starts a stream of prices
+// PricingStream starts a stream of prices. It returns when the server refuses the stream, and panics
+// when the connection fails or is lost
 func (streamApi *StreamAPI) PricingStream(instruments []string, pchan chan models.ClientPrice, hchan chan models.PricingHeartbeat) {
+	streamApi.pricingStream(context.Background(), instruments, pchan, hchan)
+}
+
+// pricingStream runs PricingStream until ctx is done, returning the error of a refused stream or of ctx
+func (streamApi *StreamAPI) pricingStream(ctx context.Context, instruments []string, pchan chan models.ClientPrice, hchan chan models.PricingHeartbeat) error {
 
 	url := streamApi.context.StreamApiURL + "/v3/accounts/" + streamApi.context.Account + "/pricing/stream"
 	qurl := url + "?instruments=" + strings.Join(instruments, ",")
-	client := &http.Client{}
-	req, _ := http.NewRequest("GET", qurl, nil)
+	req, _ := http.NewRequestWithContext(ctx, "GET", qurl, nil)
 	req.Header.Add("Authorization", "Bearer "+streamApi.context.Token)
-	response, err := client.Do(req)
+	logger := streamApi.context.logger()
+	observer := observerOrNop(streamApi.observer)
+	response, err := connectStream(logger, observer, "PricingStream", req)
 	if err != nil {
-		fmt.Printf("The HTTP request failed with error %s\n", err)
-	} else {
-		reader := bufio.NewReader(response.Body)
-		for {
-			line, err := reader.ReadBytes('\n')
-			if err != nil {
-				log.Println(err)
-				panic("Connection on clientStream is lost")
+		return err
+	}
+	defer response.Body.Close()
+	reader := bufio.NewReader(response.Body)
+	lastHeartbeat := time.Now()
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			observer.ObserveStreamDisconnect("PricingStream", err)
+			if ctx.Err() != nil {
+				logger.Info("oanda stream stopped", "stream", "PricingStream")
+				return ctx.Err()
+			}
+			logger.Warn("oanda stream lost", "stream", "PricingStream", "error", err)
+			panic("Connection on clientStream is lost")
+		}
+		var p models.ClientPrice
+		if err := json.Unmarshal(line, &p); err != nil {
+			logger.Warn("oanda stream line skipped", "stream", "PricingStream", "error", err)
+			continue
+		}
+		if p.Type == "HEARTBEAT" {
+			h := models.PricingHeartbeat{
+				Type: p.Type,
+				Time: p.Time,
 			}
-			var p models.ClientPrice
-			json.Unmarshal([]byte(line), &p)
-			if p.Type == "HEARTBEAT" {
-				h := models.PricingHeartbeat{
-					Type: p.Type,
-					Time: p.Time,
-				}
-				hchan <- h
-			} else {
-				pchan <- p
+			now := time.Now()
+			observer.ObserveHeartbeat("PricingStream", now.Sub(lastHeartbeat))
+			lastHeartbeat = now
+			select {
+			case hchan <- h:
+			case <-ctx.Done():
+			}
+		} else {
+			observer.ObserveBacklog("PricingStream", len(pchan))
+			select {
+			case pchan <- p:
+			case <-ctx.Done():
 			}
 		}
 	}
-	//return nil
+}
+
+// connectStream sends the request of a stream. A status of 400, 401, 403 or 404, which a restart would get
+// again, is returned as an *APIError, and so is the error of a request whose context is done. A network error
+// or any other status panics, for the stream to be autoRestarted. The errors are reported to the observer
+func connectStream(logger Logger, observer Observer, stream string, req *http.Request) (*http.Response, error) {
+	response, err := httpClient().Do(req)
+	if err == nil && response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		err = newAPIError(response.StatusCode, body)
+	}
+	if err != nil {
+		observer.ObserveStreamConnect(stream, err)
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && refused(apiErr.StatusCode) {
+			logger.Error("oanda stream refused", "stream", stream, "path", req.URL.Path, "error", err)
+			return nil, err
+		}
+		logger.Warn("oanda stream failed", "stream", stream, "path", req.URL.Path, "error", err)
+		panic("Connection on " + stream + " failed")
+	}
+	observer.ObserveStreamConnect(stream, nil)
+	logger.Info("oanda stream connected", "stream", stream, "path", req.URL.Path,
+		"status", response.StatusCode, "requestID", response.Header.Get("RequestID"))
+	return response, nil
+}
+
+// refused reports whether a stream answered with statusCode cannot connect by being restarted
+func refused(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return true
+	}
+	return false
 }
@@ -0,0 +1,230 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+	"github.com/burbru/goanda/oandatest"
+	"github.com/burbru/goanda/sim"
+)
+
+// streamObserver records the stream events
+type streamObserver struct {
+	api.NopObserver
+	mutex       sync.Mutex
+	connects    []error
+	disconnects []error
+}
+
+func (o *streamObserver) ObserveStreamConnect(stream string, err error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.connects = append(o.connects, err)
+}
+
+func (o *streamObserver) ObserveStreamDisconnect(stream string, err error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.disconnects = append(o.disconnects, err)
+}
+
+func (o *streamObserver) events() ([]error, []error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return append([]error(nil), o.connects...), append([]error(nil), o.disconnects...)
+}
+
+func accountConfig() sim.Config {
+	return sim.Config{Balance: 10000, Instruments: []models.Instrument{{Name: "EUR_USD", MarginRate: 0.02}}}
+}
+
+func eurusd(bid float64, ask float64) models.ClientPrice {
+	return models.ClientPrice{
+		Instrument: "EUR_USD",
+		Time:       time.Now().UTC(),
+		Bids:       []models.PriceBucket{{Price: bid, Liquidity: 1000000}},
+		Asks:       []models.PriceBucket{{Price: ask, Liquidity: 1000000}},
+	}
+}
+
+// waitFor polls condition until it is true, or fails the test after a second
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if condition() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestPricingStream(t *testing.T) {
+	server := oandatest.NewServer(oandatest.Config{Token: "token"})
+	defer server.Close()
+	ctx := server.Context()
+	streamApi := ctx.CreateStreamAPI()
+	observer := &streamObserver{}
+	streamApi.SetObserver(observer)
+
+	prices := make(chan models.ClientPrice, 10)
+	heartbeats := make(chan models.PricingHeartbeat, 10)
+	streamApi.StartPricingStream([]string{"EUR_USD"}, prices, heartbeats)
+	waitFor(t, "the stream", func() bool { n, _ := server.StreamCount(); return n == 1 })
+
+	// a malformed line is skipped
+	server.SendPricingLine("{not json")
+	server.SetPrice(eurusd(1.2, 1.2002))
+	server.SendHeartbeats()
+	select {
+	case price := <-prices:
+		if price.Instrument != "EUR_USD" || price.Bids[0].Price != 1.2 {
+			t.Errorf("price %+v", price)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no price")
+	}
+	select {
+	case <-heartbeats:
+	case <-time.After(time.Second):
+		t.Fatal("no heartbeat")
+	}
+	if len(prices) != 0 {
+		t.Errorf("%d unexpected prices", len(prices))
+	}
+
+	server.DisconnectStreams()
+	waitFor(t, "the disconnection", func() bool { _, disconnects := observer.events(); return len(disconnects) == 1 })
+	if connects, _ := observer.events(); len(connects) != 1 || connects[0] != nil {
+		t.Errorf("connects %v, want one successful", connects)
+	}
+}
+
+func TestStreamConnectStatus(t *testing.T) {
+	server := oandatest.NewServer(oandatest.Config{Token: "token"})
+	defer server.Close()
+	ctx := server.Context()
+	ctx.Token = "wrong"
+
+	streamApi := ctx.CreateStreamAPI()
+	observer := &streamObserver{}
+	streamApi.SetObserver(observer)
+	// the stream returns without reading the error body as prices
+	streamApi.PricingStream([]string{"EUR_USD"}, make(chan models.ClientPrice), make(chan models.PricingHeartbeat))
+
+	transactionStreamApi := ctx.CreateTransactionStreamAPI()
+	transactionStreamApi.SetObserver(observer)
+	transactionStreamApi.TransactionStream(make(chan models.Transaction), make(chan models.TransactionHeartbeat))
+
+	connects, disconnects := observer.events()
+	if len(connects) != 2 || len(disconnects) != 0 {
+		t.Fatalf("connects %v disconnects %v", connects, disconnects)
+	}
+	for _, err := range connects {
+		var apiErr *api.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != 401 {
+			t.Errorf("connect error %v, want HTTP 401", err)
+		}
+	}
+}
+
+func TestStreamConnectRestarted(t *testing.T) {
+	server := oandatest.NewServer(oandatest.Config{Token: "token"})
+	defer server.Close()
+	server.AddFault(oandatest.Fault{Path: "/pricing/stream", Status: http.StatusServiceUnavailable, Count: 1})
+	ctx := server.Context()
+	streamApi := ctx.CreateStreamAPI()
+	observer := &streamObserver{}
+	streamApi.SetObserver(observer)
+
+	// a 5xx panics for autoRestart to connect again
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("no panic on HTTP 503")
+			}
+		}()
+		streamApi.PricingStream([]string{"EUR_USD"}, make(chan models.ClientPrice), make(chan models.PricingHeartbeat))
+	}()
+	if connects, _ := observer.events(); len(connects) != 1 || connects[0] == nil {
+		t.Errorf("connects %v, want one failed", connects)
+	}
+}
+
+func TestStreamPricesRefused(t *testing.T) {
+	server := oandatest.NewServer(oandatest.Config{Token: "token"})
+	defer server.Close()
+	ctx := server.Context()
+	ctx.Token = "wrong"
+	streamApi := ctx.CreateStreamAPI()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- streamApi.StreamPrices([]string{"EUR_USD"}, func(models.ClientPrice) {}, nil)
+	}()
+	select {
+	case err := <-done:
+		var apiErr *api.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+			t.Errorf("error %v, want HTTP 401", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("StreamPrices did not return")
+	}
+}
+
+func TestPricingStreamContext(t *testing.T) {
+	server := oandatest.NewServer(oandatest.Config{Token: "token"})
+	defer server.Close()
+	ctx := server.Context()
+	streamApi := ctx.CreateStreamAPI()
+	observer := &streamObserver{}
+	streamApi.SetObserver(observer)
+
+	stream, cancel := context.WithCancel(context.Background())
+	// nothing reads the prices: the stream waits for pchan until it is stopped
+	streamApi.StartPricingStreamContext(stream, []string{"EUR_USD"}, make(chan models.ClientPrice), make(chan models.PricingHeartbeat))
+	waitFor(t, "the stream", func() bool { n, _ := server.StreamCount(); return n == 1 })
+	server.SetPrice(eurusd(1.2, 1.2002))
+
+	cancel()
+	waitFor(t, "the disconnection", func() bool { n, _ := server.StreamCount(); return n == 0 })
+	if connects, disconnects := observer.events(); len(connects) != 1 || len(disconnects) != 1 {
+		t.Errorf("connects %v disconnects %v, want the stream stopped without restart", connects, disconnects)
+	}
+}
+
+func TestTransactionStream(t *testing.T) {
+	server := oandatest.NewServer(oandatest.Config{Account: accountConfig()})
+	defer server.Close()
+	ctx := server.Context()
+	streamApi := ctx.CreateTransactionStreamAPI()
+
+	transactions := make(chan models.Transaction, 10)
+	heartbeats := make(chan models.TransactionHeartbeat, 10)
+	streamApi.StartTransactionStream(transactions, heartbeats)
+	waitFor(t, "the stream", func() bool { _, n := server.StreamCount(); return n == 1 })
+
+	server.SendTransactionLine("]")
+	server.SetPrice(eurusd(1.2, 1.2002))
+	if _, err := server.Account.CreateOrder(models.Order{Type: models.OrderTypeMarket, Instrument: "EUR_USD", Units: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for len(types) < 2 {
+		select {
+		case transaction := <-transactions:
+			types = append(types, transaction.Type)
+		case <-time.After(time.Second):
+			t.Fatalf("transactions %v, want the order and its fill", types)
+		}
+	}
+	if types[0] != "MARKET_ORDER" || types[1] != models.TransactionTypeOrderFill {
+		t.Errorf("transactions %v", types)
+	}
+}
@@ -3,8 +3,6 @@ package api
 import (
 	"bufio"
 	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
 	"time"
 
@@ -13,7 +11,8 @@ import (
 
 // StreamAPI is an api instance with a context to call endpoints
 type TransactionStreamAPI struct {
-	context Context
+	context  Context
+	observer Observer
 }
 
 type transactionProcessor func(p *models.Transaction)
@@ -23,56 +22,46 @@ type transactionHeartbeatProcessor func(p *models.TransactionHeartbeat)
 func (streamApi *TransactionStreamAPI) StartTransactionStream(tchan chan models.Transaction, hchan chan models.TransactionHeartbeat) {
 
 	// AutoRestart for TransactionStream
-	go autoRestart("TransactionStream", 0, func() { streamApi.TransactionStream(tchan, hchan) })
-
-	fmt.Println("Starting loop on Transactions")
-	// for {
-	// 	price := <-pchan
-	// 	tchan <- models.ClientPrice2Tick(&price)
-	// }
-}
-
-// AutoRestart for the PricingStream function as connection reset can result in panic
-func transactionStreamAutoRestart(name string, nPanics int64, f func()) {
-	defer func() {
-		if v := recover(); v != nil {
-			// A panic is detected.
-			log.Printf("%s is crashed. Panic #%d. Restarting in 5 seconds.", name, nPanics+1)
-			time.Sleep(5 * time.Second)
-			go transactionStreamAutoRestart(name, nPanics+1, f) // restart
-		}
-	}()
-	f()
+	go autoRestart(streamApi.context.logger(), "TransactionStream", 0, func() { streamApi.TransactionStream(tchan, hchan) })
 }
 
-// PricingStream starts a stream of prices
+// TransactionStream starts a stream of transactions. It returns when the server refuses the stream, and panics
+// when the connection fails or is lost
 func (streamApi *TransactionStreamAPI) TransactionStream(tchan chan models.Transaction, hchan chan models.TransactionHeartbeat) {
 
 	url := streamApi.context.StreamApiURL + "/v3/accounts/" + streamApi.context.Account + "/transactions/stream"
-	client := &http.Client{}
 	req, _ := http.NewRequest("GET", url, nil)
 	req.Header.Add("Authorization", "Bearer "+streamApi.context.Token)
-	response, err := client.Do(req)
+	logger := streamApi.context.logger()
+	observer := observerOrNop(streamApi.observer)
+	response, err := connectStream(logger, observer, "TransactionStream", req)
 	if err != nil {
-		fmt.Printf("The HTTP request failed with error %s\n", err)
-	} else {
-		reader := bufio.NewReader(response.Body)
-		for {
-			line, err := reader.ReadBytes('\n')
-			if err != nil {
-				log.Println(err)
-				panic("Connection on clientStream is lost")
-			}
-			var p models.Transaction
-			json.Unmarshal([]byte(line), &p)
-			if p.Type == "HEARTBEAT" {
-				var h models.TransactionHeartbeat
-				json.Unmarshal([]byte(line), &h)
-				hchan <- h
-			} else {
-				tchan <- p
-			}
+		return
+	}
+	reader := bufio.NewReader(response.Body)
+	lastHeartbeat := time.Now()
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			observer.ObserveStreamDisconnect("TransactionStream", err)
+			logger.Warn("oanda stream lost", "stream", "TransactionStream", "error", err)
+			panic("Connection on clientStream is lost")
+		}
+		var p models.Transaction
+		if err := json.Unmarshal(line, &p); err != nil {
+			logger.Warn("oanda stream line skipped", "stream", "TransactionStream", "error", err)
+			continue
+		}
+		if p.Type == "HEARTBEAT" {
+			var h models.TransactionHeartbeat
+			json.Unmarshal(line, &h)
+			now := time.Now()
+			observer.ObserveHeartbeat("TransactionStream", now.Sub(lastHeartbeat))
+			lastHeartbeat = now
+			hchan <- h
+		} else {
+			observer.ObserveBacklog("TransactionStream", len(tchan))
+			tchan <- p
 		}
 	}
-	//return nil
 }
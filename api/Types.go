@@ -1,5 +1,7 @@
 package api
 
+import "time"
+
 // The remote endpoints
 const (
 	API_URL_DEMO    = "https://api-fxpractice.oanda.com"
@@ -46,6 +48,55 @@ const (
 	M   Granularity = "M"
 )
 
+// Duration returns the length of a candle of the Granularity, months are approximated to 31 days
+func (g Granularity) Duration() time.Duration {
+	switch g {
+	case S5:
+		return 5 * time.Second
+	case S10:
+		return 10 * time.Second
+	case S15:
+		return 15 * time.Second
+	case S30:
+		return 30 * time.Second
+	case M1:
+		return time.Minute
+	case M2:
+		return 2 * time.Minute
+	case M4:
+		return 4 * time.Minute
+	case M5:
+		return 5 * time.Minute
+	case M10:
+		return 10 * time.Minute
+	case M15:
+		return 15 * time.Minute
+	case M30:
+		return 30 * time.Minute
+	case H1:
+		return time.Hour
+	case H2:
+		return 2 * time.Hour
+	case H3:
+		return 3 * time.Hour
+	case H4:
+		return 4 * time.Hour
+	case H6:
+		return 6 * time.Hour
+	case H8:
+		return 8 * time.Hour
+	case H12:
+		return 12 * time.Hour
+	case D:
+		return 24 * time.Hour
+	case W:
+		return 7 * 24 * time.Hour
+	case M:
+		return 31 * 24 * time.Hour
+	}
+	return 0
+}
+
 // CandlesRequest is a request to get candles
 type CandlesRequest struct {
 	api               *API
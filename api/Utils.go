@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -13,13 +14,13 @@ import (
 )
 
 var (
-	mutex   = sync.Mutex{}
-	client  = &http.Client{}
-	request = &http.Request{
+	mutex       = sync.Mutex{}
+	clientMutex = sync.Mutex{}
+	client      = &http.Client{Transport: NewTransport()}
+	request     = &http.Request{
 		Header: http.Header{},
 	}
-	lastRequestTime time.Time
-	rateLimit       = 1 * time.Millisecond
+	limiter = NewRateLimiter(DefaultRequestRate, DefaultRequestRate)
 )
 
 func SetHeader(key string, value string) {
@@ -41,10 +42,37 @@ func GetHeaderAsString() string {
 	return headersToString(request.Header.Clone())
 }
 
+// SetRateLimit sets a minimum gap between requests, it replaces the RateLimiter with a bucket of one token
 func SetRateLimit(limit time.Duration) {
+	SetRateLimiter(NewRateLimiter(float64(time.Second)/float64(limit), 1))
+}
+
+// SetRateLimiter sets the RateLimiter shared by all the REST calls
+func SetRateLimiter(l *RateLimiter) {
 	mutex.Lock()
 	defer mutex.Unlock()
-	rateLimit = limit
+	limiter = l
+}
+
+// RateLimitStats returns the metrics of the current RateLimiter
+func RateLimitStats() RateLimiterStats {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return limiter.Stats()
+}
+
+// SetHTTPClient sets the http client used by the REST calls and the streams, for instance to
+// record or replay the traffic with a custom Transport
+func SetHTTPClient(c *http.Client) {
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	client = c
+}
+
+func httpClient() *http.Client {
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	return client
 }
 
 func headersToString(header http.Header) string {
@@ -63,44 +91,90 @@ func ResetHeaders() {
 	request.Header = http.Header{}
 }
 
+// SendRequest sends a request with the headers set by SetToken and SetHeader, once a token of the RateLimiter
+// is available. A request answered by HTTP 429 pauses the other requests for the Retry-After delay, and
+// returns an *APIError with RetryAfter set, it is sent again by the RetryPolicy of an api instance only.
+// Status codes of 400 and above return the body with an *APIError
 func SendRequest(reqMethod string, reqUrl string, reqBody []byte) ([]byte, error) {
-	mutex.Lock()
-	defer mutex.Unlock()
+	return sendRequest(NopLogger{}, NopObserver{}, reqMethod, reqUrl, reqBody)
+}
 
-	// Calculate the time to wait based on the last request time.
-	timeSinceLastRequest := time.Since(lastRequestTime)
-	if timeSinceLastRequest < rateLimit {
-		timeToWait := rateLimit - timeSinceLastRequest
-		time.Sleep(timeToWait)
-	}
+// send sends a request as SendRequest, logging to the Logger of the context and reporting to the Observer
+func (api *API) send(reqMethod string, reqUrl string, reqBody []byte) ([]byte, error) {
+	return sendRequest(api.context.logger(), observerOrNop(api.observer), reqMethod, reqUrl, reqBody)
+}
 
-	request.Method = reqMethod
+func sendRequest(logger Logger, observer Observer, reqMethod string, reqUrl string, reqBody []byte) ([]byte, error) {
 	parsedURL, err := url.Parse(reqUrl)
 	if err != nil {
-		PrintWithColor("Error parsing url %s: %s\n", Red, reqUrl, err)
+		logger.Error("oanda request failed", "method", reqMethod, "path", reqUrl, "error", err)
 		return nil, err
 	}
-	request.URL = parsedURL
-	request.Body = io.NopCloser(bytes.NewReader(reqBody))
+	mutex.Lock()
+	header := request.Header.Clone()
+	rateLimiter := limiter
+	mutex.Unlock()
+	if reqBody != nil {
+		header.Set("Content-Type", "application/json")
+	}
+	endpoint := Endpoint(parsedURL.Path)
+	rateLimiter.Wait(context.Background())
 
-	// Update the last request time
-	lastRequestTime = time.Now()
+	var body io.Reader
+	if reqBody != nil {
+		body = bytes.NewReader(reqBody)
+	}
+	req, err := http.NewRequest(reqMethod, parsedURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
 
 	// Send the request
-	resp, err := client.Do(request)
-
+	start := time.Now()
+	resp, err := httpClient().Do(req)
 	if err != nil {
-		PrintWithColor("Error sending request to url %s: %s", Red, reqUrl, err)
+		latency := time.Since(start)
+		observer.ObserveRequest(reqMethod, endpoint, 0, latency, err)
+		logger.Error("oanda request failed", "method", reqMethod, "path", parsedURL.Path,
+			"latency", latency, "error", err)
 		return nil, err
 	}
-	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	latency := time.Since(start)
+	requestID := resp.Header.Get("RequestID")
 	if err != nil {
-		LogInColor("Error reading response body: %s\n%s", Red, err, string(respBody))
+		observer.ObserveRequest(reqMethod, endpoint, resp.StatusCode, latency, err)
+		logger.Error("oanda request failed", "method", reqMethod, "path", parsedURL.Path, "status", resp.StatusCode,
+			"latency", latency, "requestID", requestID, "error", err)
 		return nil, err
 	}
-
+	if resp.StatusCode == http.StatusTooManyRequests {
+		delay := retryAfter(resp.Header)
+		rateLimiter.Pause(delay)
+		apiErr := newAPIError(resp.StatusCode, respBody)
+		apiErr.RetryAfter = delay
+		observer.ObserveRequest(reqMethod, endpoint, resp.StatusCode, latency, apiErr)
+		logger.Warn("oanda request throttled", "method", reqMethod, "path", parsedURL.Path, "status", resp.StatusCode,
+			"latency", latency, "requestID", requestID, "retryAfter", delay)
+		return respBody, apiErr
+	}
+	if resp.StatusCode >= 400 {
+		apiErr := newAPIError(resp.StatusCode, respBody)
+		observer.ObserveRequest(reqMethod, endpoint, resp.StatusCode, latency, apiErr)
+		log := logger.Warn
+		if resp.StatusCode >= 500 {
+			log = logger.Error
+		}
+		log("oanda request failed", "method", reqMethod, "path", parsedURL.Path, "status", resp.StatusCode,
+			"latency", latency, "requestID", requestID, "error", apiErr)
+		return respBody, apiErr
+	}
+	observer.ObserveRequest(reqMethod, endpoint, resp.StatusCode, latency, nil)
+	logger.Debug("oanda request", "method", reqMethod, "path", parsedURL.Path, "status", resp.StatusCode,
+		"latency", latency, "requestID", requestID)
 	return respBody, nil
 }
 
@@ -145,5 +219,5 @@ func LogInColor(format string, color Color, args ...interface{}) {
 	message := fmt.Sprintf(format, args...)
 
 	coloredMessage := ColorizeText(message, color)
-	fmt.Printf("%s %s\n", time.Now().Format("2001-02-03 13:14:15"), coloredMessage)
+	fmt.Printf("%s %s\n", time.Now().Format("2006-01-02 15:04:05"), coloredMessage)
 }
@@ -0,0 +1,115 @@
+package backtest
+
+import (
+	"time"
+
+	"github.com/burbru/goanda/models"
+	"github.com/burbru/goanda/sim"
+)
+
+// Strategy is implemented by the strategies replayed by a Backtest,
+// the callbacks mirror the price and heartbeat channels of PricingStream
+type Strategy interface {
+	OnPrice(account *sim.Account, price *models.ClientPrice)
+	OnHeartbeat(account *sim.Account, heartbeat *models.PricingHeartbeat)
+}
+
+// EquityPoint is the state of the account after a price
+type EquityPoint struct {
+	Time         time.Time
+	Balance      float64
+	NAV          float64
+	UnrealizedPL float64
+	MarginUsed   float64
+}
+
+// Result is the outcome of a Backtest
+type Result struct {
+	Summary      models.AccountSummary
+	Trades       []models.Trade
+	OpenTrades   []models.Trade
+	Transactions []models.Transaction
+	Equity       []EquityPoint
+}
+
+// Backtest replays prices through a Strategy trading a simulated account
+type Backtest struct {
+	Account  *sim.Account
+	strategy Strategy
+	// HeartbeatInterval is the gap without prices after which a heartbeat is sent, 5 seconds as the stream
+	HeartbeatInterval time.Duration
+	equity            []EquityPoint
+}
+
+// New creates a Backtest of strategy on an account created from config
+func New(config sim.Config, strategy Strategy) *Backtest {
+	return &Backtest{
+		Account:           sim.NewAccount(config),
+		strategy:          strategy,
+		HeartbeatInterval: 5 * time.Second,
+	}
+}
+
+// RunCandles replays candles of one or more instruments, see CandlesToPrices
+func (b *Backtest) RunCandles(candles ...*models.Candles) Result {
+	var prices []models.ClientPrice
+	for _, c := range candles {
+		prices = append(prices, CandlesToPrices(c)...)
+	}
+	sortPrices(prices)
+	return b.Run(prices)
+}
+
+// RunTicks replays recorded ticks of one or more instruments
+func (b *Backtest) RunTicks(ticks []models.Tick) Result {
+	prices := TicksToPrices(ticks)
+	sortPrices(prices)
+	return b.Run(prices)
+}
+
+// Run replays prices ordered by time: each price first triggers the pending orders of the account,
+// then is given to the strategy. A single heartbeat is sent for each gap longer than HeartbeatInterval
+func (b *Backtest) Run(prices []models.ClientPrice) Result {
+	var last time.Time
+	for i := range prices {
+		price := &prices[i]
+		if !last.IsZero() && b.HeartbeatInterval > 0 && price.Time.Sub(last) > b.HeartbeatInterval {
+			heartbeat := models.PricingHeartbeat{Type: "HEARTBEAT", Time: last.Add(b.HeartbeatInterval)}
+			b.strategy.OnHeartbeat(b.Account, &heartbeat)
+		}
+		last = price.Time
+
+		b.Account.Update(price)
+		b.strategy.OnPrice(b.Account, price)
+		b.recordEquity(price.Time)
+	}
+	return b.Result()
+}
+
+// Result returns the trade log, transactions and equity curve of the prices replayed so far
+func (b *Backtest) Result() Result {
+	return Result{
+		Summary:      b.Account.Summary(),
+		Trades:       b.Account.ClosedTrades(),
+		OpenTrades:   b.Account.OpenTrades(),
+		Transactions: b.Account.Transactions(),
+		Equity:       append([]EquityPoint(nil), b.equity...),
+	}
+}
+
+// recordEquity adds a point to the equity curve, replacing the last one when at the same time
+func (b *Backtest) recordEquity(t time.Time) {
+	summary := b.Account.Summary()
+	point := EquityPoint{
+		Time:         t,
+		Balance:      summary.Balance,
+		NAV:          summary.NAV,
+		UnrealizedPL: summary.UnrealizedPL,
+		MarginUsed:   summary.MarginUsed,
+	}
+	if n := len(b.equity); n > 0 && b.equity[n-1].Time.Equal(t) {
+		b.equity[n-1] = point
+		return
+	}
+	b.equity = append(b.equity, point)
+}
@@ -0,0 +1,69 @@
+package backtest
+
+import (
+	"sort"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+)
+
+// CandlesToPrices converts complete candles to prices, four per candle: open, low, high and close
+// for a rising candle, open, high, low and close for a falling one, spread over the candle duration.
+// The bid and ask components are used when present, the mid component otherwise. The candles missing
+// a side and the mid component, as fetched with price=B or price=A only, are skipped
+func CandlesToPrices(candles *models.Candles) []models.ClientPrice {
+	duration := api.Granularity(candles.Granularity).Duration()
+	prices := make([]models.ClientPrice, 0, 4*len(candles.Candles))
+	for _, candle := range candles.Candles {
+		if !candle.Complete {
+			continue
+		}
+		bid, ask := candle.Bid, candle.Ask
+		if bid == (models.CandleStickData{}) {
+			bid = candle.Mid
+		}
+		if ask == (models.CandleStickData{}) {
+			ask = candle.Mid
+		}
+		if bid == (models.CandleStickData{}) || ask == (models.CandleStickData{}) {
+			continue
+		}
+		path := [][2]float64{{bid.O, ask.O}, {bid.L, ask.L}, {bid.H, ask.H}, {bid.C, ask.C}}
+		if bid.C+ask.C < bid.O+ask.O {
+			path[1], path[2] = path[2], path[1]
+		}
+		for i, point := range path {
+			prices = append(prices, models.ClientPrice{
+				Instrument: candles.Instrument,
+				Type:       "PRICE",
+				Time:       candle.Time.Add(duration * time.Duration(i) / 4),
+				Bids:       []models.PriceBucket{{Price: point[0]}},
+				Asks:       []models.PriceBucket{{Price: point[1]}},
+			})
+		}
+	}
+	return prices
+}
+
+// TicksToPrices converts ticks to prices with a single level of bid and ask
+func TicksToPrices(ticks []models.Tick) []models.ClientPrice {
+	prices := make([]models.ClientPrice, 0, len(ticks))
+	for _, tick := range ticks {
+		prices = append(prices, models.ClientPrice{
+			Instrument: tick.Instrument,
+			Type:       "PRICE",
+			Time:       tick.Time,
+			Bids:       []models.PriceBucket{{Price: tick.Bid}},
+			Asks:       []models.PriceBucket{{Price: tick.Ask}},
+		})
+	}
+	return prices
+}
+
+// sortPrices sorts prices of several instruments by time, keeping the order of prices at the same time
+func sortPrices(prices []models.ClientPrice) {
+	sort.SliceStable(prices, func(i, j int) bool {
+		return prices[i].Time.Before(prices[j].Time)
+	})
+}
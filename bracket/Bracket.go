@@ -0,0 +1,75 @@
+// Package bracket places entry orders with their take profit, stop loss and trailing stop loss attached,
+// and manages one-cancels-other pairs of orders on the client side
+package bracket
+
+import (
+	"errors"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+)
+
+// Bracket is the take profit, stop loss and trailing stop loss created by OANDA when an entry order is
+// filled, the zero values are not created
+type Bracket struct {
+	// TakeProfit is the price of the take profit
+	TakeProfit float64
+	// StopLoss is the price of the stop loss, StopLossDistance its distance from the fill price
+	StopLoss         float64
+	StopLossDistance float64
+	// TrailingStopDistance is the distance of the trailing stop loss
+	TrailingStopDistance float64
+	// TimeInForce of the orders, GTC if empty
+	TimeInForce string
+}
+
+// Attach returns the order with the bracket attached as on fill orders. The take profit and the stop loss
+// are checked against the price of the entry orders, and against each other for the market orders
+func (b Bracket) Attach(order models.Order) (models.Order, error) {
+	if order.Units == 0 {
+		return order, errors.New("bracket: order without units")
+	}
+	if b.StopLoss != 0 && b.StopLossDistance != 0 {
+		return order, errors.New("bracket: both a stop loss price and distance")
+	}
+	if b.StopLoss < 0 || b.StopLossDistance < 0 || b.TakeProfit < 0 || b.TrailingStopDistance < 0 {
+		return order, errors.New("bracket: negative price or distance")
+	}
+	long := order.Units > 0
+	// the fill price of a market order is not known, its take profit must still be on the other side
+	// of its stop loss
+	reference := order.Price
+	if b.TakeProfit != 0 && b.StopLoss != 0 && (b.TakeProfit > b.StopLoss) != long {
+		return order, errors.New("bracket: take profit on the wrong side of the stop loss")
+	}
+	if reference != 0 && b.TakeProfit != 0 && (b.TakeProfit > reference) != long {
+		return order, errors.New("bracket: take profit on the wrong side of the entry price")
+	}
+	if reference != 0 && b.StopLoss != 0 && (b.StopLoss < reference) != long {
+		return order, errors.New("bracket: stop loss on the wrong side of the entry price")
+	}
+
+	timeInForce := b.TimeInForce
+	if timeInForce == "" {
+		timeInForce = models.TimeInForceGTC
+	}
+	if b.TakeProfit != 0 {
+		order.TakeProfitOnFill = &models.TakeProfitDetails{Price: b.TakeProfit, TimeInForce: timeInForce}
+	}
+	if b.StopLoss != 0 || b.StopLossDistance != 0 {
+		order.StopLossOnFill = &models.StopLossDetails{Price: b.StopLoss, Distance: b.StopLossDistance, TimeInForce: timeInForce}
+	}
+	if b.TrailingStopDistance != 0 {
+		order.TrailingStopLossOnFill = &models.TrailingStopLossDetails{Distance: b.TrailingStopDistance, TimeInForce: timeInForce}
+	}
+	return order, nil
+}
+
+// Place attaches a bracket to an entry order and sends it to a broker
+func Place(broker api.Broker, order models.Order, bracket Bracket) (*models.OrderCreateResponse, error) {
+	order, err := bracket.Attach(order)
+	if err != nil {
+		return nil, err
+	}
+	return broker.CreateOrder(order)
+}
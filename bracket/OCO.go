@@ -0,0 +1,461 @@
+package bracket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+)
+
+// ErrNoOrderGetter is returned by Resync when the broker cannot get orders
+var ErrNoOrderGetter = errors.New("bracket: the broker cannot get orders")
+
+// OrderGetter gets an order by ID or by @clientID, it is implemented by api.API and paper.Broker
+type OrderGetter interface {
+	GetOrder(orderID string) (*models.Order, error)
+}
+
+// TransactionSource starts a transaction stream, it is implemented by api.TransactionStreamAPI and paper.Broker
+type TransactionSource interface {
+	StartTransactionStream(tchan chan models.Transaction, hchan chan models.TransactionHeartbeat)
+}
+
+// TransactionStopper stops the transaction streams sending to a channel, it is implemented by paper.Broker
+type TransactionStopper interface {
+	StopTransactionStream(tchan chan models.Transaction)
+}
+
+// Leg is an order of a Pair, identified by its client ID which is known before the order is sent
+type Leg struct {
+	ClientID string `json:"clientID"`
+	OrderID  string `json:"orderID,omitempty"`
+}
+
+// Pair is a one-cancels-other pair of orders: when one is filled, the other is cancelled
+type Pair struct {
+	ID   string `json:"id"`
+	Legs [2]Leg `json:"legs"`
+	// Filled is the client ID of the leg filled, empty while none is
+	Filled string `json:"filled,omitempty"`
+
+	placing    bool
+	cancelling bool
+}
+
+// Done is the end of a Pair: a leg was filled and the other cancelled, or a leg was cancelled or
+// rejected without fill and the other left pending
+type Done struct {
+	Pair Pair
+	// Cancelled is the client ID of the leg cancelled by the OCO manager, empty if none
+	Cancelled string
+	// Err is the error of the cancellation when the leg was not found, it may have been filled too
+	Err error
+}
+
+// OCOConfig is the configuration of an OCO manager
+type OCOConfig struct {
+	// Path is the JSON file of the pairs, loaded by NewOCO and saved after each change.
+	// The pairs are not persisted if empty
+	Path string
+	// Logger logs the failed cancellations and saves, they are discarded if nil
+	Logger api.Logger
+}
+
+// OCO manages one-cancels-other pairs on the client side: it follows the transactions of the account and
+// cancels the sibling of a filled order. The pairs are persisted, and Resync catches up with the fills
+// and cancellations missed while the process was stopped. It is safe for concurrent use
+type OCO struct {
+	broker api.Broker
+	config OCOConfig
+	logger api.Logger
+
+	mutex sync.Mutex
+	pairs map[string]*Pair
+
+	listenersMutex sync.Mutex
+	listeners      []func(Done)
+}
+
+// NewOCO creates an OCO manager sending the orders and cancellations to broker, with the pairs
+// saved in config.Path
+func NewOCO(broker api.Broker, config OCOConfig) (*OCO, error) {
+	o := &OCO{broker: broker, config: config, logger: config.Logger, pairs: make(map[string]*Pair)}
+	if o.logger == nil {
+		o.logger = api.NopLogger{}
+	}
+	if config.Path == "" {
+		return o, nil
+	}
+	data, err := os.ReadFile(config.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pairs []Pair
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return nil, err
+	}
+	for i := range pairs {
+		o.pairs[pairs[i].ID] = &pairs[i]
+	}
+	return o, nil
+}
+
+// OnDone registers a listener called when a pair is done, outside of the lock of the manager
+func (o *OCO) OnDone(f func(Done)) {
+	o.listenersMutex.Lock()
+	defer o.listenersMutex.Unlock()
+	o.listeners = append(o.listeners, f)
+}
+
+// Place sends two orders as a pair, the client IDs missing are assigned. When the second order fails the
+// first one is cancelled. A fill of the first order before the second is sent ends the pair: the second
+// order is not sent and the pair is returned with Filled set
+func (o *OCO) Place(first models.Order, second models.Order) (Pair, error) {
+	first, second = withClientID(first), withClientID(second)
+	pair := &Pair{
+		ID:      first.ClientExtensions.ID,
+		Legs:    [2]Leg{{ClientID: first.ClientExtensions.ID}, {ClientID: second.ClientExtensions.ID}},
+		placing: true,
+	}
+	// the pair is known before the orders are sent, so that their fills are matched
+	o.mutex.Lock()
+	o.pairs[pair.ID] = pair
+	o.save()
+	o.mutex.Unlock()
+
+	response, err := o.broker.CreateOrder(first)
+	if err != nil {
+		o.remove(pair)
+		return *pair, err
+	}
+	if response.OrderCancelTransaction != nil {
+		o.remove(pair)
+		return *pair, errors.New("bracket: first order cancelled: " + response.OrderCancelTransaction.Reason)
+	}
+	o.mutex.Lock()
+	pair.Legs[0].OrderID = orderID(response)
+	if response.OrderFillTransaction != nil {
+		pair.Filled = pair.Legs[0].ClientID
+	}
+	// a fill set by the response or by HandleTransaction is checked under the lock, right before
+	// the second order is sent
+	filled := pair.Filled != ""
+	o.mutex.Unlock()
+	if filled {
+		o.remove(pair)
+		return *pair, nil
+	}
+	response, err = o.broker.CreateOrder(second)
+	if err == nil && response.OrderCancelTransaction != nil {
+		err = errors.New("bracket: second order cancelled: " + response.OrderCancelTransaction.Reason)
+	}
+	if err != nil {
+		o.remove(pair)
+		if _, cancelErr := o.broker.CancelOrder("@" + pair.Legs[0].ClientID); cancelErr != nil {
+			o.logger.Error("oco first order not cancelled", "pair", pair.ID, "error", cancelErr)
+		}
+		return *pair, err
+	}
+	o.mutex.Lock()
+	pair.Legs[1].OrderID = orderID(response)
+	if response.OrderFillTransaction != nil && pair.Filled == "" {
+		pair.Filled = pair.Legs[1].ClientID
+	}
+	pair.placing = false
+	o.save()
+	placed := *pair
+	o.mutex.Unlock()
+	if placed.Filled != "" {
+		o.cancelSibling(pair)
+	}
+	return placed, nil
+}
+
+// HandleTransaction cancels the sibling of an order filled by a transaction, and forgets the pairs of the
+// orders cancelled
+func (o *OCO) HandleTransaction(transaction models.Transaction) {
+	if transaction.Type != models.TransactionTypeOrderFill && transaction.Type != models.TransactionTypeOrderCancel {
+		return
+	}
+	o.mutex.Lock()
+	pair, leg := o.find(transaction.OrderID, transaction.ClientOrderID)
+	if pair == nil || pair.Filled != "" {
+		o.mutex.Unlock()
+		return
+	}
+	if transaction.Type == models.TransactionTypeOrderCancel {
+		if pair.placing {
+			o.mutex.Unlock()
+			return
+		}
+		delete(o.pairs, pair.ID)
+		o.save()
+		o.mutex.Unlock()
+		o.notify(Done{Pair: *pair})
+		return
+	}
+	pair.Filled = pair.Legs[leg].ClientID
+	placing := pair.placing
+	o.save()
+	o.mutex.Unlock()
+	// Place cancels the sibling once it is sent
+	if !placing {
+		o.cancelSibling(pair)
+	}
+}
+
+// Resync gets the orders of the pairs from the broker, to apply the fills and cancellations missed
+// while the transactions were not followed, such as after a restart. The siblings of the pairs already
+// filled, whose cancellation failed or was interrupted, are cancelled again. The pairs whose orders
+// cannot be got are kept, the first error is returned
+func (o *OCO) Resync() error {
+	getter, ok := o.broker.(OrderGetter)
+	if !ok {
+		return ErrNoOrderGetter
+	}
+	var firstErr error
+	for _, pair := range o.Pairs() {
+		if pair.Filled != "" {
+			o.mutex.Lock()
+			current, ok := o.pairs[pair.ID]
+			o.mutex.Unlock()
+			if ok {
+				o.cancelSibling(current)
+			}
+			continue
+		}
+		var states [2]string
+		var err error
+		unsent := -1
+		for i, leg := range pair.Legs {
+			var order *models.Order
+			if order, err = getter.GetOrder("@" + leg.ClientID); err != nil {
+				var apiErr *api.APIError
+				if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
+					// a leg never sent, as when the process stopped while placing the pair
+					unsent, err = i, nil
+				}
+				break
+			}
+			states[i] = order.State
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		o.mutex.Lock()
+		current, ok := o.pairs[pair.ID]
+		if !ok || current.placing {
+			o.mutex.Unlock()
+			continue
+		}
+		if unsent >= 0 {
+			o.mutex.Unlock()
+			o.unpaired(current, unsent, states[0])
+			continue
+		}
+		filled := -1
+		for i, state := range states {
+			if state == models.OrderStateFilled || state == models.OrderStateTriggered {
+				filled = i
+			}
+		}
+		switch {
+		case filled >= 0 && current.Filled == "":
+			current.Filled = current.Legs[filled].ClientID
+			o.save()
+			o.mutex.Unlock()
+			o.cancelSibling(current)
+		case current.Filled == "" && (states[0] == models.OrderStateCancelled || states[1] == models.OrderStateCancelled):
+			delete(o.pairs, current.ID)
+			o.save()
+			o.mutex.Unlock()
+			o.notify(Done{Pair: *current})
+		default:
+			o.mutex.Unlock()
+		}
+	}
+	return firstErr
+}
+
+// Run resyncs the pairs when the broker can get orders, then follows the transactions of source until ctx
+// is done. The stream is stopped when Run returns if source is a TransactionStopper, the streams of the
+// api cannot be
+func (o *OCO) Run(ctx context.Context, source TransactionSource) error {
+	if err := o.Resync(); err != nil && err != ErrNoOrderGetter {
+		return err
+	}
+	transactions := make(chan models.Transaction, 100)
+	heartbeats := make(chan models.TransactionHeartbeat, 10)
+	source.StartTransactionStream(transactions, heartbeats)
+	if stopper, ok := source.(TransactionStopper); ok {
+		defer stopper.StopTransactionStream(transactions)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case transaction := <-transactions:
+			o.HandleTransaction(transaction)
+		case <-heartbeats:
+		}
+	}
+}
+
+// Pairs returns the pairs managed, sorted by ID
+func (o *OCO) Pairs() []Pair {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	pairs := make([]Pair, 0, len(o.pairs))
+	for _, pair := range o.pairs {
+		pairs = append(pairs, *pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].ID < pairs[j].ID })
+	return pairs
+}
+
+// cancelSibling cancels the leg of a filled pair which was not filled, and forgets the pair once the leg is
+// cancelled or not found. The pair is kept when the cancellation fails, for Resync to cancel it again
+func (o *OCO) cancelSibling(pair *Pair) {
+	o.mutex.Lock()
+	if _, ok := o.pairs[pair.ID]; !ok || pair.placing || pair.cancelling {
+		// done or being cancelled by a concurrent call
+		o.mutex.Unlock()
+		return
+	}
+	pair.cancelling = true
+	sibling := pair.Legs[0]
+	if pair.Filled == sibling.ClientID {
+		sibling = pair.Legs[1]
+	}
+	o.mutex.Unlock()
+
+	done := Done{Pair: *pair, Cancelled: sibling.ClientID}
+	if _, err := o.broker.CancelOrder("@" + sibling.ClientID); err != nil {
+		var apiErr *api.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != 404 {
+			o.logger.Error("oco sibling not cancelled", "pair", pair.ID, "error", err)
+			o.mutex.Lock()
+			pair.cancelling = false
+			o.mutex.Unlock()
+			return
+		}
+		done.Err = fmt.Errorf("bracket: sibling %s of %s not cancelled: %v", sibling.ClientID, pair.Filled, err)
+		o.logger.Error("oco sibling not found", "pair", pair.ID, "error", err)
+	}
+	o.mutex.Lock()
+	delete(o.pairs, pair.ID)
+	o.save()
+	o.mutex.Unlock()
+	o.notify(done)
+}
+
+// unpaired forgets a pair whose leg unsent was never sent. When the first leg was sent and is pending, it is
+// cancelled as Place does when the second order fails
+func (o *OCO) unpaired(pair *Pair, unsent int, firstState string) {
+	o.mutex.Lock()
+	if _, ok := o.pairs[pair.ID]; !ok {
+		o.mutex.Unlock()
+		return
+	}
+	delete(o.pairs, pair.ID)
+	o.save()
+	first := pair.Legs[0].ClientID
+	if unsent == 1 && pair.Filled == "" && (firstState == models.OrderStateFilled || firstState == models.OrderStateTriggered) {
+		pair.Filled = first
+	}
+	done := Done{Pair: *pair}
+	o.mutex.Unlock()
+
+	if unsent == 1 && firstState == models.OrderStatePending {
+		done.Cancelled = first
+		if _, err := o.broker.CancelOrder("@" + first); err != nil {
+			done.Err = fmt.Errorf("bracket: unpaired %s not cancelled: %v", first, err)
+			o.logger.Error("oco unpaired order not cancelled", "pair", pair.ID, "error", err)
+		}
+	}
+	o.notify(done)
+}
+
+func (o *OCO) remove(pair *Pair) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	delete(o.pairs, pair.ID)
+	o.save()
+}
+
+// find returns the pair of an order and the index of its leg
+func (o *OCO) find(orderID string, clientID string) (*Pair, int) {
+	for _, pair := range o.pairs {
+		for i, leg := range pair.Legs {
+			if (clientID != "" && leg.ClientID == clientID) || (orderID != "" && leg.OrderID == orderID) {
+				return pair, i
+			}
+		}
+	}
+	return nil, 0
+}
+
+// save writes the pairs to a temporary file renamed over the previous one, it is called with the lock held
+func (o *OCO) save() {
+	if o.config.Path == "" {
+		return
+	}
+	pairs := make([]Pair, 0, len(o.pairs))
+	for _, pair := range o.pairs {
+		pairs = append(pairs, *pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].ID < pairs[j].ID })
+	data, err := json.Marshal(pairs)
+	if err == nil {
+		err = os.WriteFile(o.config.Path+".tmp", data, 0600)
+	}
+	if err == nil {
+		err = os.Rename(o.config.Path+".tmp", o.config.Path)
+	}
+	if err != nil {
+		o.logger.Error("oco pairs not saved", "path", o.config.Path, "error", err)
+	}
+}
+
+func (o *OCO) notify(done Done) {
+	o.listenersMutex.Lock()
+	listeners := make([]func(Done), len(o.listeners))
+	copy(listeners, o.listeners)
+	o.listenersMutex.Unlock()
+	for _, f := range listeners {
+		f(done)
+	}
+}
+
+// withClientID returns the order with a client ID, a copy of its ClientExtensions is made when one is assigned
+func withClientID(order models.Order) models.Order {
+	if order.ClientExtensions != nil && order.ClientExtensions.ID != "" {
+		return order
+	}
+	extensions := models.ClientExtensions{}
+	if order.ClientExtensions != nil {
+		extensions = *order.ClientExtensions
+	}
+	extensions.ID = api.NewClientID()
+	order.ClientExtensions = &extensions
+	return order
+}
+
+func orderID(response *models.OrderCreateResponse) string {
+	if response == nil || response.OrderCreateTransaction == nil {
+		return ""
+	}
+	return response.OrderCreateTransaction.ID
+}
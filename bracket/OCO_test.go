@@ -0,0 +1,235 @@
+package bracket
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/burbru/goanda/models"
+	"github.com/burbru/goanda/paper"
+	"github.com/burbru/goanda/sim"
+)
+
+func newBroker() *paper.Broker {
+	broker := paper.NewBroker(sim.Config{
+		Balance:     10000,
+		Instruments: []models.Instrument{{Name: "EUR_USD", MarginRate: 0.02}},
+	})
+	setPrice(broker, 1.2000)
+	return broker
+}
+
+func setPrice(broker *paper.Broker, mid float64) {
+	broker.Update(&models.ClientPrice{
+		Instrument: "EUR_USD",
+		Time:       time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC),
+		Bids:       []models.PriceBucket{{Price: mid - 0.0001, Liquidity: 1000000}},
+		Asks:       []models.PriceBucket{{Price: mid + 0.0001, Liquidity: 1000000}},
+	})
+}
+
+// failingBroker fails the cancellations while fail is set
+type failingBroker struct {
+	*paper.Broker
+	fail bool
+}
+
+func (b *failingBroker) CancelOrder(orderID string) (*models.Transaction, error) {
+	if b.fail {
+		return nil, errors.New("connection reset")
+	}
+	return b.Broker.CancelOrder(orderID)
+}
+
+func entry(clientID string, orderType string, units int64, price float64) models.Order {
+	return models.Order{
+		Type: orderType, Instrument: "EUR_USD", Units: units, Price: price,
+		ClientExtensions: &models.ClientExtensions{ID: clientID},
+	}
+}
+
+func tempPath(t *testing.T) (string, func()) {
+	dir, err := os.MkdirTemp("", "oco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "pairs.json"), func() { os.RemoveAll(dir) }
+}
+
+func TestOCOCancelsSibling(t *testing.T) {
+	broker := newBroker()
+	oco, err := NewOCO(broker, OCOConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dones []Done
+	oco.OnDone(func(done Done) { dones = append(dones, done) })
+
+	pair, err := oco.Place(entry("buy", models.OrderTypeStop, 1000, 1.2050), entry("sell", models.OrderTypeStop, -1000, 1.1950))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.Legs[0].OrderID == "" || pair.Legs[1].OrderID == "" || pair.Filled != "" {
+		t.Fatalf("pair %+v", pair)
+	}
+
+	from := broker.Account.Summary().LastTransactionID
+	setPrice(broker, 1.2060)
+	for _, transaction := range broker.Account.TransactionsSince(from) {
+		oco.HandleTransaction(transaction)
+	}
+
+	if len(dones) != 1 || dones[0].Cancelled != "sell" || dones[0].Err != nil || dones[0].Pair.Filled != "buy" {
+		t.Fatalf("dones %+v", dones)
+	}
+	if order, _ := broker.GetOrder("@sell"); order.State != models.OrderStateCancelled {
+		t.Errorf("sibling %s, want cancelled", order.State)
+	}
+	if len(oco.Pairs()) != 0 {
+		t.Errorf("pairs %+v, want none", oco.Pairs())
+	}
+}
+
+func TestOCOResyncAfterRestart(t *testing.T) {
+	path, remove := tempPath(t)
+	defer remove()
+	broker := newBroker()
+	oco, err := NewOCO(broker, OCOConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := oco.Place(entry("buy", models.OrderTypeStop, 1000, 1.2050), entry("sell", models.OrderTypeStop, -1000, 1.1950)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the fill happens while the process is stopped
+	setPrice(broker, 1.1940)
+	restarted, err := NewOCO(broker, OCOConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dones []Done
+	restarted.OnDone(func(done Done) { dones = append(dones, done) })
+	if err := restarted.Resync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dones) != 1 || dones[0].Cancelled != "buy" || dones[0].Pair.Filled != "sell" {
+		t.Fatalf("dones %+v", dones)
+	}
+	if order, _ := broker.GetOrder("@buy"); order.State != models.OrderStateCancelled {
+		t.Errorf("sibling %s, want cancelled", order.State)
+	}
+}
+
+func TestOCOResyncCancelsUnpairedLeg(t *testing.T) {
+	path, remove := tempPath(t)
+	defer remove()
+	broker := newBroker()
+	if _, err := broker.CreateOrder(entry("buy", models.OrderTypeStop, 1000, 1.2050)); err != nil {
+		t.Fatal(err)
+	}
+	// the process stopped while placing the pair: the second leg was never sent
+	data, _ := json.Marshal([]Pair{{ID: "buy", Legs: [2]Leg{{ClientID: "buy"}, {ClientID: "sell"}}}})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	oco, err := NewOCO(broker, OCOConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dones []Done
+	oco.OnDone(func(done Done) { dones = append(dones, done) })
+	if err := oco.Resync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dones) != 1 || dones[0].Cancelled != "buy" || dones[0].Err != nil {
+		t.Fatalf("dones %+v", dones)
+	}
+	if order, _ := broker.GetOrder("@buy"); order.State != models.OrderStateCancelled {
+		t.Errorf("unpaired leg %s, want cancelled", order.State)
+	}
+	if len(oco.Pairs()) != 0 {
+		t.Errorf("pairs %+v, want none", oco.Pairs())
+	}
+}
+
+func TestOCOResyncCancelsSiblingOfFilledPair(t *testing.T) {
+	path, remove := tempPath(t)
+	defer remove()
+	broker := newBroker()
+	for _, order := range []models.Order{entry("buy", models.OrderTypeStop, 1000, 1.2050), entry("sell", models.OrderTypeStop, -1000, 1.1950)} {
+		if _, err := broker.CreateOrder(order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the process stopped after saving the fill, before cancelling the sibling
+	data, _ := json.Marshal([]Pair{{ID: "buy", Legs: [2]Leg{{ClientID: "buy"}, {ClientID: "sell"}}, Filled: "buy"}})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	oco, err := NewOCO(broker, OCOConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dones []Done
+	oco.OnDone(func(done Done) { dones = append(dones, done) })
+	if err := oco.Resync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dones) != 1 || dones[0].Cancelled != "sell" || dones[0].Err != nil {
+		t.Fatalf("dones %+v", dones)
+	}
+	if order, _ := broker.GetOrder("@sell"); order.State != models.OrderStateCancelled {
+		t.Errorf("sibling %s, want cancelled", order.State)
+	}
+}
+
+func TestOCOKeepsPairWhenCancelFails(t *testing.T) {
+	path, remove := tempPath(t)
+	defer remove()
+	broker := &failingBroker{Broker: newBroker()}
+	oco, err := NewOCO(broker, OCOConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dones []Done
+	oco.OnDone(func(done Done) { dones = append(dones, done) })
+	if _, err := oco.Place(entry("buy", models.OrderTypeStop, 1000, 1.2050), entry("sell", models.OrderTypeStop, -1000, 1.1950)); err != nil {
+		t.Fatal(err)
+	}
+
+	broker.fail = true
+	from := broker.Account.Summary().LastTransactionID
+	setPrice(broker.Broker, 1.2060)
+	for _, transaction := range broker.Account.TransactionsSince(from) {
+		oco.HandleTransaction(transaction)
+	}
+	// the pair is kept with its fill, in memory and on disk
+	if pairs := oco.Pairs(); len(dones) != 0 || len(pairs) != 1 || pairs[0].Filled != "buy" {
+		t.Fatalf("dones %+v pairs %+v, want the pair kept", dones, pairs)
+	}
+
+	broker.fail = false
+	restarted, err := NewOCO(broker, OCOConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.OnDone(func(done Done) { dones = append(dones, done) })
+	if err := restarted.Resync(); err != nil {
+		t.Fatal(err)
+	}
+	if len(dones) != 1 || dones[0].Cancelled != "sell" || dones[0].Err != nil {
+		t.Fatalf("dones %+v", dones)
+	}
+	if order, _ := broker.GetOrder("@sell"); order.State != models.OrderStateCancelled {
+		t.Errorf("sibling %s, want cancelled", order.State)
+	}
+}
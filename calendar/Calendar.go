@@ -0,0 +1,409 @@
+// Package calendar knows when the instruments can be traded: the weekly sessions in New York time by
+// instrument type or by instrument, and the holiday closures. It finds the next open and close, and
+// aligns the times to the candles of OANDA, which start at the 17:00 New York rollover
+package calendar
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // the sessions are in New York time
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+)
+
+// NewYork is the location of the sessions and of the daily rollover
+var NewYork = loadNewYork()
+
+func loadNewYork() *time.Location {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return time.FixedZone("EST", -5*60*60)
+	}
+	return location
+}
+
+// RolloverHour is the hour of the daily rollover in New York time, when the trading day and the daily candles start
+const RolloverHour = 17
+
+// RolloverAfter returns the first daily rollover strictly after t
+func RolloverAfter(t time.Time) time.Time {
+	ny := t.In(NewYork)
+	rollover := time.Date(ny.Year(), ny.Month(), ny.Day(), RolloverHour, 0, 0, 0, NewYork)
+	if !rollover.After(t) {
+		rollover = time.Date(ny.Year(), ny.Month(), ny.Day()+1, RolloverHour, 0, 0, 0, NewYork)
+	}
+	return rollover.In(t.Location())
+}
+
+// WeeklyTime is a time of the week in New York time
+type WeeklyTime struct {
+	Day    time.Weekday
+	Hour   int
+	Minute int
+}
+
+// seconds is the offset of the time since Sunday 00:00
+func (w WeeklyTime) seconds() int {
+	return ((int(w.Day)*24+w.Hour)*60 + w.Minute) * 60
+}
+
+// Session is a weekly trading session, Close is excluded. A session closing before it opens wraps
+// around the end of the week
+type Session struct {
+	Open  WeeklyTime
+	Close WeeklyTime
+}
+
+// contains reports whether an offset since Sunday 00:00 falls in the session
+func (s Session) contains(seconds int) bool {
+	open, close := s.Open.seconds(), s.Close.seconds()
+	if open <= close {
+		return seconds >= open && seconds < close
+	}
+	return seconds >= open || seconds < close
+}
+
+// FXSessions are the sessions of the currencies, from Sunday 17:00 to Friday 17:00
+var FXSessions = []Session{{Open: WeeklyTime{time.Sunday, 17, 0}, Close: WeeklyTime{time.Friday, 17, 0}}}
+
+// DailyBreakSessions are the default sessions of the metals and CFDs, from Sunday 18:00 to Friday 17:00
+// with a daily break from 17:00 to 18:00
+var DailyBreakSessions = []Session{
+	{Open: WeeklyTime{time.Sunday, 18, 0}, Close: WeeklyTime{time.Monday, 17, 0}},
+	{Open: WeeklyTime{time.Monday, 18, 0}, Close: WeeklyTime{time.Tuesday, 17, 0}},
+	{Open: WeeklyTime{time.Tuesday, 18, 0}, Close: WeeklyTime{time.Wednesday, 17, 0}},
+	{Open: WeeklyTime{time.Wednesday, 18, 0}, Close: WeeklyTime{time.Thursday, 17, 0}},
+	{Open: WeeklyTime{time.Thursday, 18, 0}, Close: WeeklyTime{time.Friday, 17, 0}},
+}
+
+// Closure closes instruments from Start to End, all the instruments when Instruments and Types are empty
+type Closure struct {
+	Name        string                  `json:"name"`
+	Start       time.Time               `json:"start"`
+	End         time.Time               `json:"end"`
+	Instruments []string                `json:"instruments,omitempty"`
+	Types       []models.InstrumentType `json:"types,omitempty"`
+}
+
+// Holiday returns the Closure of a trading day in New York time, from the rollover of the previous day
+// to the rollover of the day
+func Holiday(name string, year int, month time.Month, day int) Closure {
+	return Closure{
+		Name:  name,
+		Start: time.Date(year, month, day-1, RolloverHour, 0, 0, 0, NewYork),
+		End:   time.Date(year, month, day, RolloverHour, 0, 0, 0, NewYork),
+	}
+}
+
+// File is the content of a calendar file:
+//
+//	{
+//	  "sessions": {"DE30_EUR": ["MON 02:00-MON 16:00", "TUE 02:00-TUE 16:00"], "METAL": ["SUN 18:00-FRI 17:00"]},
+//	  "holidays": [{"name": "Christmas", "date": "2026-12-25"}],
+//	  "closures": [{"name": "Maintenance", "start": "2026-11-01T10:00:00Z", "end": "2026-11-01T12:00:00Z"}]
+//	}
+//
+// The sessions are keyed by instrument or by instrument type, the holidays close a trading day as Holiday does
+type File struct {
+	Sessions map[string][]string `json:"sessions"`
+	Holidays []struct {
+		Name        string                  `json:"name"`
+		Date        string                  `json:"date"`
+		Instruments []string                `json:"instruments,omitempty"`
+		Types       []models.InstrumentType `json:"types,omitempty"`
+	} `json:"holidays"`
+	Closures []Closure `json:"closures"`
+}
+
+// Calendar holds the sessions and the closures of the instruments, safe for concurrent use
+type Calendar struct {
+	mutex        sync.RWMutex
+	byType       map[models.InstrumentType][]Session
+	byInstrument map[string][]Session
+	types        map[string]models.InstrumentType
+	closures     []Closure
+}
+
+// New creates a Calendar with the FXSessions for the currencies and the DailyBreakSessions for
+// the metals and CFDs, the instruments of unknown type use the FXSessions
+func New() *Calendar {
+	return &Calendar{
+		byType: map[models.InstrumentType][]Session{
+			models.Currency: FXSessions,
+			models.Metal:    DailyBreakSessions,
+			models.Cfd:      DailyBreakSessions,
+		},
+		byInstrument: make(map[string][]Session),
+		types:        make(map[string]models.InstrumentType),
+	}
+}
+
+// SetInstruments records the type of instruments, to use the sessions of their type
+func (c *Calendar) SetInstruments(instruments []models.Instrument) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, instrument := range instruments {
+		c.types[instrument.Name] = instrument.Type
+	}
+}
+
+// SetTypeSessions sets the sessions of an instrument type
+func (c *Calendar) SetTypeSessions(instrumentType models.InstrumentType, sessions []Session) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.byType[instrumentType] = sessions
+}
+
+// SetSessions sets the sessions of an instrument, they take precedence over the sessions of its type
+func (c *Calendar) SetSessions(instrument string, sessions []Session) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.byInstrument[instrument] = sessions
+}
+
+// AddClosures adds closures
+func (c *Calendar) AddClosures(closures ...Closure) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closures = append(c.closures, closures...)
+}
+
+// Load reads a calendar file and applies its sessions, holidays and closures
+func (c *Calendar) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("calendar: invalid file %s: %w", path, err)
+	}
+	for key, specs := range file.Sessions {
+		sessions := make([]Session, len(specs))
+		for i, spec := range specs {
+			if sessions[i], err = ParseSession(spec); err != nil {
+				return err
+			}
+		}
+		switch instrumentType := models.InstrumentType(key); instrumentType {
+		case models.Currency, models.Cfd, models.Metal:
+			c.SetTypeSessions(instrumentType, sessions)
+		default:
+			c.SetSessions(key, sessions)
+		}
+	}
+	for _, holiday := range file.Holidays {
+		date, err := time.Parse("2006-01-02", holiday.Date)
+		if err != nil {
+			return fmt.Errorf("calendar: invalid holiday date %q", holiday.Date)
+		}
+		closure := Holiday(holiday.Name, date.Year(), date.Month(), date.Day())
+		closure.Instruments = holiday.Instruments
+		closure.Types = holiday.Types
+		c.AddClosures(closure)
+	}
+	c.AddClosures(file.Closures...)
+	return nil
+}
+
+// ParseSession parses a session as "SUN 17:00-FRI 17:00"
+func ParseSession(spec string) (Session, error) {
+	parts := strings.Split(spec, "-")
+	if len(parts) != 2 {
+		return Session{}, fmt.Errorf("calendar: invalid session %q", spec)
+	}
+	open, err := parseWeeklyTime(parts[0])
+	if err != nil {
+		return Session{}, fmt.Errorf("calendar: invalid session %q", spec)
+	}
+	close, err := parseWeeklyTime(parts[1])
+	if err != nil {
+		return Session{}, fmt.Errorf("calendar: invalid session %q", spec)
+	}
+	return Session{Open: open, Close: close}, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"SUN": time.Sunday, "MON": time.Monday, "TUE": time.Tuesday, "WED": time.Wednesday,
+	"THU": time.Thursday, "FRI": time.Friday, "SAT": time.Saturday,
+}
+
+func parseWeeklyTime(spec string) (WeeklyTime, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 2 {
+		return WeeklyTime{}, fmt.Errorf("invalid time %q", spec)
+	}
+	day, ok := weekdays[strings.ToUpper(fields[0])]
+	if !ok {
+		return WeeklyTime{}, fmt.Errorf("invalid day %q", fields[0])
+	}
+	clock, err := time.Parse("15:04", fields[1])
+	if err != nil {
+		return WeeklyTime{}, err
+	}
+	return WeeklyTime{Day: day, Hour: clock.Hour(), Minute: clock.Minute()}, nil
+}
+
+// IsOpen reports whether an instrument can be traded at t, it can be used as risk.Limits.TradingHours
+func (c *Calendar) IsOpen(instrument string, t time.Time) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.inSession(instrument, t) && c.closure(instrument, t) == nil
+}
+
+// IsTradeable reports whether an instrument can be traded at t and, when a price is given, whether OANDA
+// flags its price as tradeable
+func (c *Calendar) IsTradeable(instrument string, t time.Time, price *models.ClientPrice) bool {
+	if price != nil && price.Tradeable != nil && !*price.Tradeable {
+		return false
+	}
+	return c.IsOpen(instrument, t)
+}
+
+// NextOpen returns the first time at or after t when an instrument can be traded, t when it is open.
+// It returns the zero time when the instrument has no session
+func (c *Calendar) NextOpen(instrument string, t time.Time) time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	sessions := c.sessions(instrument)
+	if len(sessions) == 0 {
+		return time.Time{}
+	}
+	// each step moves to a session open or to the end of a closure, a year of steps is plenty
+	for i := 0; i < 1000; i++ {
+		if closure := c.closure(instrument, t); closure != nil {
+			t = closure.End
+			continue
+		}
+		if c.inSession(instrument, t) {
+			return t
+		}
+		t = nextBoundary(sessions, t, func(s Session) WeeklyTime { return s.Open })
+	}
+	return time.Time{}
+}
+
+// NextClose returns the first time after t when an instrument stops being tradeable, t when it is closed
+func (c *Calendar) NextClose(instrument string, t time.Time) time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if !c.inSession(instrument, t) || c.closure(instrument, t) != nil {
+		return t
+	}
+	close := nextBoundary(c.sessions(instrument), t, func(s Session) WeeklyTime { return s.Close })
+	for _, closure := range c.closures {
+		if closure.Start.After(t) && closure.Start.Before(close) && closure.applies(instrument, c.types[instrument]) {
+			close = closure.Start
+		}
+	}
+	return close
+}
+
+// Align returns the start of the candle of a granularity containing t. As OANDA does by default, the
+// daily candles start at the 17:00 New York rollover, the weekly candles on Friday and the monthly candles
+// at the rollover before the first day of the month. The intraday candles are aligned on the daily rollover
+func Align(t time.Time, granularity api.Granularity) time.Time {
+	ny := t.In(NewYork)
+	rollover := time.Date(ny.Year(), ny.Month(), ny.Day(), RolloverHour, 0, 0, 0, NewYork)
+	if rollover.After(t) {
+		rollover = time.Date(ny.Year(), ny.Month(), ny.Day()-1, RolloverHour, 0, 0, 0, NewYork)
+	}
+	switch granularity {
+	case api.D:
+		return rollover.In(t.Location())
+	case api.W:
+		// the trading day starting at the Friday rollover is counted as Saturday
+		day := rollover.In(NewYork)
+		offset := (int(day.Weekday()) - int(time.Friday) + 7) % 7
+		return time.Date(day.Year(), day.Month(), day.Day()-offset, RolloverHour, 0, 0, 0, NewYork).In(t.Location())
+	case api.M:
+		start := time.Date(ny.Year(), ny.Month()+1, 0, RolloverHour, 0, 0, 0, NewYork)
+		if start.After(t) {
+			start = time.Date(ny.Year(), ny.Month(), 0, RolloverHour, 0, 0, 0, NewYork)
+		}
+		return start.In(t.Location())
+	}
+	duration := granularity.Duration()
+	if duration <= 0 {
+		return t
+	}
+	return rollover.Add(t.Sub(rollover) / duration * duration).In(t.Location())
+}
+
+// sessions returns the sessions of an instrument, by instrument then by type
+func (c *Calendar) sessions(instrument string) []Session {
+	if sessions, ok := c.byInstrument[instrument]; ok {
+		return sessions
+	}
+	instrumentType, ok := c.types[instrument]
+	if !ok {
+		instrumentType = models.Currency
+	}
+	return c.byType[instrumentType]
+}
+
+func (c *Calendar) inSession(instrument string, t time.Time) bool {
+	seconds := weekSeconds(t)
+	for _, session := range c.sessions(instrument) {
+		if session.contains(seconds) {
+			return true
+		}
+	}
+	return false
+}
+
+// closure returns a closure of an instrument containing t
+func (c *Calendar) closure(instrument string, t time.Time) *Closure {
+	for i, closure := range c.closures {
+		if !t.Before(closure.Start) && t.Before(closure.End) && closure.applies(instrument, c.types[instrument]) {
+			return &c.closures[i]
+		}
+	}
+	return nil
+}
+
+func (closure *Closure) applies(instrument string, instrumentType models.InstrumentType) bool {
+	if len(closure.Instruments) == 0 && len(closure.Types) == 0 {
+		return true
+	}
+	for _, name := range closure.Instruments {
+		if name == instrument {
+			return true
+		}
+	}
+	for _, t := range closure.Types {
+		if t == instrumentType {
+			return true
+		}
+	}
+	return false
+}
+
+// weekSeconds is the offset of t since Sunday 00:00 New York time
+func weekSeconds(t time.Time) int {
+	ny := t.In(NewYork)
+	return ((int(ny.Weekday())*24+ny.Hour())*60+ny.Minute())*60 + ny.Second()
+}
+
+// nextBoundary returns the first open or close (as selected by boundary) of the sessions strictly after t
+func nextBoundary(sessions []Session, t time.Time, boundary func(Session) WeeklyTime) time.Time {
+	ny := t.In(NewYork)
+	sunday := ny.Day() - int(ny.Weekday())
+	var next time.Time
+	for _, session := range sessions {
+		w := boundary(session)
+		candidate := time.Date(ny.Year(), ny.Month(), sunday+int(w.Day), w.Hour, w.Minute, 0, 0, NewYork)
+		if !candidate.After(t) {
+			candidate = time.Date(ny.Year(), ny.Month(), sunday+int(w.Day)+7, w.Hour, w.Minute, 0, 0, NewYork)
+		}
+		if next.IsZero() || candidate.Before(next) {
+			next = candidate
+		}
+	}
+	return next.In(t.Location())
+}
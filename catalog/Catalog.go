@@ -0,0 +1,241 @@
+// Package catalog keeps the instruments of an account, loaded once and refreshed on a schedule, with
+// lookups by name, filters by type, tag and currency, and the resolution of the currency pairs
+package catalog
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+)
+
+// Source lists the tradeable instruments of an account, it is implemented by api.API
+type Source interface {
+	GetInstruments() (*models.Instruments, error)
+}
+
+// Filter selects instruments, the empty fields match any instrument
+type Filter struct {
+	Type models.InstrumentType
+	// Tag matches the instruments with a tag of this name, and of this type when Tag.Type is set
+	Tag   models.Tag
+	Base  string
+	Quote string
+}
+
+// Matches reports whether an instrument matches the filter
+func (filter Filter) Matches(instrument models.Instrument) bool {
+	if filter.Type != "" && instrument.Type != filter.Type {
+		return false
+	}
+	base, quote := Currencies(instrument.Name)
+	if (filter.Base != "" && base != filter.Base) || (filter.Quote != "" && quote != filter.Quote) {
+		return false
+	}
+	if filter.Tag == (models.Tag{}) {
+		return true
+	}
+	for _, tag := range instrument.Tags {
+		if tag.Name == filter.Tag.Name && (filter.Tag.Type == "" || tag.Type == filter.Tag.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// Catalog is the set of the instruments of an account, safe for concurrent use
+type Catalog struct {
+	source Source
+
+	mutex       sync.RWMutex
+	instruments []models.Instrument
+	byName      map[string]models.Instrument
+	loaded      time.Time
+	err         error
+}
+
+// New creates an empty Catalog of the instruments of source, see Load
+func New(source Source) *Catalog {
+	return &Catalog{source: source, byName: make(map[string]models.Instrument)}
+}
+
+var (
+	sharedMutex sync.Mutex
+	shared      = make(map[string]*Catalog)
+)
+
+// Shared returns the Catalog of the account of an api instance, created by the first call for the account
+// in its environment, so that the pricing, sizing and order code of an account share the instruments
+// loaded once. The practice and live accounts of the same ID have their own Catalog
+func Shared(client *api.API) *Catalog {
+	sharedMutex.Lock()
+	defer sharedMutex.Unlock()
+	key := client.URL() + "/" + client.Account()
+	c, ok := shared[key]
+	if !ok {
+		c = New(client)
+		shared[key] = c
+	}
+	return c
+}
+
+// Load loads the instruments, unless they were already loaded
+func (c *Catalog) Load() error {
+	c.mutex.RLock()
+	loaded := !c.loaded.IsZero()
+	c.mutex.RUnlock()
+	if loaded {
+		return nil
+	}
+	return c.Refresh()
+}
+
+// Refresh loads the instruments again, the current instruments are kept when it fails
+func (c *Catalog) Refresh() error {
+	response, err := c.source.GetInstruments()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.err = err
+	if err != nil {
+		return err
+	}
+	instruments := append([]models.Instrument(nil), response.Instruments...)
+	sort.Slice(instruments, func(i, j int) bool {
+		return instruments[i].Name < instruments[j].Name
+	})
+	c.instruments = instruments
+	c.byName = make(map[string]models.Instrument, len(instruments))
+	for _, instrument := range instruments {
+		c.byName[instrument.Name] = instrument
+	}
+	c.loaded = time.Now()
+	return nil
+}
+
+// Run loads the instruments and refreshes them every interval until ctx is done. A failed refresh
+// keeps the current instruments, its error is returned by Err
+func (c *Catalog) Run(ctx context.Context, interval time.Duration) error {
+	if err := c.Load(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			c.Refresh()
+		}
+	}
+}
+
+// Loaded returns the time of the last successful load, zero before the first one
+func (c *Catalog) Loaded() time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.loaded
+}
+
+// Err returns the error of the last load
+func (c *Catalog) Err() error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.err
+}
+
+// Get returns an instrument by name
+func (c *Catalog) Get(name string) (models.Instrument, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	instrument, ok := c.byName[name]
+	return instrument, ok
+}
+
+// All returns all the instruments, sorted by name
+func (c *Catalog) All() []models.Instrument {
+	return c.Filter(Filter{})
+}
+
+// Filter returns the instruments matching a filter, sorted by name
+func (c *Catalog) Filter(filter Filter) []models.Instrument {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	var instruments []models.Instrument
+	for _, instrument := range c.instruments {
+		if filter.Matches(instrument) {
+			instruments = append(instruments, instrument)
+		}
+	}
+	return instruments
+}
+
+// Names returns the names of the instruments matching a filter, as the pricing endpoints take them
+func (c *Catalog) Names(filter Filter) []string {
+	var names []string
+	for _, instrument := range c.Filter(filter) {
+		names = append(names, instrument.Name)
+	}
+	return names
+}
+
+// ConversionPair returns the instrument converting an amount in currency from to currency to: an amount
+// is multiplied by the price of FROM_TO, or divided by the price of TO_FROM, in which case inverted is true
+func (c *Catalog) ConversionPair(from string, to string) (instrument models.Instrument, inverted bool, ok bool) {
+	if instrument, ok = c.Get(from + "_" + to); ok {
+		return instrument, false, true
+	}
+	if instrument, ok = c.Get(to + "_" + from); ok {
+		return instrument, true, true
+	}
+	return models.Instrument{}, false, false
+}
+
+// HomeConversion returns a function converting an amount in the quote currency of an instrument to the home
+// currency, with the ConversionPair of the currencies priced by price. It returns 0 when the pair or its
+// price is unknown. It can be used as the HomeConversion of the risk checks and of the mirror
+func (c *Catalog) HomeConversion(home string, price func(instrument string) (models.ClientPrice, bool)) func(instrument string) float64 {
+	return func(instrument string) float64 {
+		_, quote := Currencies(instrument)
+		if quote == home {
+			return 1
+		}
+		pair, inverted, ok := c.ConversionPair(quote, home)
+		if !ok {
+			return 0
+		}
+		p, ok := price(pair.Name)
+		if !ok || len(p.Bids) == 0 || len(p.Asks) == 0 {
+			return 0
+		}
+		mid := (p.Bids[0].Price + p.Asks[0].Price) / 2
+		if inverted {
+			return 1 / mid
+		}
+		return mid
+	}
+}
+
+// RoundOrder rounds the prices and distances of an order to the display precision of its instrument
+func (c *Catalog) RoundOrder(order models.Order) (models.Order, error) {
+	instrument, ok := c.Get(order.Instrument)
+	if !ok {
+		return order, errors.New("catalog: unknown instrument " + order.Instrument)
+	}
+	return instrument.RoundOrder(order), nil
+}
+
+// Currencies returns the base and quote currencies of an instrument: EUR and USD for EUR_USD,
+// the base of a CFD is its underlying (DE30 for DE30_EUR)
+func Currencies(instrument string) (base string, quote string) {
+	i := strings.LastIndex(instrument, "_")
+	if i < 0 {
+		return instrument, ""
+	}
+	return instrument[:i], instrument[i+1:]
+}
@@ -0,0 +1,47 @@
+package catalog
+
+import (
+	"math"
+	"testing"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+)
+
+// source returns fixed instruments
+type source []models.Instrument
+
+func (s source) GetInstruments() (*models.Instruments, error) {
+	return &models.Instruments{Instruments: s}, nil
+}
+
+func TestHomeConversion(t *testing.T) {
+	c := New(source{{Name: "EUR_USD"}, {Name: "USD_JPY"}, {Name: "EUR_JPY"}})
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	prices := map[string]float64{"EUR_USD": 1.2, "USD_JPY": 110}
+	price := func(instrument string) (models.ClientPrice, bool) {
+		mid, ok := prices[instrument]
+		return models.ClientPrice{Bids: []models.PriceBucket{{Price: mid}}, Asks: []models.PriceBucket{{Price: mid}}}, ok
+	}
+	conversion := c.HomeConversion("USD", price)
+
+	for instrument, want := range map[string]float64{"EUR_USD": 1, "EUR_JPY": 1 / 110.0, "USD_CHF": 0} {
+		if got := conversion(instrument); math.Abs(got-want) > 1e-12 {
+			t.Errorf("%s: %g, want %g", instrument, got, want)
+		}
+	}
+}
+
+func TestSharedByEnvironment(t *testing.T) {
+	practice := api.Context{ApiURL: "https://api-fxpractice.oanda.com", Account: "001"}
+	live := api.Context{ApiURL: "https://api-fxtrade.oanda.com", Account: "001"}
+	practiceClient, otherClient, liveClient := practice.CreateAPI(), practice.CreateAPI(), live.CreateAPI()
+	if Shared(&practiceClient) != Shared(&otherClient) {
+		t.Error("two catalogs for the same account")
+	}
+	if Shared(&practiceClient) == Shared(&liveClient) {
+		t.Error("the practice and live accounts share a catalog")
+	}
+}
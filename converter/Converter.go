@@ -0,0 +1,276 @@
+// Package converter keeps the latest prices of the pricing endpoints and the pricing stream, and converts
+// amounts between any two currencies: with the home conversions of OANDA for the account currency, or with
+// the price of a direct, inverse or triangulated pair
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+)
+
+// ErrStale is returned with a rate computed from prices older than MaxAge, when no fresh rate is known
+var ErrStale = errors.New("converter: stale rate")
+
+// The sources of a Rate
+const (
+	SourceIdentity       = "IDENTITY"
+	SourceHomeConversion = "HOME_CONVERSION"
+	SourceDirect         = "DIRECT"
+	SourceInverse        = "INVERSE"
+	SourceTriangulated   = "TRIANGULATED"
+)
+
+// Config is the configuration of a Converter
+type Config struct {
+	// Home is the account currency, the currency of the home conversions
+	Home string
+	// MaxAge is the age after which a price or a home conversion is stale, they never are if zero
+	MaxAge time.Duration
+	// Pivots are the currencies tried first to triangulate a rate, the other currencies priced are tried next
+	Pivots []string
+}
+
+// Source returns the prices of instruments with the home conversions, it is implemented by api.API
+type Source interface {
+	GetPricing(instruments []string) (*models.Prices, error)
+}
+
+// Rate is the factor converting an amount in currency From to currency To
+type Rate struct {
+	From   string
+	To     string
+	Rate   float64
+	Source string
+	// Instruments are the instruments priced to compute the rate, the currencies of the home conversions
+	// for SourceHomeConversion
+	Instruments []string
+	// Time is the time of the oldest price used
+	Time time.Time
+	// Stale is true when a price used is older than MaxAge
+	Stale bool
+}
+
+type quote struct {
+	mid  float64
+	time time.Time
+}
+
+// Converter converts amounts between currencies at the latest prices, safe for concurrent use
+type Converter struct {
+	config Config
+	now    func() time.Time
+
+	mutex sync.RWMutex
+	// prices are the mid prices by instrument, home the position value factors by currency
+	prices map[string]quote
+	home   map[string]quote
+}
+
+// New creates an empty Converter, its prices are set by Update, UpdatePrices, Refresh or StreamPrices
+func New(config Config) *Converter {
+	return &Converter{
+		config: config,
+		now:    time.Now,
+		prices: make(map[string]quote),
+		home:   make(map[string]quote),
+	}
+}
+
+// Update sets the price of an instrument, the prices without bids or asks are ignored
+func (c *Converter) Update(price models.ClientPrice) {
+	if len(price.Bids) == 0 || len(price.Asks) == 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.setPrice(&price)
+}
+
+// UpdatePrices sets the prices and the home conversions of a pricing response
+func (c *Converter) UpdatePrices(prices *models.Prices) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i := range prices.Prices {
+		if len(prices.Prices[i].Bids) > 0 && len(prices.Prices[i].Asks) > 0 {
+			c.setPrice(&prices.Prices[i])
+		}
+	}
+	t := prices.Time
+	if t.IsZero() {
+		t = c.now()
+	}
+	for _, conversion := range prices.HomeConversions {
+		if conversion.PositionValue > 0 {
+			c.home[conversion.Currency] = quote{mid: conversion.PositionValue, time: t}
+		}
+	}
+}
+
+// Refresh gets the prices and the home conversions of instruments from source. The pricing stream does not
+// update the home conversions, Refresh must be called more often than MaxAge to keep them preferred
+func (c *Converter) Refresh(source Source, instruments []string) error {
+	prices, err := source.GetPricing(instruments)
+	if err != nil {
+		return err
+	}
+	c.UpdatePrices(prices)
+	return nil
+}
+
+// StreamPrices starts a pricing stream for instruments and updates the prices with it.
+// It blocks until the server refuses the stream, as api.StreamAPI.StreamPrices does
+func (c *Converter) StreamPrices(streamApi *api.StreamAPI, instruments []string) error {
+	return streamApi.StreamPrices(instruments, c.Update, nil)
+}
+
+// Rate returns the rate converting currency from to currency to, computed from: the home conversions when
+// one of the currencies is the account currency, the direct pair FROM_TO, the inverse pair TO_FROM, the home
+// conversions of both currencies, or the pairs through a pivot currency. A fresh home conversion is preferred,
+// then the newest fresh rate, in that order of preference for the rates of the same time, or the newest stale
+// rate with ErrStale. The home conversions are only set by UpdatePrices and Refresh
+func (c *Converter) Rate(from string, to string) (Rate, error) {
+	if from == to {
+		return Rate{From: from, To: to, Rate: 1, Source: SourceIdentity, Time: c.now()}, nil
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	fresh, stale := -1, -1
+	candidates := c.candidates(from, to)
+	for i, candidate := range candidates {
+		if !candidate.Stale && candidate.Source == SourceHomeConversion {
+			return candidate, nil
+		}
+		if !candidate.Stale && (fresh < 0 || candidate.Time.After(candidates[fresh].Time)) {
+			fresh = i
+		}
+		if candidate.Stale && (stale < 0 || candidate.Time.After(candidates[stale].Time)) {
+			stale = i
+		}
+	}
+	if fresh >= 0 {
+		return candidates[fresh], nil
+	}
+	if stale >= 0 {
+		return candidates[stale], ErrStale
+	}
+	return Rate{}, fmt.Errorf("converter: no rate from %s to %s", from, to)
+}
+
+// Convert converts an amount in currency from to currency to, see Rate
+func (c *Converter) Convert(amount float64, from string, to string) (float64, error) {
+	rate, err := c.Rate(from, to)
+	return amount * rate.Rate, err
+}
+
+// candidates returns the rates converting from to to, in the order of preference
+func (c *Converter) candidates(from string, to string) []Rate {
+	var candidates []Rate
+	add := func(source string, rate float64, instruments []string, times ...time.Time) {
+		r := Rate{From: from, To: to, Rate: rate, Source: source, Instruments: instruments, Time: times[0]}
+		for _, t := range times[1:] {
+			if t.Before(r.Time) {
+				r.Time = t
+			}
+		}
+		r.Stale = c.stale(r.Time)
+		candidates = append(candidates, r)
+	}
+
+	if home := c.config.Home; home != "" && (from == home || to == home) {
+		if to == home {
+			if q, ok := c.home[from]; ok {
+				add(SourceHomeConversion, q.mid, []string{from}, q.time)
+			}
+		} else if q, ok := c.home[to]; ok {
+			add(SourceHomeConversion, 1/q.mid, []string{to}, q.time)
+		}
+	}
+	if q, ok := c.prices[from+"_"+to]; ok {
+		add(SourceDirect, q.mid, []string{from + "_" + to}, q.time)
+	}
+	if q, ok := c.prices[to+"_"+from]; ok {
+		add(SourceInverse, 1/q.mid, []string{to + "_" + from}, q.time)
+	}
+	if c.config.Home != "" && from != c.config.Home && to != c.config.Home {
+		qFrom, okFrom := c.home[from]
+		qTo, okTo := c.home[to]
+		if okFrom && okTo {
+			add(SourceHomeConversion, qFrom.mid/qTo.mid, []string{from, to}, qFrom.time, qTo.time)
+		}
+	}
+	for _, pivot := range c.pivots(from, to) {
+		first, firstName, firstTime, ok := c.pair(from, pivot)
+		if !ok {
+			continue
+		}
+		second, secondName, secondTime, ok := c.pair(pivot, to)
+		if !ok {
+			continue
+		}
+		add(SourceTriangulated, first*second, []string{firstName, secondName}, firstTime, secondTime)
+	}
+	return candidates
+}
+
+// pair returns the rate of a direct or inverse pair
+func (c *Converter) pair(from string, to string) (float64, string, time.Time, bool) {
+	if q, ok := c.prices[from+"_"+to]; ok {
+		return q.mid, from + "_" + to, q.time, true
+	}
+	if q, ok := c.prices[to+"_"+from]; ok {
+		return 1 / q.mid, to + "_" + from, q.time, true
+	}
+	return 0, "", time.Time{}, false
+}
+
+// pivots returns the configured pivots, then the other currencies priced sorted, without from and to
+func (c *Converter) pivots(from string, to string) []string {
+	seen := map[string]bool{from: true, to: true}
+	var pivots []string
+	for _, pivot := range c.config.Pivots {
+		if !seen[pivot] {
+			seen[pivot] = true
+			pivots = append(pivots, pivot)
+		}
+	}
+	var others []string
+	for instrument := range c.prices {
+		for _, currency := range strings.SplitN(instrument, "_", 2) {
+			if !seen[currency] {
+				seen[currency] = true
+				others = append(others, currency)
+			}
+		}
+	}
+	sort.Strings(others)
+	return append(pivots, others...)
+}
+
+// Stale reports whether the price of an instrument is older than MaxAge, or missing
+func (c *Converter) Stale(instrument string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	q, ok := c.prices[instrument]
+	return !ok || c.stale(q.time)
+}
+
+func (c *Converter) stale(t time.Time) bool {
+	return c.config.MaxAge > 0 && c.now().Sub(t) > c.config.MaxAge
+}
+
+// setPrice sets the mid price of an instrument, a price without time is timed now
+func (c *Converter) setPrice(price *models.ClientPrice) {
+	t := price.Time
+	if t.IsZero() {
+		t = c.now()
+	}
+	c.prices[price.Instrument] = quote{mid: (price.Bids[0].Price + price.Asks[0].Price) / 2, time: t}
+}
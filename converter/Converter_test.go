@@ -0,0 +1,94 @@
+package converter
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/burbru/goanda/models"
+)
+
+var now = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func price(instrument string, mid float64, at time.Time) models.ClientPrice {
+	return models.ClientPrice{
+		Instrument: instrument,
+		Time:       at,
+		Bids:       []models.PriceBucket{{Price: mid - 0.0001}},
+		Asks:       []models.PriceBucket{{Price: mid + 0.0001}},
+	}
+}
+
+func newConverter(config Config) *Converter {
+	c := New(config)
+	c.now = func() time.Time { return now }
+	return c
+}
+
+func almostEqual(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestRateSources(t *testing.T) {
+	c := newConverter(Config{Pivots: []string{"USD"}})
+	c.Update(price("EUR_USD", 1.2, now))
+	c.Update(price("USD_JPY", 110, now))
+
+	for _, test := range []struct {
+		from, to string
+		rate     float64
+		source   string
+	}{
+		{"EUR", "EUR", 1, SourceIdentity},
+		{"EUR", "USD", 1.2, SourceDirect},
+		{"USD", "EUR", 1 / 1.2, SourceInverse},
+		{"EUR", "JPY", 1.2 * 110, SourceTriangulated},
+	} {
+		rate, err := c.Rate(test.from, test.to)
+		if err != nil || !almostEqual(rate.Rate, test.rate) || rate.Source != test.source {
+			t.Errorf("%s to %s: %+v %v, want %g from %s", test.from, test.to, rate, err, test.rate, test.source)
+		}
+	}
+	if _, err := c.Rate("EUR", "CHF"); err == nil {
+		t.Error("rate without prices")
+	}
+}
+
+func TestRateStale(t *testing.T) {
+	c := newConverter(Config{MaxAge: time.Minute})
+	c.Update(price("EUR_USD", 1.2, now.Add(-2*time.Minute)))
+
+	rate, err := c.Rate("EUR", "USD")
+	if err != ErrStale || !rate.Stale || !almostEqual(rate.Rate, 1.2) {
+		t.Errorf("%+v %v, want a stale rate", rate, err)
+	}
+}
+
+func TestRateHomeConversionPreferred(t *testing.T) {
+	c := newConverter(Config{Home: "USD", MaxAge: time.Minute})
+	c.UpdatePrices(&models.Prices{
+		Time:            now.Add(-30 * time.Second),
+		Prices:          []models.ClientPrice{price("EUR_USD", 1.2, now.Add(-30*time.Second))},
+		HomeConversions: []models.HomeConversions{{Currency: "EUR", PositionValue: 1.2}},
+	})
+
+	// a fresh home conversion is preferred to a newer streamed price
+	c.Update(price("EUR_USD", 1.25, now))
+	rate, err := c.Rate("EUR", "USD")
+	if err != nil || rate.Source != SourceHomeConversion || !almostEqual(rate.Rate, 1.2) {
+		t.Errorf("%+v %v, want the home conversion", rate, err)
+	}
+
+	// a stale home conversion falls back to the newest fresh rate
+	later := now.Add(time.Minute)
+	c.now = func() time.Time { return later }
+	c.Update(price("EUR_USD", 1.26, later))
+	rate, err = c.Rate("EUR", "USD")
+	if err != nil || rate.Source != SourceDirect || !almostEqual(rate.Rate, 1.26) {
+		t.Errorf("%+v %v, want the streamed price", rate, err)
+	}
+	rate, err = c.Rate("USD", "EUR")
+	if err != nil || rate.Source != SourceInverse || !almostEqual(rate.Rate, 1/1.26) {
+		t.Errorf("%+v %v, want the streamed price", rate, err)
+	}
+}
@@ -0,0 +1,256 @@
+// Package depth models the liquidity levels of a price: the average price and the slippage of an order
+// walking through the levels, and the spread for a size, so that the execution can choose between
+// a market order and a limit order
+package depth
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/burbru/goanda/models"
+)
+
+// ErrEmptyBook is returned when the side of the book an order would be filled on has no price
+var ErrEmptyBook = errors.New("depth: no price on the side of the order")
+
+// ErrZeroUnits is returned for an order of zero units
+var ErrZeroUnits = errors.New("depth: zero units")
+
+// ErrInsufficientLiquidity is returned when the levels of a book cannot fill all the units of an order
+var ErrInsufficientLiquidity = errors.New("depth: insufficient liquidity")
+
+// Book is the bids and asks of a price, each level offering its liquidity at its price: an order
+// consumes the liquidity of the best level first, then of the next ones
+type Book struct {
+	Instrument string
+	Time       time.Time
+	// Bids are sorted from the highest price, Asks from the lowest
+	Bids []models.PriceBucket
+	Asks []models.PriceBucket
+}
+
+// NewBook creates the Book of a price, its levels are copied and sorted
+func NewBook(price *models.ClientPrice) Book {
+	book := Book{
+		Instrument: price.Instrument,
+		Time:       price.Time,
+		Bids:       append([]models.PriceBucket(nil), price.Bids...),
+		Asks:       append([]models.PriceBucket(nil), price.Asks...),
+	}
+	sort.SliceStable(book.Bids, func(i, j int) bool { return book.Bids[i].Price > book.Bids[j].Price })
+	sort.SliceStable(book.Asks, func(i, j int) bool { return book.Asks[i].Price < book.Asks[j].Price })
+	return book
+}
+
+// Empty reports whether the book misses the bids or the asks, as when the instrument is not tradeable
+func (b *Book) Empty() bool {
+	return len(b.Bids) == 0 || len(b.Asks) == 0
+}
+
+// BestBid returns the highest bid
+func (b *Book) BestBid() (float64, bool) {
+	if len(b.Bids) == 0 {
+		return 0, false
+	}
+	return b.Bids[0].Price, true
+}
+
+// BestAsk returns the lowest ask
+func (b *Book) BestAsk() (float64, bool) {
+	if len(b.Asks) == 0 {
+		return 0, false
+	}
+	return b.Asks[0].Price, true
+}
+
+// Mid returns the average of the best bid and the best ask
+func (b *Book) Mid() (float64, bool) {
+	if b.Empty() {
+		return 0, false
+	}
+	return (b.Bids[0].Price + b.Asks[0].Price) / 2, true
+}
+
+// Spread returns the best ask minus the best bid
+func (b *Book) Spread() (float64, bool) {
+	if b.Empty() {
+		return 0, false
+	}
+	return b.Asks[0].Price - b.Bids[0].Price, true
+}
+
+// Liquidity returns the total liquidity of the side filling an order of units: the asks for a buy
+// (positive units), the bids for a sell
+func (b *Book) Liquidity(units int64) int64 {
+	var liquidity int64
+	for _, level := range b.side(units) {
+		liquidity += int64(level.Liquidity)
+	}
+	return liquidity
+}
+
+// Execution is the expected fill of a market order walking through the levels of a book
+type Execution struct {
+	// Units are the units of the order, negative for a sell
+	Units int64
+	// Filled are the absolute units the levels can fill
+	Filled int64
+	// VWAP is the average price of the units filled, zero if none
+	VWAP float64
+	// BestPrice is the price of the best level, WorstPrice the price of the last level used
+	BestPrice  float64
+	WorstPrice float64
+	// Levels is the number of levels used
+	Levels int
+	// Slippage is the distance from BestPrice to VWAP, positive when the order pays more than the best
+	// price (buy) or receives less (sell)
+	Slippage float64
+}
+
+// Complete reports whether the levels can fill all the units of the order
+func (e *Execution) Complete() bool {
+	return e.Filled == abs(e.Units)
+}
+
+// Execute returns the expected fill of a market order of units: a buy (positive units) takes the asks,
+// a sell takes the bids. When the book lacks liquidity the Execution is not Complete, the levels
+// without liquidity fill nothing
+func (b *Book) Execute(units int64) (Execution, error) {
+	if units == 0 {
+		return Execution{}, ErrZeroUnits
+	}
+	levels := b.side(units)
+	if len(levels) == 0 {
+		return Execution{Units: units}, ErrEmptyBook
+	}
+
+	execution := Execution{Units: units, BestPrice: levels[0].Price}
+	remaining := abs(units)
+	var value float64
+	for _, level := range levels {
+		if remaining == 0 {
+			break
+		}
+		if level.Liquidity <= 0 {
+			continue
+		}
+		filled := int64(level.Liquidity)
+		if filled > remaining {
+			filled = remaining
+		}
+		value += float64(filled) * level.Price
+		execution.Filled += filled
+		execution.WorstPrice = level.Price
+		execution.Levels++
+		remaining -= filled
+	}
+	if execution.Filled > 0 {
+		execution.VWAP = value / float64(execution.Filled)
+		execution.Slippage = execution.VWAP - execution.BestPrice
+		if units < 0 {
+			execution.Slippage = -execution.Slippage
+		}
+	}
+	return execution, nil
+}
+
+// VWAP returns the average price of a market order of units, see Execute. When the book cannot fill
+// all the units it returns the average price of the units filled with ErrInsufficientLiquidity
+func (b *Book) VWAP(units int64) (float64, error) {
+	execution, err := b.Execute(units)
+	if err != nil {
+		return 0, err
+	}
+	if !execution.Complete() {
+		return execution.VWAP, ErrInsufficientLiquidity
+	}
+	return execution.VWAP, nil
+}
+
+// Slippage returns the expected slippage of a market order of units, in price, see Execution.Slippage
+func (b *Book) Slippage(units int64) (float64, error) {
+	execution, err := b.Execute(units)
+	if err != nil {
+		return 0, err
+	}
+	if !execution.Complete() {
+		return execution.Slippage, ErrInsufficientLiquidity
+	}
+	return execution.Slippage, nil
+}
+
+// SpreadFor returns the spread paid by an order of units: the VWAP of a buy minus the VWAP of a sell
+func (b *Book) SpreadFor(units int64) (float64, error) {
+	buy, err := b.VWAP(abs(units))
+	if err != nil {
+		return 0, err
+	}
+	sell, err := b.VWAP(-abs(units))
+	if err != nil {
+		return 0, err
+	}
+	return buy - sell, nil
+}
+
+// side returns the levels filling an order of units
+func (b *Book) side(units int64) []models.PriceBucket {
+	if units > 0 {
+		return b.Asks
+	}
+	return b.Bids
+}
+
+// SpreadStats are the statistics of the spreads of a series of books, the books missing a side are
+// counted apart
+type SpreadStats struct {
+	Count int
+	Empty int
+	Last  float64
+	Min   float64
+	Max   float64
+	Mean  float64
+
+	m2 float64
+}
+
+// Add adds the spread of a book
+func (s *SpreadStats) Add(book *Book) {
+	spread, ok := book.Spread()
+	if !ok {
+		s.Empty++
+		return
+	}
+	s.AddSpread(spread)
+}
+
+// AddSpread adds a spread
+func (s *SpreadStats) AddSpread(spread float64) {
+	s.Count++
+	s.Last = spread
+	if s.Count == 1 || spread < s.Min {
+		s.Min = spread
+	}
+	if s.Count == 1 || spread > s.Max {
+		s.Max = spread
+	}
+	delta := spread - s.Mean
+	s.Mean += delta / float64(s.Count)
+	s.m2 += delta * (spread - s.Mean)
+}
+
+// StdDev returns the sample standard deviation of the spreads
+func (s *SpreadStats) StdDev() float64 {
+	if s.Count < 2 {
+		return 0
+	}
+	return math.Sqrt(s.m2 / float64(s.Count-1))
+}
+
+func abs(units int64) int64 {
+	if units < 0 {
+		return -units
+	}
+	return units
+}
@@ -0,0 +1,194 @@
+// Package financing estimates the overnight financing of positions from the financing rates of the
+// instruments, and reconciles the estimates with the DAILY_FINANCING transactions of an account
+package financing
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/burbru/goanda/calendar"
+	"github.com/burbru/goanda/models"
+)
+
+// Position is a position to estimate the financing of
+type Position struct {
+	Instrument models.Instrument
+	// Units are positive for a long position and negative for a short position
+	Units int64
+	// Price is the price valuing the position, usually the mid price
+	Price float64
+	// HomeConversion is the factor converting the quote currency to the account currency, 1 if zero
+	HomeConversion float64
+}
+
+// Notional returns the value of the position in the account currency
+func (p Position) Notional() float64 {
+	conversion := p.HomeConversion
+	if conversion == 0 {
+		conversion = 1
+	}
+	return math.Abs(float64(p.Units)) * p.Price * conversion
+}
+
+// Rate returns the annual financing rate of the position: the long rate or the short rate of its instrument
+func (p Position) Rate() float64 {
+	if p.Units < 0 {
+		return float64(p.Instrument.Financing.ShortRate)
+	}
+	return float64(p.Instrument.Financing.LongRate)
+}
+
+// Charge is the financing of a position at a rollover, negative when it is paid
+type Charge struct {
+	Rollover    time.Time
+	DaysCharged int
+	Rate        float64
+	Notional    float64
+	Amount      float64
+}
+
+// Daily returns the financing of a position at a rollover: notional * rate * days charged / 365,
+// the days charged depend on the weekday of the rollover in New York time (3 on Wednesday for currencies)
+func Daily(position Position, rollover time.Time) Charge {
+	days := position.Instrument.Financing.DaysCharged(rollover.In(calendar.NewYork).Weekday())
+	charge := Charge{
+		Rollover:    rollover,
+		DaysCharged: days,
+		Rate:        position.Rate(),
+		Notional:    position.Notional(),
+	}
+	charge.Amount = charge.Notional * charge.Rate * float64(days) / 365
+	return charge
+}
+
+// Estimate returns the financing of a position held from from to to, one Charge for each rollover in between
+// charging at least a day. The price and conversion of the position are used for all the rollovers
+func Estimate(position Position, from time.Time, to time.Time) []Charge {
+	var charges []Charge
+	for rollover := calendar.RolloverAfter(from); !rollover.After(to); rollover = calendar.RolloverAfter(rollover) {
+		if charge := Daily(position, rollover); charge.DaysCharged > 0 {
+			charges = append(charges, charge)
+		}
+	}
+	return charges
+}
+
+// Total returns the sum of the amounts of charges
+func Total(charges []Charge) float64 {
+	total := 0.0
+	for _, charge := range charges {
+		total += charge.Amount
+	}
+	return total
+}
+
+// Reconciliation compares the financing of a trade charged by a DAILY_FINANCING transaction with its estimate
+type Reconciliation struct {
+	TransactionID string
+	Time          time.Time
+	Instrument    string
+	TradeID       string
+	Units         int64
+	Expected      Charge
+	Actual        float64
+	// Difference is Actual - Expected.Amount
+	Difference float64
+	// Priced is false when no price was found for the rollover, Expected is then zero
+	Priced bool
+}
+
+// Reconciler estimates the financing charged by the DAILY_FINANCING transactions of an account
+type Reconciler struct {
+	// Instruments are the instruments of the account, with their financing rates
+	Instruments []models.Instrument
+	// Price returns the price of an instrument at a time, such as the close of the candle before the rollover
+	Price func(instrument string, t time.Time) (float64, bool)
+	// HomeConversion returns the factor converting the quote currency of an instrument to the account
+	// currency at a time, a factor of 1 is used if nil
+	HomeConversion func(instrument string, t time.Time) float64
+}
+
+// Reconcile replays the transaction history to know the units of the open trades, and compares the financing
+// of each trade in the DAILY_FINANCING transactions with its estimate. The transactions must start before
+// the trades were opened
+func (r *Reconciler) Reconcile(transactions []models.Transaction) []Reconciliation {
+	instruments := make(map[string]models.Instrument)
+	for _, instrument := range r.Instruments {
+		instruments[instrument.Name] = instrument
+	}
+	units := make(map[string]int64)
+
+	var reconciliations []Reconciliation
+	for _, t := range transactions {
+		switch t.Type {
+		case models.TransactionTypeOrderFill:
+			if t.TradeOpened != nil {
+				units[t.TradeOpened.TradeID] = t.TradeOpened.Units
+			}
+			// the units reduced have the sign of the fill, opposite to the trade
+			if t.TradeReduced != nil {
+				units[t.TradeReduced.TradeID] += t.TradeReduced.Units
+			}
+			for _, closed := range t.TradesClosed {
+				delete(units, closed.TradeID)
+			}
+		case models.TransactionTypeDailyFinancing:
+			for _, position := range t.PositionFinancings {
+				for _, trade := range position.OpenTradeFinancings {
+					instrument := instruments[position.Instrument]
+					instrument.Name = position.Instrument
+					reconciliations = append(reconciliations, r.reconcile(&t, instrument, trade, units[trade.TradeID]))
+				}
+			}
+		}
+	}
+	return reconciliations
+}
+
+func (r *Reconciler) reconcile(t *models.Transaction, instrument models.Instrument, trade models.OpenTradeFinancing, units int64) Reconciliation {
+	reconciliation := Reconciliation{
+		TransactionID: t.ID,
+		Time:          t.Time,
+		Instrument:    instrument.Name,
+		TradeID:       trade.TradeID,
+		Units:         units,
+		Actual:        trade.Financing,
+	}
+	if r.Price != nil {
+		var price float64
+		if price, reconciliation.Priced = r.Price(instrument.Name, t.Time); reconciliation.Priced {
+			position := Position{Instrument: instrument, Units: units, Price: price}
+			if r.HomeConversion != nil {
+				position.HomeConversion = r.HomeConversion(instrument.Name, t.Time)
+			}
+			reconciliation.Expected = Daily(position, t.Time)
+		}
+	}
+	reconciliation.Difference = reconciliation.Actual - reconciliation.Expected.Amount
+	return reconciliation
+}
+
+// Summary sums the actual and expected financing of reconciliations by instrument, sorted by instrument
+func Summary(reconciliations []Reconciliation) []Reconciliation {
+	byInstrument := make(map[string]*Reconciliation)
+	var names []string
+	for _, r := range reconciliations {
+		sum, ok := byInstrument[r.Instrument]
+		if !ok {
+			sum = &Reconciliation{Instrument: r.Instrument, Priced: true}
+			byInstrument[r.Instrument] = sum
+			names = append(names, r.Instrument)
+		}
+		sum.Actual += r.Actual
+		sum.Expected.Amount += r.Expected.Amount
+		sum.Difference += r.Difference
+		sum.Priced = sum.Priced && r.Priced
+	}
+	sort.Strings(names)
+	summary := make([]Reconciliation, len(names))
+	for i, name := range names {
+		summary[i] = *byInstrument[name]
+	}
+	return summary
+}
@@ -0,0 +1,279 @@
+// Package metrics collects the events of an api.Observer, and exposes them in the Prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/burbru/goanda/api"
+)
+
+// DefaultLatencyBuckets are the upper bounds in seconds of the request latency histogram
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultHeartbeatBuckets are the upper bounds in seconds of the heartbeat gap histogram,
+// OANDA sends a pricing heartbeat every 5 seconds
+var DefaultHeartbeatBuckets = []float64{1, 2.5, 5, 6, 10, 20, 30, 60}
+
+// Prometheus is an api.Observer counting the requests and the stream events. It serves them in the
+// Prometheus text exposition format, with the rate limiter stats, as an http.Handler
+type Prometheus struct {
+	// Namespace prefixes the metric names, goanda when empty
+	Namespace string
+
+	mutex    sync.Mutex
+	requests map[string]*requestStats
+	streams  map[string]*streamStats
+}
+
+// requestStats are the stats of the requests of a method and endpoint
+type requestStats struct {
+	method   string
+	endpoint string
+	codes    map[string]uint64
+	latency  *histogram
+}
+
+// streamStats are the stats of a stream
+type streamStats struct {
+	connects      uint64
+	connectErrors uint64
+	disconnects   uint64
+	heartbeats    *histogram
+	lastHeartbeat time.Time
+	backlog       int
+}
+
+var _ api.Observer = (*Prometheus)(nil)
+
+// NewPrometheus creates an empty Prometheus observer
+func NewPrometheus() *Prometheus {
+	return &Prometheus{
+		requests: make(map[string]*requestStats),
+		streams:  make(map[string]*streamStats),
+	}
+}
+
+// ObserveRequest counts a request by method, endpoint and status code ("error" when no response was received)
+func (p *Prometheus) ObserveRequest(method string, endpoint string, status int, latency time.Duration, err error) {
+	code := "error"
+	if status != 0 {
+		code = strconv.Itoa(status)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	stats := p.requests[method+" "+endpoint]
+	if stats == nil {
+		stats = &requestStats{method: method, endpoint: endpoint, codes: make(map[string]uint64), latency: newHistogram(DefaultLatencyBuckets)}
+		p.requests[method+" "+endpoint] = stats
+	}
+	stats.codes[code]++
+	stats.latency.observe(latency.Seconds())
+}
+
+// ObserveStreamConnect counts the connections of a stream, by result
+func (p *Prometheus) ObserveStreamConnect(stream string, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	stats := p.stream(stream)
+	if err != nil {
+		stats.connectErrors++
+		return
+	}
+	stats.connects++
+	stats.lastHeartbeat = time.Now()
+}
+
+// ObserveStreamDisconnect counts the lost connections of a stream
+func (p *Prometheus) ObserveStreamDisconnect(stream string, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.stream(stream).disconnects++
+}
+
+// ObserveHeartbeat records the gap between the heartbeats of a stream
+func (p *Prometheus) ObserveHeartbeat(stream string, gap time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	stats := p.stream(stream)
+	stats.heartbeats.observe(gap.Seconds())
+	stats.lastHeartbeat = time.Now()
+}
+
+// ObserveBacklog records the last backlog of the channel of a stream
+func (p *Prometheus) ObserveBacklog(stream string, backlog int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.stream(stream).backlog = backlog
+}
+
+func (p *Prometheus) stream(stream string) *streamStats {
+	stats := p.streams[stream]
+	if stats == nil {
+		stats = &streamStats{heartbeats: newHistogram(DefaultHeartbeatBuckets)}
+		p.streams[stream] = stats
+	}
+	return stats
+}
+
+// ServeHTTP writes the metrics, to be scraped by Prometheus
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (p *Prometheus) WriteTo(w io.Writer) (int64, error) {
+	namespace := p.Namespace
+	if namespace == "" {
+		namespace = "goanda"
+	}
+	e := &exposition{namespace: namespace}
+
+	p.mutex.Lock()
+	requests := make([]*requestStats, 0, len(p.requests))
+	for _, stats := range p.requests {
+		requests = append(requests, stats)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].endpoint != requests[j].endpoint {
+			return requests[i].endpoint < requests[j].endpoint
+		}
+		return requests[i].method < requests[j].method
+	})
+	streams := make([]string, 0, len(p.streams))
+	for stream := range p.streams {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+
+	e.header("requests_total", "counter", "REST requests by method, endpoint and status code.")
+	for _, stats := range requests {
+		codes := make([]string, 0, len(stats.codes))
+		for code := range stats.codes {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			e.sample("requests_total", labels("method", stats.method, "endpoint", stats.endpoint, "code", code), float64(stats.codes[code]))
+		}
+	}
+	e.header("request_duration_seconds", "histogram", "Latency of the REST requests.")
+	for _, stats := range requests {
+		e.histogram("request_duration_seconds", labels("method", stats.method, "endpoint", stats.endpoint), stats.latency)
+	}
+	e.header("stream_connects_total", "counter", "Stream connections by result, a stream reconnects after each disconnect.")
+	for _, stream := range streams {
+		e.sample("stream_connects_total", labels("stream", stream, "result", "success"), float64(p.streams[stream].connects))
+		e.sample("stream_connects_total", labels("stream", stream, "result", "error"), float64(p.streams[stream].connectErrors))
+	}
+	e.header("stream_disconnects_total", "counter", "Lost stream connections.")
+	for _, stream := range streams {
+		e.sample("stream_disconnects_total", labels("stream", stream), float64(p.streams[stream].disconnects))
+	}
+	e.header("stream_heartbeat_gap_seconds", "histogram", "Gaps between the heartbeats of the streams.")
+	for _, stream := range streams {
+		e.histogram("stream_heartbeat_gap_seconds", labels("stream", stream), p.streams[stream].heartbeats)
+	}
+	e.header("stream_last_heartbeat_timestamp_seconds", "gauge", "Time of the last heartbeat or connection of the streams.")
+	for _, stream := range streams {
+		if last := p.streams[stream].lastHeartbeat; !last.IsZero() {
+			e.sample("stream_last_heartbeat_timestamp_seconds", labels("stream", stream), float64(last.UnixNano())/1e9)
+		}
+	}
+	e.header("stream_backlog", "gauge", "Messages waiting in the channel of the streams.")
+	for _, stream := range streams {
+		e.sample("stream_backlog", labels("stream", stream), float64(p.streams[stream].backlog))
+	}
+	p.mutex.Unlock()
+
+	stats := api.RateLimitStats()
+	e.header("ratelimit_requests_total", "counter", "Requests which took a token of the rate limiter.")
+	e.sample("ratelimit_requests_total", "", float64(stats.Requests))
+	e.header("ratelimit_waits_total", "counter", "Requests which waited for a token of the rate limiter.")
+	e.sample("ratelimit_waits_total", "", float64(stats.Waits))
+	e.header("ratelimit_wait_seconds_total", "counter", "Time spent waiting for the rate limiter.")
+	e.sample("ratelimit_wait_seconds_total", "", stats.TotalWait.Seconds())
+	e.header("ratelimit_throttled_total", "counter", "Requests answered by HTTP 429.")
+	e.sample("ratelimit_throttled_total", "", float64(stats.Throttled))
+
+	n, err := io.WriteString(w, e.String())
+	return int64(n), err
+}
+
+// histogram is a cumulative histogram with fixed buckets
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// exposition builds a text exposition
+type exposition struct {
+	strings.Builder
+	namespace string
+}
+
+func (e *exposition) header(name string, metricType string, help string) {
+	fmt.Fprintf(e, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", e.namespace, name, help, e.namespace, name, metricType)
+}
+
+func (e *exposition) sample(name string, labels string, value float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(e, "%s_%s%s %s\n", e.namespace, name, labels, formatValue(value))
+}
+
+func (e *exposition) histogram(name string, labels string, h *histogram) {
+	prefix := labels
+	if prefix != "" {
+		prefix += ","
+	}
+	for i, bound := range h.bounds {
+		e.sample(name+"_bucket", prefix+`le="`+formatValue(bound)+`"`, float64(h.counts[i]))
+	}
+	e.sample(name+"_bucket", prefix+`le="+Inf"`, float64(h.count))
+	e.sample(name+"_sum", labels, h.sum)
+	e.sample(name+"_count", labels, float64(h.count))
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats alternating label names and values
+func labels(pairs ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+`="`+labelEscaper.Replace(pairs[i+1])+`"`)
+	}
+	return strings.Join(parts, ",")
+}
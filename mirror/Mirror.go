@@ -0,0 +1,614 @@
+// Package mirror keeps an always current in-memory view of an OANDA account: it is bootstrapped from
+// the account details, follows the transactions and the account changes, and revalues the open trades
+// at the streamed prices
+package mirror
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+)
+
+// DefaultPollInterval is the interval of the account changes polling of Run
+const DefaultPollInterval = 5 * time.Second
+
+// Config is the configuration of a Mirror
+type Config struct {
+	// PollInterval is the interval of the account changes polling of Run, DefaultPollInterval if zero
+	PollInterval time.Duration
+	// Instruments are the instruments of the account, for their margin rate and currencies.
+	// The margin rate of the account is used for the other instruments
+	Instruments []models.Instrument
+	// HomeConversion returns the factor converting an amount in the quote currency of an instrument to the
+	// currency of the account, 0 when unknown. When nil, it is derived from the prices of the instruments
+	// mirrored
+	HomeConversion func(instrument string) float64
+}
+
+// The kinds of Change
+const (
+	ChangeBootstrap   = "BOOTSTRAP"
+	ChangeTransaction = "TRANSACTION"
+	ChangeSync        = "SYNC"
+	ChangePrice       = "PRICE"
+	ChangeError       = "ERROR"
+)
+
+// Change is a change of the state of a Mirror
+type Change struct {
+	Kind string
+	// Transaction is the transaction applied by a TRANSACTION change
+	Transaction *models.Transaction
+	// Instrument is the instrument revalued by a PRICE change
+	Instrument string
+	// Err is the error of the bootstrap or of the sync of an ERROR change
+	Err error
+	// Snapshot is the state of the account after the change
+	Snapshot Snapshot
+}
+
+// Snapshot is a copy of the state of the account, the trades and orders are sorted by ID and
+// the positions by instrument
+type Snapshot struct {
+	Time      time.Time
+	Summary   models.AccountSummary
+	Trades    []models.Trade
+	Orders    []models.Order
+	Positions []models.Position
+	// Unconverted are the instruments whose trades keep the values of the server, as no conversion of
+	// their quote currency to the currency of the account is known
+	Unconverted []string
+}
+
+// Mirror is an in-memory view of an account, safe for concurrent use
+type Mirror struct {
+	client      *api.API
+	config      Config
+	instruments map[string]models.Instrument
+
+	mutex        sync.RWMutex
+	bootstrapped bool
+	updated      time.Time
+	summary      models.AccountSummary
+	trades       map[string]*models.Trade
+	orders       map[string]*models.Order
+	positions    map[string]*models.Position
+	prices       map[string]models.ClientPrice
+	unconverted  []string
+	// syncedID is the last transaction of the account changes, applied the transactions applied since
+	// and lastID the greatest of them
+	syncedID string
+	applied  map[int64]bool
+	lastID   int64
+
+	listenersMutex sync.Mutex
+	listeners      []func(Change)
+	syncs          chan struct{}
+}
+
+// New creates a Mirror of the account of an api instance, it must be bootstrapped before use
+func New(client *api.API, config Config) *Mirror {
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	m := &Mirror{
+		client:      client,
+		config:      config,
+		instruments: make(map[string]models.Instrument),
+		trades:      make(map[string]*models.Trade),
+		orders:      make(map[string]*models.Order),
+		positions:   make(map[string]*models.Position),
+		prices:      make(map[string]models.ClientPrice),
+		syncs:       make(chan struct{}, 1),
+	}
+	for _, instrument := range config.Instruments {
+		m.instruments[instrument.Name] = instrument
+	}
+	return m
+}
+
+// OnChange registers a listener called after each change, outside of the lock of the Mirror
+func (m *Mirror) OnChange(f func(Change)) {
+	m.listenersMutex.Lock()
+	defer m.listenersMutex.Unlock()
+	m.listeners = append(m.listeners, f)
+}
+
+// Bootstrap loads the state of the account from the account details, discarding the current state
+func (m *Mirror) Bootstrap() error {
+	details, err := m.client.GetAccountDetails()
+	if err != nil {
+		m.notify(Change{Kind: ChangeError, Err: err})
+		return err
+	}
+
+	m.mutex.Lock()
+	m.summary = details.AccountSummary
+	m.trades = make(map[string]*models.Trade)
+	for _, trade := range details.Trades {
+		trade := trade
+		m.trades[trade.ID] = &trade
+	}
+	m.orders = make(map[string]*models.Order)
+	for _, order := range details.Orders {
+		order := order
+		m.orders[order.ID] = &order
+	}
+	m.positions = make(map[string]*models.Position)
+	for _, position := range details.Positions {
+		position := position
+		m.positions[position.Instrument] = &position
+	}
+	m.syncedID = details.LastTransactionID
+	m.applied = make(map[int64]bool)
+	m.lastID = transactionID(details.LastTransactionID)
+	m.bootstrapped = true
+	m.revalue()
+	change := Change{Kind: ChangeBootstrap, Snapshot: m.snapshot()}
+	m.mutex.Unlock()
+
+	m.notify(change)
+	return nil
+}
+
+// ApplyTransaction applies a transaction of the account, as received from the transaction stream.
+// The transactions already applied, or received before the bootstrap, are ignored
+func (m *Mirror) ApplyTransaction(transaction models.Transaction) {
+	m.mutex.Lock()
+	if !m.bootstrapped || !m.apply(&transaction) {
+		m.mutex.Unlock()
+		return
+	}
+	m.revalue()
+	change := Change{Kind: ChangeTransaction, Transaction: &transaction, Snapshot: m.snapshot()}
+	m.mutex.Unlock()
+
+	m.notify(change)
+	m.requestSync()
+}
+
+// Sync applies the account changes since the last sync, it bootstraps the Mirror on its first call
+func (m *Mirror) Sync() error {
+	m.mutex.RLock()
+	bootstrapped, since := m.bootstrapped, m.syncedID
+	m.mutex.RUnlock()
+	if !bootstrapped {
+		return m.Bootstrap()
+	}
+
+	response, err := m.client.GetAccountChanges(since)
+	if err != nil {
+		m.notify(Change{Kind: ChangeError, Err: err})
+		return err
+	}
+
+	m.mutex.Lock()
+	if m.syncedID != since {
+		// a concurrent sync already applied these changes
+		m.mutex.Unlock()
+		return nil
+	}
+	changes := &response.Changes
+	for i := range changes.Transactions {
+		m.apply(&changes.Transactions[i])
+	}
+	for _, orders := range [][]models.Order{changes.OrdersCreated, changes.OrdersTriggered} {
+		for _, order := range orders {
+			order := order
+			if order.State == models.OrderStatePending {
+				m.orders[order.ID] = &order
+			} else {
+				delete(m.orders, order.ID)
+			}
+		}
+	}
+	for _, orders := range [][]models.Order{changes.OrdersFilled, changes.OrdersCancelled} {
+		for _, order := range orders {
+			delete(m.orders, order.ID)
+		}
+	}
+	for _, trades := range [][]models.Trade{changes.TradesOpened, changes.TradesReduced, changes.TradesClosed} {
+		for _, trade := range trades {
+			trade := trade
+			if trade.State == models.TradeStateClosed {
+				delete(m.trades, trade.ID)
+			} else {
+				m.trades[trade.ID] = &trade
+			}
+		}
+	}
+	for _, position := range changes.Positions {
+		position := position
+		m.positions[position.Instrument] = &position
+	}
+	state := &response.State
+	for _, calculated := range state.Trades {
+		if trade := m.trades[calculated.ID]; trade != nil {
+			trade.UnrealizedPL = calculated.UnrealizedPL
+			trade.MarginUsed = calculated.MarginUsed
+		}
+	}
+	if response.LastTransactionID != "" {
+		m.syncedID = response.LastTransactionID
+		for id := range m.applied {
+			if id <= transactionID(m.syncedID) {
+				delete(m.applied, id)
+			}
+		}
+	}
+	m.revalue()
+	change := Change{Kind: ChangeSync, Snapshot: m.snapshot()}
+	m.mutex.Unlock()
+
+	m.notify(change)
+	return nil
+}
+
+// UpdatePrice revalues the open trades of an instrument at a price
+func (m *Mirror) UpdatePrice(price models.ClientPrice) {
+	if len(price.Bids) == 0 || len(price.Asks) == 0 {
+		return
+	}
+	m.mutex.Lock()
+	m.prices[price.Instrument] = price
+	if !m.bootstrapped {
+		m.mutex.Unlock()
+		return
+	}
+	m.revalue()
+	change := Change{Kind: ChangePrice, Instrument: price.Instrument, Snapshot: m.snapshot()}
+	m.mutex.Unlock()
+
+	m.notify(change)
+}
+
+// Snapshot returns a copy of the current state of the account
+func (m *Mirror) Snapshot() Snapshot {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.snapshot()
+}
+
+// Run bootstraps the Mirror and syncs it every PollInterval, and after each transaction applied,
+// until ctx is done. The errors of the syncs are notified as ERROR changes, the polling goes on
+func (m *Mirror) Run(ctx context.Context) error {
+	m.mutex.RLock()
+	bootstrapped := m.bootstrapped
+	m.mutex.RUnlock()
+	if !bootstrapped {
+		if err := m.Bootstrap(); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(m.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-m.syncs:
+		}
+		m.Sync()
+	}
+}
+
+// StreamTransactions starts a transaction stream and applies its transactions, a heartbeat announcing
+// transactions not received yet requests a sync. It blocks, as the stream does
+func (m *Mirror) StreamTransactions(streamApi *api.TransactionStreamAPI) {
+	transactions := make(chan models.Transaction, 100)
+	heartbeats := make(chan models.TransactionHeartbeat, 10)
+	streamApi.StartTransactionStream(transactions, heartbeats)
+
+	for {
+		select {
+		case transaction := <-transactions:
+			m.ApplyTransaction(transaction)
+		case heartbeat := <-heartbeats:
+			m.mutex.RLock()
+			behind := transactionID(heartbeat.LastTransactionID) > m.lastID
+			m.mutex.RUnlock()
+			if behind {
+				m.requestSync()
+			}
+		}
+	}
+}
+
+// StreamPrices starts a pricing stream for instruments and revalues the account with its prices.
+// It blocks until the server refuses the stream, as api.StreamAPI.StreamPrices does
+func (m *Mirror) StreamPrices(streamApi *api.StreamAPI, instruments []string) error {
+	return streamApi.StreamPrices(instruments, m.UpdatePrice, nil)
+}
+
+// requestSync asks Run for a sync, without waiting
+func (m *Mirror) requestSync() {
+	select {
+	case m.syncs <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Mirror) notify(change Change) {
+	m.listenersMutex.Lock()
+	listeners := make([]func(Change), len(m.listeners))
+	copy(listeners, m.listeners)
+	m.listenersMutex.Unlock()
+	for _, f := range listeners {
+		f(change)
+	}
+}
+
+// apply applies the effects of a transaction on the balance, orders and trades, and reports whether
+// it was applied, each transaction is applied once even when it is received from the stream after a
+// transaction missed. The positions and the price dependent values are rebuilt by revalue
+func (m *Mirror) apply(t *models.Transaction) bool {
+	id := transactionID(t.ID)
+	if id <= transactionID(m.syncedID) || m.applied[id] {
+		return false
+	}
+	m.applied[id] = true
+	latest := id > m.lastID
+	if latest {
+		m.lastID = id
+		m.summary.LastTransactionID = t.ID
+	}
+
+	switch t.Type {
+	case models.TransactionTypeOrderFill, models.TransactionTypeDailyFinancing, models.TransactionTypeTransferFunds:
+		if latest {
+			m.summary.Balance = t.AccountBalance
+		}
+		m.summary.PL += t.PL
+		m.summary.Financing += t.Financing
+		m.summary.Commission += t.Commission
+	}
+
+	switch {
+	case t.Type == models.TransactionTypeOrderFill:
+		delete(m.orders, t.OrderID)
+		m.position(t.Instrument).PL += t.PL
+		if opened := t.TradeOpened; opened != nil {
+			m.trades[opened.TradeID] = &models.Trade{
+				ID:               opened.TradeID,
+				Instrument:       t.Instrument,
+				Price:            opened.Price,
+				OpenTime:         t.Time,
+				State:            models.TradeStateOpen,
+				InitialUnits:     opened.Units,
+				CurrentUnits:     opened.Units,
+				ClientExtensions: opened.ClientExtensions,
+			}
+		}
+		if reduced := t.TradeReduced; reduced != nil {
+			if trade := m.trades[reduced.TradeID]; trade != nil {
+				trade.CurrentUnits -= int64(math.Copysign(float64(abs(reduced.Units)), float64(trade.CurrentUnits)))
+				trade.RealizedPL += reduced.RealizedPL
+				trade.Financing += reduced.Financing
+			}
+		}
+		for _, closed := range t.TradesClosed {
+			delete(m.trades, closed.TradeID)
+		}
+	case t.Type == models.TransactionTypeOrderCancel:
+		delete(m.orders, t.OrderID)
+	case t.Type == models.TransactionTypeDailyFinancing:
+		for _, financing := range t.PositionFinancings {
+			m.position(financing.Instrument).Financing += financing.Financing
+			for _, tradeFinancing := range financing.OpenTradeFinancings {
+				if trade := m.trades[tradeFinancing.TradeID]; trade != nil {
+					trade.Financing += tradeFinancing.Financing
+				}
+			}
+		}
+	case strings.HasSuffix(t.Type, "_ORDER"):
+		order := orderFromTransaction(t)
+		m.orders[order.ID] = &order
+		if trade := m.trades[order.TradeID]; trade != nil {
+			switch order.Type {
+			case models.OrderTypeTakeProfit:
+				trade.TakeProfitOrderID = order.ID
+			case models.OrderTypeStopLoss:
+				trade.StopLossOrderID = order.ID
+			case models.OrderTypeTrailingStopLoss:
+				trade.TrailingStopLossOrderID = order.ID
+			}
+		}
+	}
+	return true
+}
+
+func (m *Mirror) position(instrument string) *models.Position {
+	position := m.positions[instrument]
+	if position == nil {
+		position = &models.Position{Instrument: instrument}
+		m.positions[instrument] = position
+	}
+	return position
+}
+
+// revalue values the open trades at the last prices, rebuilds the positions from the trades and
+// recomputes the summary. The trades without price or without conversion keep the values of the server
+func (m *Mirror) revalue() {
+	for _, position := range m.positions {
+		position.UnrealizedPL = 0
+		position.MarginUsed = 0
+		position.Long = models.PositionSide{PL: position.Long.PL, ResettablePL: position.Long.ResettablePL}
+		position.Short = models.PositionSide{PL: position.Short.PL, ResettablePL: position.Short.ResettablePL}
+	}
+
+	var unrealizedPL, marginUsed, positionValue float64
+	unconverted := make(map[string]bool)
+	for _, trade := range m.sortedTrades() {
+		price, ok := m.prices[trade.Instrument]
+		var conversion float64
+		if ok {
+			if conversion, ok = m.conversion(trade.Instrument); !ok {
+				unconverted[trade.Instrument] = true
+			}
+		}
+		if ok {
+			closePrice := price.Bids[0].Price
+			if trade.CurrentUnits < 0 {
+				closePrice = price.Asks[0].Price
+			}
+			value := math.Abs(float64(trade.CurrentUnits)) * mid(price) * conversion
+			trade.UnrealizedPL = float64(trade.CurrentUnits) * (closePrice - trade.Price) * conversion
+			trade.MarginUsed = value * m.marginRate(trade.Instrument)
+			positionValue += value
+		} else if rate := m.marginRate(trade.Instrument); rate > 0 {
+			positionValue += trade.MarginUsed / rate
+		}
+		unrealizedPL += trade.UnrealizedPL
+		marginUsed += trade.MarginUsed
+
+		position := m.position(trade.Instrument)
+		side := &position.Long
+		if trade.CurrentUnits < 0 {
+			side = &position.Short
+		}
+		units := side.Units + trade.CurrentUnits
+		if units != 0 {
+			side.AveragePrice = (side.AveragePrice*float64(side.Units) + trade.Price*float64(trade.CurrentUnits)) / float64(units)
+		}
+		side.Units = units
+		side.TradeIDs = append(side.TradeIDs, trade.ID)
+		side.UnrealizedPL += trade.UnrealizedPL
+		position.UnrealizedPL += trade.UnrealizedPL
+		position.MarginUsed += trade.MarginUsed
+	}
+
+	openPositions := 0
+	for instrument, position := range m.positions {
+		if position.Long.Units == 0 && position.Short.Units == 0 {
+			// the realized P/L and financing of a closed position are kept in the summary only
+			delete(m.positions, instrument)
+			continue
+		}
+		openPositions++
+	}
+
+	m.summary.UnrealizedPL = unrealizedPL
+	m.summary.NAV = m.summary.Balance + unrealizedPL
+	m.summary.MarginUsed = marginUsed
+	m.summary.MarginAvailable = math.Max(0, m.summary.NAV-marginUsed)
+	m.summary.PositionValue = positionValue
+	m.summary.OpenTradeCount = len(m.trades)
+	m.summary.OpenPositionCount = openPositions
+	m.summary.PendingOrderCount = len(m.orders)
+	m.unconverted = m.unconverted[:0]
+	for instrument := range unconverted {
+		m.unconverted = append(m.unconverted, instrument)
+	}
+	sort.Strings(m.unconverted)
+	m.updated = time.Now()
+}
+
+// marginRate is the greatest of the margin rates of the instrument and of the account
+func (m *Mirror) marginRate(instrument string) float64 {
+	return math.Max(float64(m.instruments[instrument].MarginRate), m.summary.MarginRate)
+}
+
+// conversion returns the factor converting an amount in the quote currency of an instrument to the currency
+// of the account, false when it is not known
+func (m *Mirror) conversion(instrument string) (float64, bool) {
+	if m.config.HomeConversion != nil {
+		conversion := m.config.HomeConversion(instrument)
+		return conversion, conversion > 0
+	}
+	currencies := strings.Split(instrument, "_")
+	home := m.summary.Currency
+	if len(currencies) != 2 || home == "" || currencies[1] == home {
+		return 1, true
+	}
+	quote := currencies[1]
+	if price, ok := m.prices[quote+"_"+home]; ok {
+		return mid(price), true
+	}
+	if price, ok := m.prices[home+"_"+quote]; ok {
+		return 1 / mid(price), true
+	}
+	return 0, false
+}
+
+func (m *Mirror) sortedTrades() []*models.Trade {
+	trades := make([]*models.Trade, 0, len(m.trades))
+	for _, trade := range m.trades {
+		trades = append(trades, trade)
+	}
+	sort.Slice(trades, func(i, j int) bool {
+		return transactionID(trades[i].ID) < transactionID(trades[j].ID)
+	})
+	return trades
+}
+
+func (m *Mirror) snapshot() Snapshot {
+	snapshot := Snapshot{
+		Time:        m.updated,
+		Summary:     m.summary,
+		Trades:      make([]models.Trade, 0, len(m.trades)),
+		Orders:      make([]models.Order, 0, len(m.orders)),
+		Positions:   make([]models.Position, 0, len(m.positions)),
+		Unconverted: append([]string(nil), m.unconverted...),
+	}
+	for _, trade := range m.sortedTrades() {
+		snapshot.Trades = append(snapshot.Trades, *trade)
+	}
+	for _, order := range m.orders {
+		snapshot.Orders = append(snapshot.Orders, *order)
+	}
+	sort.Slice(snapshot.Orders, func(i, j int) bool {
+		return transactionID(snapshot.Orders[i].ID) < transactionID(snapshot.Orders[j].ID)
+	})
+	for _, position := range m.positions {
+		snapshot.Positions = append(snapshot.Positions, *position)
+	}
+	sort.Slice(snapshot.Positions, func(i, j int) bool {
+		return snapshot.Positions[i].Instrument < snapshot.Positions[j].Instrument
+	})
+	return snapshot
+}
+
+// orderFromTransaction builds the pending order created by an order transaction
+func orderFromTransaction(t *models.Transaction) models.Order {
+	createTime := t.Time
+	return models.Order{
+		ID:               t.ID,
+		State:            models.OrderStatePending,
+		CreateTime:       &createTime,
+		Units:            t.Units,
+		Instrument:       t.Instrument,
+		TimeInForce:      t.TimeInForce,
+		Type:             strings.TrimSuffix(t.Type, "_ORDER"),
+		PositionFill:     t.PositionFill,
+		Price:            t.Price,
+		PriceBound:       t.PriceBound,
+		Distance:         t.Distance,
+		TradeID:          t.TradeID,
+		ClientExtensions: t.ClientExtensions,
+	}
+}
+
+func transactionID(id string) int64 {
+	n, _ := strconv.ParseInt(id, 10, 64)
+	return n
+}
+
+func mid(price models.ClientPrice) float64 {
+	return (price.Bids[0].Price + price.Asks[0].Price) / 2
+}
+
+func abs(units int64) int64 {
+	if units < 0 {
+		return -units
+	}
+	return units
+}
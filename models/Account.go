@@ -1,9 +1,12 @@
 package models
 
-// Account implementation
+import "time"
+
+// Account is the properties of an account, as listed by the GET Accounts endpoint
 type Account struct {
-	ID string `json:"id"`
-	// only ID is implemented at this stage
+	ID           string   `json:"id"`
+	MT4AccountID int      `json:"mt4AccountID,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
 }
 
 // Accounts is the structure returned by GET Accounts endpoint
@@ -22,3 +25,76 @@ type AccountPosition struct {
 	LastTransactionID string   `json:"lastTransactionID"`
 	Position          Position `json:"position"`
 }
+
+// AccountSummary is the summary of an account state
+type AccountSummary struct {
+	ID                string    `json:"id"`
+	Alias             string    `json:"alias,omitempty"`
+	Currency          string    `json:"currency"`
+	Balance           float64   `json:"balance,string"`
+	NAV               float64   `json:"NAV,string"`
+	UnrealizedPL      float64   `json:"unrealizedPL,string"`
+	PL                float64   `json:"pl,string"`
+	Financing         float64   `json:"financing,string"`
+	Commission        float64   `json:"commission,string"`
+	MarginRate        float64   `json:"marginRate,string"`
+	MarginUsed        float64   `json:"marginUsed,string"`
+	MarginAvailable   float64   `json:"marginAvailable,string"`
+	PositionValue     float64   `json:"positionValue,string"`
+	OpenTradeCount    int       `json:"openTradeCount"`
+	OpenPositionCount int       `json:"openPositionCount"`
+	PendingOrderCount int       `json:"pendingOrderCount"`
+	LastTransactionID string    `json:"lastTransactionID"`
+	CreatedTime       time.Time `json:"createdTime"`
+}
+
+// AccountSummaryResponse is the structure returned by GET Account Summary endpoint
+type AccountSummaryResponse struct {
+	Account           AccountSummary `json:"account"`
+	LastTransactionID string         `json:"lastTransactionID"`
+}
+
+// AccountDetails is the full state of an account: its summary, open trades, pending orders and positions
+type AccountDetails struct {
+	AccountSummary
+	Trades    []Trade    `json:"trades"`
+	Orders    []Order    `json:"orders"`
+	Positions []Position `json:"positions"`
+}
+
+// AccountDetailsResponse is the structure returned by GET Account endpoint
+type AccountDetailsResponse struct {
+	Account           AccountDetails `json:"account"`
+	LastTransactionID string         `json:"lastTransactionID"`
+}
+
+// AccountChanges are the orders, trades, positions and transactions of an account changed since a transaction
+type AccountChanges struct {
+	OrdersCreated   []Order       `json:"ordersCreated"`
+	OrdersCancelled []Order       `json:"ordersCancelled"`
+	OrdersFilled    []Order       `json:"ordersFilled"`
+	OrdersTriggered []Order       `json:"ordersTriggered"`
+	TradesOpened    []Trade       `json:"tradesOpened"`
+	TradesReduced   []Trade       `json:"tradesReduced"`
+	TradesClosed    []Trade       `json:"tradesClosed"`
+	Positions       []Position    `json:"positions"`
+	Transactions    []Transaction `json:"transactions"`
+}
+
+// AccountChangesState is the price dependent state of an account
+type AccountChangesState struct {
+	UnrealizedPL    float64                   `json:"unrealizedPL,string"`
+	NAV             float64                   `json:"NAV,string"`
+	MarginUsed      float64                   `json:"marginUsed,string"`
+	MarginAvailable float64                   `json:"marginAvailable,string"`
+	PositionValue   float64                   `json:"positionValue,string"`
+	Trades          []CalculatedTradeState    `json:"trades"`
+	Positions       []CalculatedPositionState `json:"positions"`
+}
+
+// AccountChangesResponse is the structure returned by GET Account Changes endpoint
+type AccountChangesResponse struct {
+	Changes           AccountChanges      `json:"changes"`
+	State             AccountChangesState `json:"state"`
+	LastTransactionID string              `json:"lastTransactionID"`
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 )
 
 type Instrument struct {
@@ -68,6 +69,45 @@ type FinancingDay struct {
 	DaysCharged int       `json:"daysCharged"`
 }
 
+// DaysCharged returns the number of days of financing charged at the rollover of a weekday,
+// when FinancingDaysOfWeek is not known the usual FX schedule is used (triple charge on Wednesday)
+func (f *Financing) DaysCharged(day time.Weekday) int {
+	if len(f.FinancingDaysOfWeek) == 0 {
+		switch day {
+		case time.Saturday, time.Sunday:
+			return 0
+		case time.Wednesday:
+			return 3
+		}
+		return 1
+	}
+	for _, d := range f.FinancingDaysOfWeek {
+		if d.DayOfWeek.Weekday() == day {
+			return d.DaysCharged
+		}
+	}
+	return 0
+}
+
+// Weekday converts the DayOfWeek to a time.Weekday
+func (d DayOfWeek) Weekday() time.Weekday {
+	switch d {
+	case Monday:
+		return time.Monday
+	case Tuesday:
+		return time.Tuesday
+	case Wednesday:
+		return time.Wednesday
+	case Thursday:
+		return time.Thursday
+	case Friday:
+		return time.Friday
+	case Saturday:
+		return time.Saturday
+	}
+	return time.Sunday
+}
+
 type Instruments struct {
 	Instruments []Instrument `json:"instruments"`
 }
@@ -86,3 +126,8 @@ func (f *Float64String) UnmarshalJSON(data []byte) error {
 	*f = Float64String(value)
 	return nil
 }
+
+// MarshalJSON encodes the value as a string, as the v20 api does
+func (f Float64String) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatFloat(float64(f), 'f', -1, 64))
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"math"
+	"strconv"
+)
+
+// Pip, price and unit arithmetic of an Instrument
+
+// PipSize returns the price distance of a pip: 0.0001 for a PipLocation of -4
+func (i *Instrument) PipSize() float64 {
+	return math.Pow10(i.PipLocation)
+}
+
+// Pips converts a price distance to pips
+func (i *Instrument) Pips(distance float64) float64 {
+	return distance / i.PipSize()
+}
+
+// PipDistance converts pips to a price distance, rounded to the display precision
+func (i *Instrument) PipDistance(pips float64) float64 {
+	return i.RoundPrice(pips * i.PipSize())
+}
+
+// RoundPrice rounds a price or a price distance to the DisplayPrecision of the instrument,
+// OANDA rejects the prices of orders with more decimals
+func (i *Instrument) RoundPrice(price float64) float64 {
+	scale := math.Pow10(i.DisplayPrecision)
+	return math.Round(price*scale) / scale
+}
+
+// FormatPrice formats a price with the DisplayPrecision of the instrument, as the order endpoints accept it
+func (i *Instrument) FormatPrice(price float64) string {
+	precision := i.DisplayPrecision
+	if precision < 0 {
+		precision = 0
+	}
+	return strconv.FormatFloat(i.RoundPrice(price), 'f', precision, 64)
+}
+
+// RoundUnits rounds units toward zero to the TradeUnitsPrecision of the instrument, so that they never
+// exceed the units given
+func (i *Instrument) RoundUnits(units float64) float64 {
+	scale := math.Pow10(i.TradeUnitsPrecision)
+	// the epsilon keeps a float64 error from rounding down a whole number of units
+	return math.Trunc(units*scale+math.Copysign(1e-9, units)) / scale
+}
+
+// FormatUnits formats units with the TradeUnitsPrecision of the instrument, as the order endpoints accept them
+func (i *Instrument) FormatUnits(units float64) string {
+	precision := i.TradeUnitsPrecision
+	if precision < 0 {
+		precision = 0
+	}
+	return strconv.FormatFloat(i.RoundUnits(units), 'f', precision, 64)
+}
+
+// RoundOrder returns a copy of an order of the instrument with its prices and distances, and the ones
+// of its take profit, stop loss and trailing stop loss on fill, rounded to the display precision
+func (i *Instrument) RoundOrder(order Order) Order {
+	order.Price = i.RoundPrice(order.Price)
+	order.PriceBound = i.RoundPrice(order.PriceBound)
+	order.Distance = i.RoundPrice(order.Distance)
+	if order.TakeProfitOnFill != nil {
+		takeProfit := *order.TakeProfitOnFill
+		takeProfit.Price = i.RoundPrice(takeProfit.Price)
+		order.TakeProfitOnFill = &takeProfit
+	}
+	if order.StopLossOnFill != nil {
+		stopLoss := *order.StopLossOnFill
+		stopLoss.Price = i.RoundPrice(stopLoss.Price)
+		stopLoss.Distance = i.RoundPrice(stopLoss.Distance)
+		order.StopLossOnFill = &stopLoss
+	}
+	if order.TrailingStopLossOnFill != nil {
+		trailingStopLoss := *order.TrailingStopLossOnFill
+		trailingStopLoss.Distance = i.RoundPrice(trailingStopLoss.Distance)
+		order.TrailingStopLossOnFill = &trailingStopLoss
+	}
+	return order
+}
@@ -1,14 +1,97 @@
 package models
 
-// Position Definitions
+import "time"
 
-// Order is an order definition
+// Order Definitions
+
+// Order types
+const (
+	OrderTypeMarket           = "MARKET"
+	OrderTypeLimit            = "LIMIT"
+	OrderTypeStop             = "STOP"
+	OrderTypeMarketIfTouched  = "MARKET_IF_TOUCHED"
+	OrderTypeTakeProfit       = "TAKE_PROFIT"
+	OrderTypeStopLoss         = "STOP_LOSS"
+	OrderTypeTrailingStopLoss = "TRAILING_STOP_LOSS"
+)
+
+// Time in force values
+const (
+	TimeInForceGTC = "GTC"
+	TimeInForceGTD = "GTD"
+	TimeInForceGFD = "GFD"
+	TimeInForceFOK = "FOK"
+	TimeInForceIOC = "IOC"
+)
+
+// Position fill values
+const (
+	PositionFillDefault     = "DEFAULT"
+	PositionFillOpenOnly    = "OPEN_ONLY"
+	PositionFillReduceFirst = "REDUCE_FIRST"
+	PositionFillReduceOnly  = "REDUCE_ONLY"
+)
+
+// Order states
+const (
+	OrderStatePending   = "PENDING"
+	OrderStateFilled    = "FILLED"
+	OrderStateTriggered = "TRIGGERED"
+	OrderStateCancelled = "CANCELLED"
+)
+
+// Order is an order definition, used both as request payload and for pending orders
 type Order struct {
-	Units        int64  `json:"units,string"`
-	Instrument   string `json:"instrument"`
-	TimeInForce  string `json:"timeInForce"`
-	Type         string `json:"type"`
-	PositionFill string `json:"positionFill"`
+	ID                     string                   `json:"id,omitempty"`
+	State                  string                   `json:"state,omitempty"`
+	CreateTime             *time.Time               `json:"createTime,omitempty"`
+	Units                  int64                    `json:"units,string,omitempty"`
+	Instrument             string                   `json:"instrument,omitempty"`
+	TimeInForce            string                   `json:"timeInForce"`
+	Type                   string                   `json:"type"`
+	PositionFill           string                   `json:"positionFill,omitempty"`
+	Price                  float64                  `json:"price,string,omitempty"`
+	PriceBound             float64                  `json:"priceBound,string,omitempty"`
+	Distance               float64                  `json:"distance,string,omitempty"`
+	TradeID                string                   `json:"tradeID,omitempty"`
+	GtdTime                *time.Time               `json:"gtdTime,omitempty"`
+	TriggerCondition       string                   `json:"triggerCondition,omitempty"`
+	ClientExtensions       *ClientExtensions        `json:"clientExtensions,omitempty"`
+	TakeProfitOnFill       *TakeProfitDetails       `json:"takeProfitOnFill,omitempty"`
+	StopLossOnFill         *StopLossDetails         `json:"stopLossOnFill,omitempty"`
+	TrailingStopLossOnFill *TrailingStopLossDetails `json:"trailingStopLossOnFill,omitempty"`
+}
+
+// ClientExtensions are the client supplied id, tag and comment of an order or trade
+type ClientExtensions struct {
+	ID      string `json:"id,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// TakeProfitDetails is a take profit order created when the order is filled
+type TakeProfitDetails struct {
+	Price            float64           `json:"price,string"`
+	TimeInForce      string            `json:"timeInForce,omitempty"`
+	GtdTime          *time.Time        `json:"gtdTime,omitempty"`
+	ClientExtensions *ClientExtensions `json:"clientExtensions,omitempty"`
+}
+
+// StopLossDetails is a stop loss order created when the order is filled, at a Price or a Distance
+type StopLossDetails struct {
+	Price            float64           `json:"price,string,omitempty"`
+	Distance         float64           `json:"distance,string,omitempty"`
+	TimeInForce      string            `json:"timeInForce,omitempty"`
+	GtdTime          *time.Time        `json:"gtdTime,omitempty"`
+	ClientExtensions *ClientExtensions `json:"clientExtensions,omitempty"`
+}
+
+// TrailingStopLossDetails is a trailing stop loss order created when the order is filled
+type TrailingStopLossDetails struct {
+	Distance         float64           `json:"distance,string"`
+	TimeInForce      string            `json:"timeInForce,omitempty"`
+	GtdTime          *time.Time        `json:"gtdTime,omitempty"`
+	ClientExtensions *ClientExtensions `json:"clientExtensions,omitempty"`
 }
 
 // OrderRequest is an order payload
@@ -16,13 +99,88 @@ type OrderRequest struct {
 	Order Order `json:"order"`
 }
 
+// OrderCreateResponse is the response of an order creation
+type OrderCreateResponse struct {
+	OrderCreateTransaction *Transaction `json:"orderCreateTransaction,omitempty"`
+	OrderFillTransaction   *Transaction `json:"orderFillTransaction,omitempty"`
+	OrderCancelTransaction *Transaction `json:"orderCancelTransaction,omitempty"`
+	OrderRejectTransaction *Transaction `json:"orderRejectTransaction,omitempty"`
+	RelatedTransactionIDs  []string     `json:"relatedTransactionIDs,omitempty"`
+	LastTransactionID      string       `json:"lastTransactionID,omitempty"`
+	ErrorCode              string       `json:"errorCode,omitempty"`
+	ErrorMessage           string       `json:"errorMessage,omitempty"`
+}
+
+// OrderCancelResponse is the response of an order cancellation
+type OrderCancelResponse struct {
+	OrderCancelTransaction       *Transaction `json:"orderCancelTransaction,omitempty"`
+	OrderCancelRejectTransaction *Transaction `json:"orderCancelRejectTransaction,omitempty"`
+	RelatedTransactionIDs        []string     `json:"relatedTransactionIDs,omitempty"`
+	LastTransactionID            string       `json:"lastTransactionID,omitempty"`
+	ErrorCode                    string       `json:"errorCode,omitempty"`
+	ErrorMessage                 string       `json:"errorMessage,omitempty"`
+}
+
+// OrderResponse is the response of an order lookup
+type OrderResponse struct {
+	Order             Order  `json:"order"`
+	LastTransactionID string `json:"lastTransactionID"`
+}
+
+// Orders is the response of the pending orders endpoint
+type Orders struct {
+	Orders            []Order `json:"orders"`
+	LastTransactionID string  `json:"lastTransactionID"`
+}
+
+// TradeCloseRequest is the payload closing a trade, Units is ALL or a number of units
+type TradeCloseRequest struct {
+	Units string `json:"units"`
+}
+
 // MakeMarketOrder creates a martket Order
 func MakeMarketOrder(instrument string, units int64) Order {
 	return Order{
 		Units:        units,
 		Instrument:   instrument,
-		TimeInForce:  "FOK",
-		Type:         "MARKET",
-		PositionFill: "DEFAULT",
+		TimeInForce:  TimeInForceFOK,
+		Type:         OrderTypeMarket,
+		PositionFill: PositionFillDefault,
+	}
+}
+
+// MakeLimitOrder creates a Limit Order, filled at price or better
+func MakeLimitOrder(instrument string, units int64, price float64) Order {
+	return Order{
+		Units:        units,
+		Instrument:   instrument,
+		Price:        price,
+		TimeInForce:  TimeInForceGTC,
+		Type:         OrderTypeLimit,
+		PositionFill: PositionFillDefault,
+	}
+}
+
+// MakeStopOrder creates a Stop Order, filled when the price reaches price or worse
+func MakeStopOrder(instrument string, units int64, price float64) Order {
+	return Order{
+		Units:        units,
+		Instrument:   instrument,
+		Price:        price,
+		TimeInForce:  TimeInForceGTC,
+		Type:         OrderTypeStop,
+		PositionFill: PositionFillDefault,
+	}
+}
+
+// MakeMarketIfTouchedOrder creates a MarketIfTouched Order, filled at market when the price touches price
+func MakeMarketIfTouchedOrder(instrument string, units int64, price float64) Order {
+	return Order{
+		Units:        units,
+		Instrument:   instrument,
+		Price:        price,
+		TimeInForce:  TimeInForceGTC,
+		Type:         OrderTypeMarketIfTouched,
+		PositionFill: PositionFillDefault,
 	}
 }
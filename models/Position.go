@@ -4,9 +4,13 @@ package models
 
 // Position is a position in an account
 type Position struct {
-	Instrument string       `json:"instrument"`
-	Long       PositionSide `json:"long"`
-	Short      PositionSide `json:"short"`
+	Instrument   string       `json:"instrument"`
+	PL           float64      `json:"pl,string"`
+	UnrealizedPL float64      `json:"unrealizedPL,string"`
+	MarginUsed   float64      `json:"marginUsed,string"`
+	Financing    float64      `json:"financing,string"`
+	Long         PositionSide `json:"long"`
+	Short        PositionSide `json:"short"`
 }
 
 // PositionSide is a Position for a single direction
@@ -20,3 +24,12 @@ type PositionSide struct {
 }
 
 // CalculatedPositionSide Not Implemented
+
+// CalculatedPositionState is the price dependent state of a Position
+type CalculatedPositionState struct {
+	Instrument        string  `json:"instrument"`
+	NetUnrealizedPL   float64 `json:"netUnrealizedPL,string"`
+	LongUnrealizedPL  float64 `json:"longUnrealizedPL,string"`
+	ShortUnrealizedPL float64 `json:"shortUnrealizedPL,string"`
+	MarginUsed        float64 `json:"marginUsed,string"`
+}
@@ -13,6 +13,8 @@ type ClientPrice struct {
 	Time       time.Time     `json:"time"`
 	Bids       []PriceBucket `json:"bids"`
 	Asks       []PriceBucket `json:"asks"`
+	// Tradeable is false when OANDA does not accept orders at the price, nil when it is not known
+	Tradeable *bool `json:"tradeable,omitempty"`
 }
 
 // PricingHeartbeat is a heartbeat to keep connection alive
@@ -23,7 +25,18 @@ type PricingHeartbeat struct {
 
 // Prices is the object response from GetPricing call
 type Prices struct {
-	Prices []ClientPrice `json:"prices"`
+	Prices          []ClientPrice     `json:"prices"`
+	HomeConversions []HomeConversions `json:"homeConversions,omitempty"`
+	Time            time.Time         `json:"time"`
+}
+
+// HomeConversions are the factors converting an amount in a currency to the account currency,
+// for a gain, a loss and a position value
+type HomeConversions struct {
+	Currency      string  `json:"currency"`
+	AccountGain   float64 `json:"accountGain,string"`
+	AccountLoss   float64 `json:"accountLoss,string"`
+	PositionValue float64 `json:"positionValue,string"`
 }
 
 // Candles is the object returns by the GetCandles call
@@ -15,12 +15,23 @@ func (tick *Tick) Price() float64 {
 	return (tick.Ask + tick.Bid) / 2
 }
 
-// ClientPrice2Tick converts a ClientPrice to a Tick, by taking the first Bid and Ask
+// Complete reports whether the Tick has both a Bid and an Ask
+func (tick *Tick) Complete() bool {
+	return tick.Bid != 0 && tick.Ask != 0
+}
+
+// ClientPrice2Tick converts a ClientPrice to a Tick, by taking the first Bid and Ask.
+// The Bid or Ask is zero when the price has no bids or no asks, see Complete
 func ClientPrice2Tick(price *ClientPrice) Tick {
-	return Tick{
+	tick := Tick{
 		Instrument: price.Instrument,
 		Time:       price.Time,
-		Bid:        (*price).Bids[0].Price,
-		Ask:        (*price).Asks[0].Price,
 	}
+	if len(price.Bids) > 0 {
+		tick.Bid = price.Bids[0].Price
+	}
+	if len(price.Asks) > 0 {
+		tick.Ask = price.Asks[0].Price
+	}
+	return tick
 }
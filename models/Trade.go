@@ -0,0 +1,47 @@
+package models
+
+// Trade Definitions
+
+import "time"
+
+// Trade states
+const (
+	TradeStateOpen               = "OPEN"
+	TradeStateClosed             = "CLOSED"
+	TradeStateCloseWhenTradeable = "CLOSE_WHEN_TRADEABLE"
+)
+
+// Trade is a Trade of an account, open or closed
+type Trade struct {
+	ID                      string            `json:"id"`
+	Instrument              string            `json:"instrument"`
+	Price                   float64           `json:"price,string"`
+	OpenTime                time.Time         `json:"openTime"`
+	State                   string            `json:"state"`
+	InitialUnits            int64             `json:"initialUnits,string"`
+	CurrentUnits            int64             `json:"currentUnits,string"`
+	RealizedPL              float64           `json:"realizedPL,string"`
+	UnrealizedPL            float64           `json:"unrealizedPL,string"`
+	MarginUsed              float64           `json:"marginUsed,string"`
+	AverageClosePrice       float64           `json:"averageClosePrice,string,omitempty"`
+	ClosingTransactionIDs   []string          `json:"closingTransactionIDs,omitempty"`
+	Financing               float64           `json:"financing,string"`
+	CloseTime               *time.Time        `json:"closeTime,omitempty"`
+	ClientExtensions        *ClientExtensions `json:"clientExtensions,omitempty"`
+	TakeProfitOrderID       string            `json:"takeProfitOrderID,omitempty"`
+	StopLossOrderID         string            `json:"stopLossOrderID,omitempty"`
+	TrailingStopLossOrderID string            `json:"trailingStopLossOrderID,omitempty"`
+}
+
+// Trades is the object response from GetOpenTrades call
+type Trades struct {
+	Trades            []Trade `json:"trades"`
+	LastTransactionID string  `json:"lastTransactionID"`
+}
+
+// CalculatedTradeState is the price dependent state of an open Trade
+type CalculatedTradeState struct {
+	ID           string  `json:"id"`
+	UnrealizedPL float64 `json:"unrealizedPL,string"`
+	MarginUsed   float64 `json:"marginUsed,string"`
+}
@@ -6,15 +6,128 @@ import (
 	"time"
 )
 
-// Transaction is a Generic Transaction, just with an ID at the moment
+// Transaction types
+const (
+	TransactionTypeCreate                     = "CREATE"
+	TransactionTypeTransferFunds              = "TRANSFER_FUNDS"
+	TransactionTypeMarketOrder                = "MARKET_ORDER"
+	TransactionTypeMarketOrderReject          = "MARKET_ORDER_REJECT"
+	TransactionTypeLimitOrder                 = "LIMIT_ORDER"
+	TransactionTypeLimitOrderReject           = "LIMIT_ORDER_REJECT"
+	TransactionTypeStopOrder                  = "STOP_ORDER"
+	TransactionTypeStopOrderReject            = "STOP_ORDER_REJECT"
+	TransactionTypeMarketIfTouchedOrder       = "MARKET_IF_TOUCHED_ORDER"
+	TransactionTypeMarketIfTouchedOrderReject = "MARKET_IF_TOUCHED_ORDER_REJECT"
+	TransactionTypeTakeProfitOrder            = "TAKE_PROFIT_ORDER"
+	TransactionTypeTakeProfitOrderReject      = "TAKE_PROFIT_ORDER_REJECT"
+	TransactionTypeStopLossOrder              = "STOP_LOSS_ORDER"
+	TransactionTypeStopLossOrderReject        = "STOP_LOSS_ORDER_REJECT"
+	TransactionTypeTrailingStopLossOrder      = "TRAILING_STOP_LOSS_ORDER"
+	TransactionTypeTrailingStopLossReject     = "TRAILING_STOP_LOSS_ORDER_REJECT"
+	TransactionTypeOrderFill                  = "ORDER_FILL"
+	TransactionTypeOrderCancel                = "ORDER_CANCEL"
+	TransactionTypeOrderCancelReject          = "ORDER_CANCEL_REJECT"
+	TransactionTypeDailyFinancing             = "DAILY_FINANCING"
+	TransactionTypeHeartbeat                  = "HEARTBEAT"
+)
+
+// Transaction reasons
+const (
+	ReasonClientOrder            = "CLIENT_ORDER"
+	ReasonTradeClose             = "TRADE_CLOSE"
+	ReasonOnFill                 = "ON_FILL"
+	ReasonMarketOrder            = "MARKET_ORDER"
+	ReasonMarketOrderTradeClose  = "MARKET_ORDER_TRADE_CLOSE"
+	ReasonLimitOrder             = "LIMIT_ORDER"
+	ReasonStopOrder              = "STOP_ORDER"
+	ReasonMarketIfTouchedOrder   = "MARKET_IF_TOUCHED_ORDER"
+	ReasonTakeProfitOrder        = "TAKE_PROFIT_ORDER"
+	ReasonStopLossOrder          = "STOP_LOSS_ORDER"
+	ReasonTrailingStopLossOrder  = "TRAILING_STOP_LOSS_ORDER"
+	ReasonClientRequest          = "CLIENT_REQUEST"
+	ReasonTimeInForceExpired     = "TIME_IN_FORCE_EXPIRED"
+	ReasonLinkedTradeClosed      = "LINKED_TRADE_CLOSED"
+	ReasonInsufficientMargin     = "INSUFFICIENT_MARGIN"
+	ReasonInsufficientLiquidity  = "INSUFFICIENT_LIQUIDITY"
+	ReasonBoundsViolation        = "BOUNDS_VIOLATION"
+	ReasonMarketHalted           = "MARKET_HALTED"
+	ReasonInstrumentUnknown      = "INSTRUMENT_UNKNOWN"
+	ReasonTradeDoesntExist       = "TRADE_DOESNT_EXIST"
+	ReasonOrderDoesntExist       = "ORDER_DOESNT_EXIST"
+	ReasonPositionCloseoutFailed = "POSITION_CLOSEOUT_FAILED"
+)
+
+// Transaction is a Generic Transaction, the fields used depend on the Type
 type Transaction struct {
-  ID string   `json:"id"`
-  Type string `json:"type"`
+	ID                 string              `json:"id"`
+	Type               string              `json:"type"`
+	Time               time.Time           `json:"time"`
+	AccountID          string              `json:"accountID,omitempty"`
+	BatchID            string              `json:"batchID,omitempty"`
+	RequestID          string              `json:"requestID,omitempty"`
+	OrderID            string              `json:"orderID,omitempty"`
+	ClientOrderID      string              `json:"clientOrderID,omitempty"`
+	TradeID            string              `json:"tradeID,omitempty"`
+	Instrument         string              `json:"instrument,omitempty"`
+	Units              int64               `json:"units,string,omitempty"`
+	Price              float64             `json:"price,string,omitempty"`
+	PriceBound         float64             `json:"priceBound,string,omitempty"`
+	Distance           float64             `json:"distance,string,omitempty"`
+	TimeInForce        string              `json:"timeInForce,omitempty"`
+	PositionFill       string              `json:"positionFill,omitempty"`
+	Reason             string              `json:"reason,omitempty"`
+	RejectReason       string              `json:"rejectReason,omitempty"`
+	PL                 float64             `json:"pl,string,omitempty"`
+	Financing          float64             `json:"financing,string,omitempty"`
+	Commission         float64             `json:"commission,string,omitempty"`
+	Amount             float64             `json:"amount,string,omitempty"`
+	AccountBalance     float64             `json:"accountBalance,string,omitempty"`
+	ClientExtensions   *ClientExtensions   `json:"clientExtensions,omitempty"`
+	TradeOpened        *TradeOpen          `json:"tradeOpened,omitempty"`
+	TradeReduced       *TradeReduce        `json:"tradeReduced,omitempty"`
+	TradesClosed       []TradeReduce       `json:"tradesClosed,omitempty"`
+	PositionFinancings []PositionFinancing `json:"positionFinancings,omitempty"`
+}
+
+// TradeOpen is the detail of a Trade opened by an ORDER_FILL
+type TradeOpen struct {
+	TradeID          string            `json:"tradeID"`
+	Units            int64             `json:"units,string"`
+	Price            float64           `json:"price,string"`
+	ClientExtensions *ClientExtensions `json:"clientExtensions,omitempty"`
+}
+
+// TradeReduce is the detail of a Trade reduced or closed by an ORDER_FILL
+type TradeReduce struct {
+	TradeID    string  `json:"tradeID"`
+	Units      int64   `json:"units,string"`
+	Price      float64 `json:"price,string"`
+	RealizedPL float64 `json:"realizedPL,string"`
+	Financing  float64 `json:"financing,string"`
+}
+
+// PositionFinancing is the financing paid or collected for a position by a DAILY_FINANCING
+type PositionFinancing struct {
+	Instrument          string               `json:"instrument"`
+	Financing           float64              `json:"financing,string"`
+	OpenTradeFinancings []OpenTradeFinancing `json:"openTradeFinancings"`
+}
+
+// OpenTradeFinancing is the financing paid or collected for a single Trade
+type OpenTradeFinancing struct {
+	TradeID   string  `json:"tradeID"`
+	Financing float64 `json:"financing,string"`
+}
+
+// Transactions is a list of Transactions, with the last TransactionID of the account
+type Transactions struct {
+	Transactions      []Transaction `json:"transactions"`
+	LastTransactionID string        `json:"lastTransactionID"`
 }
 
 // TransactionHeartbeat is a heartbeat to keep connection alive, containing LastTransactionID
 type TransactionHeartbeat struct {
-	Type string    `json:"type"`
-  LastTransactionID string `json:"lastTransactionID"`
-	Time time.Time `json:"time"`
+	Type              string    `json:"type"`
+	LastTransactionID string    `json:"lastTransactionID"`
+	Time              time.Time `json:"time"`
 }
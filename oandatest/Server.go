@@ -0,0 +1,509 @@
+// Package oandatest provides a fake OANDA v20 server for tests, serving the REST and streaming
+// endpoints supported by the api package from a simulated account
+package oandatest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+	"github.com/burbru/goanda/sim"
+)
+
+// Config is the configuration of a fake Server
+type Config struct {
+	// Token expected in the Authorization header, any token is accepted if empty
+	Token string
+	// Account is the simulated account, its ID is used in the urls ("sim" if empty)
+	Account sim.Config
+	// Tags are the tags of the account listed by /v3/accounts
+	Tags []string
+}
+
+// Request is a request received by the Server
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Body   []byte
+}
+
+// Fault makes the Server answer Count requests whose path contains Path with an error Status,
+// only the requests with Method when it is set
+type Fault struct {
+	Method     string
+	Path       string
+	Status     int
+	RetryAfter time.Duration
+	Count      int
+	// Process serves the request before answering with the error, as when a response is lost
+	Process bool
+}
+
+// Server is a fake OANDA v20 server, the same URL serves the REST and the streaming endpoints
+type Server struct {
+	URL     string
+	Account *sim.Account
+
+	config        Config
+	server        *httptest.Server
+	mutex         sync.Mutex
+	candles       map[string][]models.CandleStick
+	positionBooks map[string]models.PositionBook
+	faults        []*Fault
+	requests      []Request
+	priceStreams  map[*stream]bool
+	txStreams     map[*stream]bool
+}
+
+// NewServer starts a fake Server, it must be closed with Close
+func NewServer(config Config) *Server {
+	if config.Account.ID == "" {
+		config.Account.ID = "sim"
+	}
+	s := &Server{
+		Account:       sim.NewAccount(config.Account),
+		config:        config,
+		candles:       make(map[string][]models.CandleStick),
+		positionBooks: make(map[string]models.PositionBook),
+		priceStreams:  make(map[*stream]bool),
+		txStreams:     make(map[*stream]bool),
+	}
+	s.Account.OnTransaction(s.publishTransaction)
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close disconnects the streams and shuts down the Server
+func (s *Server) Close() {
+	s.DisconnectStreams()
+	s.server.CloseClientConnections()
+	s.server.Close()
+}
+
+// Context returns an api Context pointing to the Server
+func (s *Server) Context() api.Context {
+	return api.Context{
+		ApiURL:       s.URL,
+		StreamApiURL: s.URL,
+		Token:        s.config.Token,
+		Account:      s.config.Account.ID,
+		Application:  "oandatest",
+	}
+}
+
+// SetPrice updates the price of an instrument, triggering the orders of the account
+// and sending the price to the pricing streams
+func (s *Server) SetPrice(price models.ClientPrice) {
+	if price.Type == "" {
+		price.Type = "PRICE"
+	}
+	s.Account.Update(&price)
+	line, _ := json.Marshal(price)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for st := range s.priceStreams {
+		if st.instruments[price.Instrument] {
+			st.send(line)
+		}
+	}
+}
+
+// SetCandles sets the candles returned for an instrument
+func (s *Server) SetCandles(instrument string, candles []models.CandleStick) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.candles[instrument] = candles
+}
+
+// SetPositionBook sets the position book returned for an instrument
+func (s *Server) SetPositionBook(book models.PositionBook) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.positionBooks[book.Instrument] = book
+}
+
+// AddFault adds a Fault, faults are applied in the order they were added
+func (s *Server) AddFault(fault Fault) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults = append(s.faults, &fault)
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// fault returns the first active fault matching a request, and consumes it
+func (s *Server) fault(method string, path string) *Fault {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, f := range s.faults {
+		if (f.Method == "" || f.Method == method) && strings.Contains(path, f.Path) {
+			f.Count--
+			if f.Count <= 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mutex.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Body: body})
+	requestID := len(s.requests)
+	s.mutex.Unlock()
+	w.Header().Set("RequestID", strconv.Itoa(requestID))
+
+	if s.config.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.config.Token {
+		writeError(w, http.StatusUnauthorized, "", "Insufficient authorization to perform request.")
+		return
+	}
+	if f := s.fault(r.Method, r.URL.Path); f != nil {
+		if f.Process {
+			s.route(httptest.NewRecorder(), r, body)
+		}
+		if f.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(f.RetryAfter.Seconds())))
+		}
+		writeError(w, f.Status, "", http.StatusText(f.Status))
+		return
+	}
+	s.route(w, r, body)
+}
+
+// route serves a request by its path
+func (s *Server) route(w http.ResponseWriter, r *http.Request, body []byte) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "v3" {
+		writeError(w, http.StatusNotFound, "", "Not Found")
+		return
+	}
+	if parts[1] == "instruments" && len(parts) == 4 && parts[3] == "positionBook" {
+		s.servePositionBook(w, parts[2])
+		return
+	}
+	if parts[1] != "accounts" {
+		writeError(w, http.StatusNotFound, "", "Not Found")
+		return
+	}
+	if len(parts) == 2 {
+		writeJSON(w, http.StatusOK, models.Accounts{Accounts: []models.Account{{ID: s.config.Account.ID, Tags: s.config.Tags}}})
+		return
+	}
+	if parts[2] != s.config.Account.ID {
+		writeError(w, http.StatusForbidden, "", "The provided request was forbidden.")
+		return
+	}
+	s.serveAccount(w, r, parts[3:], body)
+}
+
+// serveAccount serves the endpoints under /v3/accounts/{accountID}
+func (s *Server) serveAccount(w http.ResponseWriter, r *http.Request, parts []string, body []byte) {
+	route := r.Method + " " + strings.Join(parts, "/")
+	switch {
+	case r.Method == "GET" && len(parts) == 0:
+		summary := s.Account.Summary()
+		writeJSON(w, http.StatusOK, models.AccountDetailsResponse{
+			Account: models.AccountDetails{
+				AccountSummary: summary,
+				Trades:         s.Account.OpenTrades(),
+				Orders:         s.Account.PendingOrders(),
+				Positions:      s.Account.Positions(),
+			},
+			LastTransactionID: summary.LastTransactionID,
+		})
+	case route == "GET changes":
+		s.serveChanges(w, r)
+	case route == "GET summary":
+		summary := s.Account.Summary()
+		writeJSON(w, http.StatusOK, models.AccountSummaryResponse{Account: summary, LastTransactionID: summary.LastTransactionID})
+	case route == "GET instruments":
+		writeJSON(w, http.StatusOK, models.Instruments{Instruments: s.config.Account.Instruments})
+	case route == "GET pricing":
+		s.servePricing(w, r)
+	case route == "GET pricing/stream":
+		s.servePricingStream(w, r)
+	case route == "GET transactions/stream":
+		s.serveTransactionStream(w, r)
+	case r.Method == "GET" && len(parts) == 3 && parts[0] == "instruments" && parts[2] == "candles":
+		s.serveCandles(w, r, parts[1])
+	case route == "GET openPositions":
+		writeJSON(w, http.StatusOK, models.AccountPositions{
+			LastTransactionID: s.Account.Summary().LastTransactionID,
+			Positions:         s.Account.Positions(),
+		})
+	case r.Method == "GET" && len(parts) == 2 && parts[0] == "positions":
+		position := models.AccountPosition{
+			LastTransactionID: s.Account.Summary().LastTransactionID,
+			Position:          models.Position{Instrument: parts[1]},
+		}
+		for _, p := range s.Account.Positions() {
+			if p.Instrument == parts[1] {
+				position.Position = p
+			}
+		}
+		writeJSON(w, http.StatusOK, position)
+	case route == "GET openTrades":
+		writeJSON(w, http.StatusOK, models.Trades{
+			Trades:            s.Account.OpenTrades(),
+			LastTransactionID: s.Account.Summary().LastTransactionID,
+		})
+	case route == "GET pendingOrders":
+		writeJSON(w, http.StatusOK, models.Orders{
+			Orders:            s.Account.PendingOrders(),
+			LastTransactionID: s.Account.Summary().LastTransactionID,
+		})
+	case r.Method == "GET" && len(parts) == 2 && parts[0] == "orders":
+		order, ok := s.Account.Order(parts[1])
+		if !ok {
+			writeError(w, http.StatusNotFound, models.ReasonOrderDoesntExist, "The Order specified does not exist")
+			return
+		}
+		writeJSON(w, http.StatusOK, models.OrderResponse{Order: order, LastTransactionID: s.Account.Summary().LastTransactionID})
+	case route == "GET transactions/sinceid":
+		transactions := s.Account.TransactionsSince(r.URL.Query().Get("id"))
+		writeJSON(w, http.StatusOK, models.Transactions{
+			Transactions:      transactions,
+			LastTransactionID: s.Account.Summary().LastTransactionID,
+		})
+	case route == "POST orders":
+		s.serveCreateOrder(w, body)
+	case r.Method == "PUT" && len(parts) == 3 && parts[0] == "orders" && parts[2] == "cancel":
+		transaction, err := s.Account.CancelOrder(parts[1])
+		if err != nil {
+			writeError(w, http.StatusNotFound, models.ReasonOrderDoesntExist, "The Order specified does not exist")
+			return
+		}
+		writeJSON(w, http.StatusOK, models.OrderCancelResponse{
+			OrderCancelTransaction: transaction,
+			RelatedTransactionIDs:  []string{transaction.ID},
+			LastTransactionID:      transaction.ID,
+		})
+	case r.Method == "PUT" && len(parts) == 3 && parts[0] == "trades" && parts[2] == "close":
+		s.serveCloseTrade(w, parts[1], body)
+	default:
+		writeError(w, http.StatusNotFound, "", "Not Found")
+	}
+}
+
+// serveChanges returns the orders, trades and positions changed by the transactions since sinceTransactionID,
+// in their current state, with the current state of the account
+func (s *Server) serveChanges(w http.ResponseWriter, r *http.Request) {
+	since := r.URL.Query().Get("sinceTransactionID")
+	transactions := s.Account.TransactionsSince(since)
+	lastTransactionID := since
+	if len(transactions) > 0 {
+		lastTransactionID = transactions[len(transactions)-1].ID
+	}
+
+	changes := models.AccountChanges{Transactions: transactions}
+	trade := func(trades []models.Trade, tradeID string) []models.Trade {
+		if t, ok := s.Account.Trade(tradeID); ok {
+			trades = append(trades, t)
+		}
+		return trades
+	}
+	instruments := make(map[string]bool)
+	for _, t := range transactions {
+		switch {
+		case t.Type == models.TransactionTypeOrderFill:
+			if order, ok := s.Account.Order(t.OrderID); ok {
+				changes.OrdersFilled = append(changes.OrdersFilled, order)
+			}
+			if t.TradeOpened != nil {
+				changes.TradesOpened = trade(changes.TradesOpened, t.TradeOpened.TradeID)
+			}
+			if t.TradeReduced != nil {
+				changes.TradesReduced = trade(changes.TradesReduced, t.TradeReduced.TradeID)
+			}
+			for _, closed := range t.TradesClosed {
+				changes.TradesClosed = trade(changes.TradesClosed, closed.TradeID)
+			}
+			instruments[t.Instrument] = true
+		case t.Type == models.TransactionTypeOrderCancel:
+			if order, ok := s.Account.Order(t.OrderID); ok {
+				changes.OrdersCancelled = append(changes.OrdersCancelled, order)
+			}
+		case strings.HasSuffix(t.Type, "_ORDER"):
+			if order, ok := s.Account.Order(t.ID); ok {
+				changes.OrdersCreated = append(changes.OrdersCreated, order)
+			}
+		}
+	}
+	// the positions closed since are returned empty
+	positions := make(map[string]models.Position)
+	for _, position := range s.Account.Positions() {
+		positions[position.Instrument] = position
+	}
+	for instrument := range instruments {
+		position, ok := positions[instrument]
+		if !ok {
+			position = models.Position{Instrument: instrument}
+		}
+		changes.Positions = append(changes.Positions, position)
+	}
+	sort.Slice(changes.Positions, func(i, j int) bool {
+		return changes.Positions[i].Instrument < changes.Positions[j].Instrument
+	})
+
+	summary := s.Account.Summary()
+	state := models.AccountChangesState{
+		UnrealizedPL:    summary.UnrealizedPL,
+		NAV:             summary.NAV,
+		MarginUsed:      summary.MarginUsed,
+		MarginAvailable: summary.MarginAvailable,
+		PositionValue:   summary.PositionValue,
+	}
+	for _, t := range s.Account.OpenTrades() {
+		state.Trades = append(state.Trades, models.CalculatedTradeState{ID: t.ID, UnrealizedPL: t.UnrealizedPL, MarginUsed: t.MarginUsed})
+	}
+	for _, p := range positions {
+		state.Positions = append(state.Positions, models.CalculatedPositionState{
+			Instrument:        p.Instrument,
+			NetUnrealizedPL:   p.UnrealizedPL,
+			LongUnrealizedPL:  p.Long.UnrealizedPL,
+			ShortUnrealizedPL: p.Short.UnrealizedPL,
+			MarginUsed:        p.MarginUsed,
+		})
+	}
+	sort.Slice(state.Positions, func(i, j int) bool {
+		return state.Positions[i].Instrument < state.Positions[j].Instrument
+	})
+	writeJSON(w, http.StatusOK, models.AccountChangesResponse{Changes: changes, State: state, LastTransactionID: lastTransactionID})
+}
+
+// servePricing returns the last prices of the instruments, and the home conversions of the account currency and
+// of their quote currencies, given by the HomeConversion of the account
+func (s *Server) servePricing(w http.ResponseWriter, r *http.Request) {
+	prices := models.Prices{Time: s.Account.Time()}
+	currency := s.Account.Summary().Currency
+	converted := map[string]bool{currency: true}
+	if r.URL.Query().Get("includeHomeConversions") == "true" {
+		prices.HomeConversions = append(prices.HomeConversions, models.HomeConversions{Currency: currency, AccountGain: 1, AccountLoss: 1, PositionValue: 1})
+	}
+	for _, instrument := range strings.Split(r.URL.Query().Get("instruments"), ",") {
+		price, ok := s.Account.Price(instrument)
+		if !ok {
+			continue
+		}
+		prices.Prices = append(prices.Prices, price)
+		currencies := strings.Split(instrument, "_")
+		quote := currencies[len(currencies)-1]
+		if r.URL.Query().Get("includeHomeConversions") != "true" || converted[quote] {
+			continue
+		}
+		converted[quote] = true
+		factor := 1.0
+		if s.config.Account.HomeConversion != nil {
+			factor = s.config.Account.HomeConversion(instrument)
+		}
+		prices.HomeConversions = append(prices.HomeConversions, models.HomeConversions{Currency: quote, AccountGain: factor, AccountLoss: factor, PositionValue: factor})
+	}
+	writeJSON(w, http.StatusOK, prices)
+}
+
+// serveCandles returns the candles of an instrument between from and to, the last count ones
+func (s *Server) serveCandles(w http.ResponseWriter, r *http.Request, instrument string) {
+	query := r.URL.Query()
+	s.mutex.Lock()
+	all := s.candles[instrument]
+	s.mutex.Unlock()
+
+	from, _ := time.Parse(time.RFC3339, query.Get("from"))
+	to, _ := time.Parse(time.RFC3339, query.Get("to"))
+	var candles []models.CandleStick
+	for _, candle := range all {
+		if (!from.IsZero() && candle.Time.Before(from)) || (!to.IsZero() && candle.Time.After(to)) {
+			continue
+		}
+		candles = append(candles, candle)
+	}
+	if count, err := strconv.Atoi(query.Get("count")); err == nil && count < len(candles) {
+		if from.IsZero() {
+			candles = candles[len(candles)-count:]
+		} else {
+			candles = candles[:count]
+		}
+	}
+	writeJSON(w, http.StatusOK, models.Candles{
+		Instrument:  instrument,
+		Granularity: query.Get("granularity"),
+		Candles:     candles,
+	})
+}
+
+func (s *Server) servePositionBook(w http.ResponseWriter, instrument string) {
+	s.mutex.Lock()
+	book, ok := s.positionBooks[instrument]
+	s.mutex.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "", "Position book not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.PositionBookResponse{PositionBook: book})
+}
+
+func (s *Server) serveCreateOrder(w http.ResponseWriter, body []byte) {
+	var orderReq models.OrderRequest
+	if err := json.Unmarshal(body, &orderReq); err != nil {
+		writeError(w, http.StatusBadRequest, "", "Invalid value specified for 'order': "+err.Error())
+		return
+	}
+	response, err := s.Account.CreateOrder(orderReq.Order)
+	if err != nil {
+		if response.OrderRejectTransaction == nil {
+			writeError(w, http.StatusBadRequest, "", err.Error())
+			return
+		}
+		response.ErrorCode = response.OrderRejectTransaction.RejectReason
+		response.ErrorMessage = err.Error()
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (s *Server) serveCloseTrade(w http.ResponseWriter, tradeID string, body []byte) {
+	var closeReq models.TradeCloseRequest
+	json.Unmarshal(body, &closeReq)
+	var units int64
+	if closeReq.Units != "" && closeReq.Units != "ALL" {
+		var err error
+		if units, err = strconv.ParseInt(closeReq.Units, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "", "Invalid value specified for 'units'")
+			return
+		}
+	}
+	response, err := s.Account.CloseTrade(tradeID, units)
+	if err != nil {
+		writeError(w, http.StatusNotFound, models.ReasonTradeDoesntExist, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, api.APIError{ErrorCode: code, ErrorMessage: message})
+}
@@ -0,0 +1,170 @@
+package oandatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/burbru/goanda/models"
+)
+
+// stream is a connected pricing or transaction stream
+type stream struct {
+	instruments map[string]bool
+	mutex       sync.Mutex
+	queue       [][]byte
+	notify      chan struct{}
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+func newStream() *stream {
+	return &stream{
+		instruments: make(map[string]bool),
+		notify:      make(chan struct{}, 1),
+		closed:      make(chan struct{}),
+	}
+}
+
+// send queues a line for the stream, it never blocks
+func (st *stream) send(line []byte) {
+	st.mutex.Lock()
+	st.queue = append(st.queue, line)
+	st.mutex.Unlock()
+	select {
+	case st.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (st *stream) close() {
+	st.closeOnce.Do(func() { close(st.closed) })
+}
+
+// serve writes the queued lines until the stream is closed or the client goes away
+func (st *stream) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for {
+		select {
+		case <-st.notify:
+			st.mutex.Lock()
+			queue := st.queue
+			st.queue = nil
+			st.mutex.Unlock()
+			for _, line := range queue {
+				if _, err := w.Write(append(line, '\n')); err != nil {
+					return
+				}
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-st.closed:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) servePricingStream(w http.ResponseWriter, r *http.Request) {
+	st := newStream()
+	for _, instrument := range strings.Split(r.URL.Query().Get("instruments"), ",") {
+		st.instruments[instrument] = true
+	}
+	s.mutex.Lock()
+	s.priceStreams[st] = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.priceStreams, st)
+		s.mutex.Unlock()
+	}()
+	st.serve(w, r)
+}
+
+func (s *Server) serveTransactionStream(w http.ResponseWriter, r *http.Request) {
+	st := newStream()
+	s.mutex.Lock()
+	s.txStreams[st] = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.txStreams, st)
+		s.mutex.Unlock()
+	}()
+	st.serve(w, r)
+}
+
+// publishTransaction sends the transactions of the account to the transaction streams
+func (s *Server) publishTransaction(transaction models.Transaction) {
+	line, _ := json.Marshal(transaction)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for st := range s.txStreams {
+		st.send(line)
+	}
+}
+
+// SendHeartbeats sends a heartbeat to every pricing and transaction stream
+func (s *Server) SendHeartbeats() {
+	now := time.Now().UTC()
+	pricing, _ := json.Marshal(models.PricingHeartbeat{Type: models.TransactionTypeHeartbeat, Time: now})
+	transaction, _ := json.Marshal(models.TransactionHeartbeat{
+		Type:              models.TransactionTypeHeartbeat,
+		LastTransactionID: s.Account.Summary().LastTransactionID,
+		Time:              now,
+	})
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for st := range s.priceStreams {
+		st.send(pricing)
+	}
+	for st := range s.txStreams {
+		st.send(transaction)
+	}
+}
+
+// SendPricingLine sends a raw line, for instance a malformed one, to every pricing stream
+func (s *Server) SendPricingLine(line string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for st := range s.priceStreams {
+		st.send([]byte(line))
+	}
+}
+
+// SendTransactionLine sends a raw line, for instance a malformed one, to every transaction stream
+func (s *Server) SendTransactionLine(line string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for st := range s.txStreams {
+		st.send([]byte(line))
+	}
+}
+
+// DisconnectStreams closes the connection of every pricing and transaction stream
+func (s *Server) DisconnectStreams() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for st := range s.priceStreams {
+		st.close()
+	}
+	for st := range s.txStreams {
+		st.close()
+	}
+}
+
+// StreamCount returns the number of connected pricing and transaction streams
+func (s *Server) StreamCount() (int, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.priceStreams), len(s.txStreams)
+}
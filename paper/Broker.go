@@ -0,0 +1,226 @@
+package paper
+
+import (
+	"sync"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+	"github.com/burbru/goanda/sim"
+)
+
+// Broker is a paper trading api.Broker, orders are simulated against live prices and never sent to OANDA
+type Broker struct {
+	Account     *sim.Account
+	mutex       sync.Mutex
+	subscribers []*subscriber
+}
+
+var _ api.Broker = (*Broker)(nil)
+
+// subscriber is the queue of transactions of a TransactionStream
+type subscriber struct {
+	tchan  chan models.Transaction
+	queue  []models.Transaction
+	notify chan struct{}
+	done   chan struct{}
+}
+
+// NewBroker creates a paper Broker trading a simulated account created from config
+func NewBroker(config sim.Config) *Broker {
+	b := &Broker{Account: sim.NewAccount(config)}
+	b.Account.OnTransaction(b.publish)
+	return b
+}
+
+// Update feeds the broker with a price, triggering the pending orders
+func (b *Broker) Update(price *models.ClientPrice) {
+	b.Account.Update(price)
+}
+
+// Stream starts a pricing stream for instruments and feeds the broker with it, the prices and heartbeats
+// are forwarded to pchan and hchan when they are not nil
+func (b *Broker) Stream(streamApi *api.StreamAPI, instruments []string, pchan chan models.ClientPrice, hchan chan models.PricingHeartbeat) {
+	prices := make(chan models.ClientPrice)
+	heartbeats := make(chan models.PricingHeartbeat)
+	streamApi.StartPricingStream(instruments, prices, heartbeats)
+
+	for {
+		select {
+		case price := <-prices:
+			b.Update(&price)
+			if pchan != nil {
+				pchan <- price
+			}
+		case heartbeat := <-heartbeats:
+			if hchan != nil {
+				hchan <- heartbeat
+			}
+		}
+	}
+}
+
+// StartTransactionStream starts a stream of the synthetic transactions in the background
+func (b *Broker) StartTransactionStream(tchan chan models.Transaction, hchan chan models.TransactionHeartbeat) {
+	go b.TransactionStream(tchan, hchan)
+}
+
+// TransactionStream sends the synthetic transactions to tchan as TransactionStreamAPI does,
+// and a heartbeat every 5 seconds to hchan when it is not nil. It returns when StopTransactionStream
+// is called for tchan
+func (b *Broker) TransactionStream(tchan chan models.Transaction, hchan chan models.TransactionHeartbeat) {
+	s := b.subscribe(tchan)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.notify:
+			for _, transaction := range b.take(s) {
+				select {
+				case tchan <- transaction:
+				case <-s.done:
+					return
+				}
+			}
+		case t := <-ticker.C:
+			if hchan != nil {
+				heartbeat := models.TransactionHeartbeat{
+					Type:              models.TransactionTypeHeartbeat,
+					LastTransactionID: b.Account.Summary().LastTransactionID,
+					Time:              t,
+				}
+				select {
+				case hchan <- heartbeat:
+				case <-s.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+// StopTransactionStream stops the transaction streams sending to tchan, the transactions not sent yet
+// are dropped
+func (b *Broker) StopTransactionStream(tchan chan models.Transaction) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	subscribers := b.subscribers[:0]
+	for _, s := range b.subscribers {
+		if s.tchan == tchan {
+			close(s.done)
+			continue
+		}
+		subscribers = append(subscribers, s)
+	}
+	b.subscribers = subscribers
+}
+
+func (b *Broker) subscribe(tchan chan models.Transaction) *subscriber {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	s := &subscriber{tchan: tchan, notify: make(chan struct{}, 1), done: make(chan struct{})}
+	b.subscribers = append(b.subscribers, s)
+	return s
+}
+
+// publish queues a transaction for the subscribers, it never blocks the account
+func (b *Broker) publish(transaction models.Transaction) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, s := range b.subscribers {
+		s.queue = append(s.queue, transaction)
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *Broker) take(s *subscriber) []models.Transaction {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	queue := s.queue
+	s.queue = nil
+	return queue
+}
+
+// CreateOrder creates an order on the simulated account
+func (b *Broker) CreateOrder(order models.Order) (*models.OrderCreateResponse, error) {
+	return b.Account.CreateOrder(order)
+}
+
+// CancelOrder cancels a pending order of the simulated account by ID or by @clientID, an order which is
+// unknown or not pending is an *api.APIError 404 as with OANDA
+func (b *Broker) CancelOrder(orderID string) (*models.Transaction, error) {
+	transaction, err := b.Account.CancelOrder(orderID)
+	if err != nil {
+		return nil, notFound(orderID)
+	}
+	return transaction, nil
+}
+
+// GetOrder gets a pending, filled or cancelled order of the simulated account by ID or by @clientID, an unknown
+// order is an *api.APIError 404 as with OANDA
+func (b *Broker) GetOrder(orderID string) (*models.Order, error) {
+	order, ok := b.Account.Order(orderID)
+	if !ok {
+		return nil, notFound(orderID)
+	}
+	return &order, nil
+}
+
+// notFound is the error of an unknown order, as returned by OANDA
+func notFound(orderID string) error {
+	return &api.APIError{StatusCode: 404, ErrorCode: models.ReasonOrderDoesntExist, ErrorMessage: "paper: order " + orderID + " does not exist"}
+}
+
+// GetPendingOrders gets the pending orders of the simulated account
+func (b *Broker) GetPendingOrders() (*models.Orders, error) {
+	return &models.Orders{
+		Orders:            b.Account.PendingOrders(),
+		LastTransactionID: b.Account.Summary().LastTransactionID,
+	}, nil
+}
+
+// GetOpenTrades gets the open trades of the simulated account
+func (b *Broker) GetOpenTrades() (*models.Trades, error) {
+	return &models.Trades{
+		Trades:            b.Account.OpenTrades(),
+		LastTransactionID: b.Account.Summary().LastTransactionID,
+	}, nil
+}
+
+// CloseTrade closes units of a trade of the simulated account, all the units are closed when units is 0
+func (b *Broker) CloseTrade(tradeID string, units int64) (*models.OrderCreateResponse, error) {
+	return b.Account.CloseTrade(tradeID, units)
+}
+
+// GetOpenPositions gets the open positions of the simulated account
+func (b *Broker) GetOpenPositions() (*models.AccountPositions, error) {
+	return &models.AccountPositions{
+		LastTransactionID: b.Account.Summary().LastTransactionID,
+		Positions:         b.Account.Positions(),
+	}, nil
+}
+
+// GetPosition gets the position of an instrument, which is empty when there are no open trades
+func (b *Broker) GetPosition(instrument string) (*models.AccountPosition, error) {
+	position := models.AccountPosition{
+		LastTransactionID: b.Account.Summary().LastTransactionID,
+		Position:          models.Position{Instrument: instrument},
+	}
+	for _, p := range b.Account.Positions() {
+		if p.Instrument == instrument {
+			position.Position = p
+		}
+	}
+	return &position, nil
+}
+
+// GetAccountSummary gets the summary of the simulated account
+func (b *Broker) GetAccountSummary() (*models.AccountSummary, error) {
+	summary := b.Account.Summary()
+	return &summary, nil
+}
@@ -0,0 +1,53 @@
+package paper
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+	"github.com/burbru/goanda/sim"
+)
+
+func subscribers(b *Broker) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.subscribers)
+}
+
+func TestCancelUnknownOrder(t *testing.T) {
+	b := NewBroker(sim.Config{Balance: 10000})
+	_, err := b.CancelOrder("@unknown")
+	var apiErr *api.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 404 || apiErr.ErrorCode != models.ReasonOrderDoesntExist {
+		t.Errorf("error %v, want HTTP 404", err)
+	}
+}
+
+func TestStopTransactionStream(t *testing.T) {
+	b := NewBroker(sim.Config{Balance: 10000})
+	tchan := make(chan models.Transaction)
+	done := make(chan struct{})
+	go func() {
+		b.TransactionStream(tchan, nil)
+		close(done)
+	}()
+	for deadline := time.Now().Add(time.Second); subscribers(b) == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("not subscribed")
+		}
+	}
+
+	// a transaction no one reads does not keep the stream running
+	b.Account.CancelOrder("@unknown")
+	b.StopTransactionStream(tchan)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream not stopped")
+	}
+	if n := subscribers(b); n != 0 {
+		t.Errorf("%d subscribers, want none", n)
+	}
+}
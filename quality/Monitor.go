@@ -0,0 +1,347 @@
+// Package quality monitors the prices of the pricing stream: rolling spread statistics per instrument,
+// wide spreads, stale prices, spikes and crossed books, with alerts and a quality flag the order code
+// can consult before trading
+package quality
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+)
+
+// Default values of Config
+const (
+	DefaultWindow         = 300
+	DefaultMinSamples     = 20
+	DefaultSpreadMultiple = 3
+	DefaultSpikeMultiple  = 8
+)
+
+// The kinds of Alert
+const (
+	AlertWideSpread = "WIDE_SPREAD"
+	AlertStale      = "STALE"
+	AlertSpike      = "SPIKE"
+	AlertCrossed    = "CROSSED"
+	AlertEmpty      = "EMPTY_BOOK"
+	AlertRecovered  = "RECOVERED"
+)
+
+// Alert is raised when a condition of an instrument starts, and RECOVERED when all its conditions ended
+type Alert struct {
+	Kind       string
+	Instrument string
+	Time       time.Time
+	Message    string
+	Quality    Quality
+}
+
+// Config is the configuration of a Monitor, the zero values are replaced by the defaults
+type Config struct {
+	// Window is the number of prices of the rolling statistics, DefaultWindow if zero
+	Window int
+	// MinSamples is the number of prices before the wide spreads and the spikes are detected,
+	// DefaultMinSamples if zero
+	MinSamples int
+	// SpreadMultiple is the ratio of the spread to its rolling mean over which it is wide,
+	// DefaultSpreadMultiple if zero
+	SpreadMultiple float64
+	// MaxSpread is the spread over which the spread of an instrument is always wide, in price
+	MaxSpread map[string]float64
+	// SpikeMultiple is the ratio of a move of the mid price to the rolling standard deviation of the moves
+	// over which the move is a spike, DefaultSpikeMultiple if zero
+	SpikeMultiple float64
+	// StaleAfter is the time without price after which the price of an instrument is stale, checked on the
+	// heartbeats and by Check. The prices are never stale if zero
+	StaleAfter time.Duration
+	// TradingHours reports whether an instrument is traded at a time, a closed instrument is not stale.
+	// All the times are traded if nil
+	TradingHours func(instrument string, t time.Time) bool
+}
+
+// Quality is the state of the prices of an instrument
+type Quality struct {
+	Instrument string
+	// Time is the time of the last price
+	Time time.Time
+	// Spread is the last spread, MeanSpread and StdDevSpread its rolling statistics over Samples prices
+	Spread       float64
+	MeanSpread   float64
+	StdDevSpread float64
+	Samples      int
+	Wide         bool
+	Stale        bool
+	Spike        bool
+	// Crossed is set when the bid is above the ask, a locked book with the bid at the ask is not crossed
+	Crossed bool
+	Empty   bool
+}
+
+// Good reports whether the prices of the instrument can be traded on: known, fresh, not wide,
+// not spiking and not crossed
+func (q Quality) Good() bool {
+	return q.Samples > 0 && !q.Wide && !q.Stale && !q.Spike && !q.Crossed && !q.Empty
+}
+
+// Monitor monitors the prices of instruments, safe for concurrent use
+type Monitor struct {
+	config Config
+
+	mutex       sync.Mutex
+	instruments map[string]*instrumentState
+
+	listenersMutex sync.Mutex
+	listeners      []func(Alert)
+}
+
+type instrumentState struct {
+	quality Quality
+	spreads rolling
+	moves   rolling
+	mid     float64
+}
+
+// New creates a Monitor with a Config
+func New(config Config) *Monitor {
+	if config.Window <= 0 {
+		config.Window = DefaultWindow
+	}
+	if config.MinSamples <= 0 {
+		config.MinSamples = DefaultMinSamples
+	}
+	if config.SpreadMultiple <= 0 {
+		config.SpreadMultiple = DefaultSpreadMultiple
+	}
+	if config.SpikeMultiple <= 0 {
+		config.SpikeMultiple = DefaultSpikeMultiple
+	}
+	return &Monitor{config: config, instruments: make(map[string]*instrumentState)}
+}
+
+// OnAlert registers a listener called for each alert, outside of the lock of the Monitor
+func (m *Monitor) OnAlert(f func(Alert)) {
+	m.listenersMutex.Lock()
+	defer m.listenersMutex.Unlock()
+	m.listeners = append(m.listeners, f)
+}
+
+// Update updates the quality of an instrument with a price
+func (m *Monitor) Update(price models.ClientPrice) {
+	tick := models.ClientPrice2Tick(&price)
+	m.update(tick, !tick.Complete())
+}
+
+// UpdateTick updates the quality of an instrument with a tick
+func (m *Monitor) UpdateTick(tick models.Tick) {
+	m.update(tick, !tick.Complete())
+}
+
+func (m *Monitor) update(tick models.Tick, empty bool) {
+	m.mutex.Lock()
+	state := m.state(tick.Instrument)
+	before := state.quality
+	q := &state.quality
+	q.Time = tick.Time
+	q.Stale = false
+	q.Empty = empty
+	if empty {
+		q.Crossed, q.Spike, q.Wide = false, false, false
+		alerts := m.alerts(before, *q)
+		m.mutex.Unlock()
+		m.notify(alerts)
+		return
+	}
+
+	spread := tick.Ask - tick.Bid
+	q.Spread = spread
+	q.Crossed = spread < 0
+	if !q.Crossed {
+		// the statistics are computed before the price is added, so that a wide spread or a spike is
+		// compared with the prices before it
+		q.Wide = false
+		if state.spreads.count() >= m.config.MinSamples && spread > state.spreads.mean()*m.config.SpreadMultiple {
+			q.Wide = true
+		}
+		if maxSpread, ok := m.config.MaxSpread[tick.Instrument]; ok && spread > maxSpread {
+			q.Wide = true
+		}
+		mid := tick.Price()
+		q.Spike = false
+		if state.mid != 0 {
+			move := math.Abs(mid - state.mid)
+			if deviation := state.moves.stdDev(); state.moves.count() >= m.config.MinSamples && deviation > 0 && move > deviation*m.config.SpikeMultiple {
+				q.Spike = true
+			}
+			state.moves.add(move, m.config.Window)
+		}
+		state.mid = mid
+		state.spreads.add(spread, m.config.Window)
+	}
+	q.Samples = state.spreads.count()
+	q.MeanSpread = state.spreads.mean()
+	q.StdDevSpread = state.spreads.stdDev()
+	alerts := m.alerts(before, *q)
+	m.mutex.Unlock()
+	m.notify(alerts)
+}
+
+// Heartbeat checks the prices are not stale at the time of a heartbeat: the stream is alive, so an
+// instrument without price since StaleAfter has stale prices
+func (m *Monitor) Heartbeat(heartbeat models.PricingHeartbeat) {
+	m.Check(heartbeat.Time)
+}
+
+// Check checks the prices are not stale at a time
+func (m *Monitor) Check(now time.Time) {
+	if m.config.StaleAfter <= 0 {
+		return
+	}
+	m.mutex.Lock()
+	var alerts []Alert
+	for _, name := range m.names() {
+		state := m.instruments[name]
+		before := state.quality
+		stale := now.Sub(state.quality.Time) > m.config.StaleAfter
+		if stale && m.config.TradingHours != nil && !m.config.TradingHours(name, now) {
+			stale = false
+		}
+		state.quality.Stale = stale
+		alerts = append(alerts, m.alerts(before, state.quality)...)
+	}
+	m.mutex.Unlock()
+	m.notify(alerts)
+}
+
+// Quality returns the quality of the prices of an instrument, its Samples are zero if it has no price
+func (m *Monitor) Quality(instrument string) Quality {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	state, ok := m.instruments[instrument]
+	if !ok {
+		return Quality{Instrument: instrument}
+	}
+	return state.quality
+}
+
+// Good reports whether the prices of an instrument can be traded on, see Quality.Good
+func (m *Monitor) Good(instrument string) bool {
+	return m.Quality(instrument).Good()
+}
+
+// Qualities returns the quality of the prices of all the instruments, sorted by instrument
+func (m *Monitor) Qualities() []Quality {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var qualities []Quality
+	for _, name := range m.names() {
+		qualities = append(qualities, m.instruments[name].quality)
+	}
+	return qualities
+}
+
+// StreamPrices starts a pricing stream for instruments and monitors its prices and heartbeats.
+// It blocks until the server refuses the stream, as api.StreamAPI.StreamPrices does
+func (m *Monitor) StreamPrices(streamApi *api.StreamAPI, instruments []string) error {
+	return streamApi.StreamPrices(instruments, m.Update, m.Heartbeat)
+}
+
+func (m *Monitor) state(instrument string) *instrumentState {
+	state, ok := m.instruments[instrument]
+	if !ok {
+		state = &instrumentState{quality: Quality{Instrument: instrument}}
+		m.instruments[instrument] = state
+	}
+	return state
+}
+
+func (m *Monitor) names() []string {
+	names := make([]string, 0, len(m.instruments))
+	for name := range m.instruments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// alerts returns the alerts of the conditions started from before to after, and RECOVERED when after
+// is good and before was not
+func (m *Monitor) alerts(before Quality, after Quality) []Alert {
+	var alerts []Alert
+	alert := func(started bool, kind string, format string, args ...interface{}) {
+		if started {
+			alerts = append(alerts, Alert{Kind: kind, Instrument: after.Instrument, Time: after.Time, Message: fmt.Sprintf(format, args...), Quality: after})
+		}
+	}
+	alert(after.Empty && !before.Empty, AlertEmpty, "no bids or asks")
+	alert(after.Crossed && !before.Crossed, AlertCrossed, "crossed book, spread %g", after.Spread)
+	alert(after.Wide && !before.Wide, AlertWideSpread, "spread %g, mean %g", after.Spread, after.MeanSpread)
+	alert(after.Spike && !before.Spike, AlertSpike, "price spike")
+	alert(after.Stale && !before.Stale, AlertStale, "no price since %s", after.Time.Format(time.RFC3339))
+	alert(after.Good() && !before.Good() && before.Samples > 0, AlertRecovered, "prices recovered")
+	return alerts
+}
+
+func (m *Monitor) notify(alerts []Alert) {
+	if len(alerts) == 0 {
+		return
+	}
+	m.listenersMutex.Lock()
+	listeners := make([]func(Alert), len(m.listeners))
+	copy(listeners, m.listeners)
+	m.listenersMutex.Unlock()
+	for _, alert := range alerts {
+		for _, f := range listeners {
+			f(alert)
+		}
+	}
+}
+
+// rolling is the mean and standard deviation of the last values added
+type rolling struct {
+	values []float64
+	next   int
+	sum    float64
+	sumSq  float64
+}
+
+func (r *rolling) add(value float64, window int) {
+	if len(r.values) < window {
+		r.values = append(r.values, value)
+	} else {
+		old := r.values[r.next]
+		r.sum -= old
+		r.sumSq -= old * old
+		r.values[r.next] = value
+		r.next = (r.next + 1) % window
+	}
+	r.sum += value
+	r.sumSq += value * value
+}
+
+func (r *rolling) count() int {
+	return len(r.values)
+}
+
+func (r *rolling) mean() float64 {
+	if len(r.values) == 0 {
+		return 0
+	}
+	return r.sum / float64(len(r.values))
+}
+
+func (r *rolling) stdDev() float64 {
+	n := float64(len(r.values))
+	if n < 2 {
+		return 0
+	}
+	variance := (r.sumSq - r.sum*r.sum/n) / (n - 1)
+	if variance <= 0 {
+		return 0
+	}
+	return math.Sqrt(variance)
+}
@@ -0,0 +1,66 @@
+// Package record records the REST and streaming traffic of the api package to a file,
+// and replays it back through the same API and StreamAPI types
+package record
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Entry kinds
+const (
+	// KindExchange is a REST request with its complete response
+	KindExchange = "exchange"
+	// KindStream is the opening of a stream, its lines follow as KindLine entries
+	KindStream = "stream"
+	// KindLine is a line received on a stream
+	KindLine = "line"
+)
+
+// Entry is a line of a recording file
+type Entry struct {
+	Time           time.Time   `json:"time"`
+	Kind           string      `json:"kind"`
+	Stream         int         `json:"stream,omitempty"`
+	Method         string      `json:"method,omitempty"`
+	URL            string      `json:"url,omitempty"`
+	RequestHeader  http.Header `json:"requestHeader,omitempty"`
+	RequestBody    string      `json:"requestBody,omitempty"`
+	Status         int         `json:"status,omitempty"`
+	ResponseHeader http.Header `json:"responseHeader,omitempty"`
+	ResponseBody   string      `json:"responseBody,omitempty"`
+	Line           string      `json:"line,omitempty"`
+	// Error is the transport error of an exchange or of a stream line, which has no response
+	Error string `json:"error,omitempty"`
+}
+
+// isStream tells whether a request opens a pricing or transaction stream
+func isStream(req *http.Request) bool {
+	return strings.HasSuffix(req.URL.Path, "/stream")
+}
+
+// requestKey identifies a request independently of the host, so a recording can be replayed on any url
+func requestKey(method string, path string, query string) string {
+	if query != "" {
+		path += "?" + query
+	}
+	return method + " " + path
+}
+
+// redactedHeaders are the request and response headers carrying credentials
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// redact returns a copy of the header with the credentials replaced
+func redact(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range redactedHeaders {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, "[REDACTED]")
+		}
+	}
+	if redacted.Get("Authorization") != "" {
+		redacted.Set("Authorization", "Bearer [REDACTED]")
+	}
+	return redacted
+}
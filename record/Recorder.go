@@ -0,0 +1,140 @@
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Recorder is an http.RoundTripper writing every request and response to a file, one JSON Entry
+// per line, with the credentials redacted. The lines of the streams are written as they are received,
+// and the transport errors are recorded so that a replay returns them
+type Recorder struct {
+	base    http.RoundTripper
+	mutex   sync.Mutex
+	encoder *json.Encoder
+	streams int
+	err     error
+}
+
+// NewRecorder creates a Recorder writing to w and sending the requests with base, http.DefaultTransport if nil.
+// Use it with api.SetHTTPClient(&http.Client{Transport: recorder})
+func NewRecorder(w io.Writer, base http.RoundTripper) *Recorder {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Recorder{base: base, encoder: json.NewEncoder(w)}
+}
+
+// RoundTrip sends the request and records it with its response
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if req.Body != nil {
+		var err error
+		if requestBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(requestBody))
+	}
+	entry := Entry{
+		Time:          time.Now().UTC(),
+		Kind:          KindExchange,
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		RequestHeader: redact(req.Header),
+		RequestBody:   string(requestBody),
+	}
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		entry.Error = err.Error()
+		r.write(entry)
+		return nil, err
+	}
+	entry.Status = resp.StatusCode
+	entry.ResponseHeader = redact(resp.Header)
+
+	if isStream(req) {
+		r.mutex.Lock()
+		r.streams++
+		entry.Kind = KindStream
+		entry.Stream = r.streams
+		r.mutex.Unlock()
+		r.write(entry)
+		resp.Body = &streamTee{
+			recorder: r,
+			stream:   entry.Stream,
+			body:     resp.Body,
+			reader:   bufio.NewReader(resp.Body),
+		}
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		entry.Error = err.Error()
+		r.write(entry)
+		return nil, err
+	}
+	entry.ResponseBody = string(body)
+	r.write(entry)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// Err returns the first error writing the recording, the entries after it may be missing
+func (r *Recorder) Err() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.err
+}
+
+func (r *Recorder) write(entry Entry) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.encoder.Encode(entry); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+// streamTee records the lines of a stream body as they are read
+type streamTee struct {
+	recorder *Recorder
+	stream   int
+	body     io.ReadCloser
+	reader   *bufio.Reader
+	pending  []byte
+}
+
+func (t *streamTee) Read(p []byte) (int, error) {
+	if len(t.pending) == 0 {
+		line, err := t.reader.ReadBytes('\n')
+		if len(line) > 0 {
+			t.recorder.write(Entry{
+				Time:   time.Now().UTC(),
+				Kind:   KindLine,
+				Stream: t.stream,
+				Line:   string(bytes.TrimRight(line, "\r\n")),
+			})
+			t.pending = line
+		}
+		if err != nil && err != io.EOF {
+			t.recorder.write(Entry{Time: time.Now().UTC(), Kind: KindLine, Stream: t.stream, Error: err.Error()})
+		}
+		if len(t.pending) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+func (t *streamTee) Close() error {
+	return t.body.Close()
+}
@@ -0,0 +1,109 @@
+package record
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const summary = `{"account":{"id":"1"}}`
+
+var streamLines = []string{`{"type":"HEARTBEAT"}`, `{"type":"PRICE","instrument":"EUR_USD"}`}
+
+func newServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/stream") {
+			for _, line := range streamLines {
+				io.WriteString(w, line+"\n")
+			}
+			return
+		}
+		w.Header().Set("Set-Cookie", "session=secret")
+		io.WriteString(w, summary)
+	}))
+}
+
+// traffic sends a request, a request failing in the transport and a stream, and returns their results
+func traffic(t *testing.T, client *http.Client, url string, closedURL string) (string, error, string) {
+	req, _ := http.NewRequest("GET", url+"/v3/accounts/1/summary", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	_, failure := client.Get(closedURL + "/v3/accounts/1/openTrades")
+
+	resp, err = client.Get(url + "/v3/accounts/1/pricing/stream?instruments=EUR_USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	return string(body), failure, string(lines)
+}
+
+func TestRecordReplay(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	closed := newServer()
+	closed.Close()
+
+	var recording bytes.Buffer
+	recorder := NewRecorder(&recording, nil)
+	body, failure, lines := traffic(t, &http.Client{Transport: recorder}, server.URL, closed.URL)
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if body != summary || failure == nil || lines != strings.Join(streamLines, "\n")+"\n" {
+		t.Fatalf("recorded %q %v %q", body, failure, lines)
+	}
+	for _, secret := range []string{"token", "session=secret"} {
+		if strings.Contains(recording.String(), secret) {
+			t.Errorf("recording contains %q", secret)
+		}
+	}
+
+	replayer, err := NewReplayer(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayedBody, replayedFailure, replayedLines := traffic(t, &http.Client{Transport: replayer}, "http://replay", "http://closed")
+	if replayedBody != body || replayedLines != lines {
+		t.Errorf("replayed %q %q, want %q %q", replayedBody, replayedLines, body, lines)
+	}
+	var recorded *url.Error
+	if !errors.As(failure, &recorded) || replayedFailure == nil || !strings.Contains(replayedFailure.Error(), recorded.Err.Error()) {
+		t.Errorf("replayed error %v, want the recorded %v", replayedFailure, failure)
+	}
+	if remaining := replayer.Remaining(); remaining != 0 {
+		t.Errorf("%d requests not replayed", remaining)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestRecordWriteError(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	recorder := NewRecorder(failingWriter{}, nil)
+	resp, err := (&http.Client{Transport: recorder}).Get(server.URL + "/v3/accounts/1/summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := recorder.Err(); err == nil || err.Error() != "disk full" {
+		t.Errorf("error %v, want disk full", err)
+	}
+}
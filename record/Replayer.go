@@ -0,0 +1,152 @@
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Replayer is an http.RoundTripper serving the responses of a recording: each request is answered
+// by the first unused recorded request with the same method, path and query, in recording order.
+// The recorded transport errors are returned as errors with the same message
+type Replayer struct {
+	// Realtime replays the stream lines with their recorded delays, they are all sent at once otherwise
+	Realtime bool
+
+	mutex     sync.Mutex
+	exchanges []Entry
+	used      []bool
+	lines     map[int][]Entry
+}
+
+// NewReplayer loads a recording written by a Recorder.
+// Use it with api.SetHTTPClient(&http.Client{Transport: replayer})
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	p := &Replayer{lines: make(map[int][]Entry)}
+	reader := bufio.NewReader(r)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			var entry Entry
+			if errj := json.Unmarshal(data, &entry); errj != nil {
+				return nil, fmt.Errorf("record: invalid entry: %w", errj)
+			}
+			if entry.Kind == KindLine {
+				p.lines[entry.Stream] = append(p.lines[entry.Stream], entry)
+			} else {
+				p.exchanges = append(p.exchanges, entry)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.used = make([]bool, len(p.exchanges))
+	return p, nil
+}
+
+// RoundTrip answers a request with its recorded response
+func (p *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	entry, ok := p.next(requestKey(req.Method, req.URL.Path, req.URL.RawQuery))
+	if !ok {
+		return nil, fmt.Errorf("record: no recorded response for %s %s", req.Method, req.URL)
+	}
+
+	if entry.Error != "" {
+		return nil, errors.New(entry.Error)
+	}
+
+	var body io.ReadCloser
+	if entry.Kind == KindStream {
+		body = &streamReplay{lines: p.lines[entry.Stream], start: entry.Time, realtime: p.Realtime, opened: time.Now()}
+	} else {
+		body = io.NopCloser(bytes.NewReader([]byte(entry.ResponseBody)))
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+		StatusCode: entry.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     entry.ResponseHeader,
+		Body:       body,
+		Request:    req,
+	}, nil
+}
+
+// Remaining returns the number of recorded requests not replayed yet
+func (p *Replayer) Remaining() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	remaining := 0
+	for _, used := range p.used {
+		if !used {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+func (p *Replayer) next(key string) (Entry, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i, entry := range p.exchanges {
+		if p.used[i] {
+			continue
+		}
+		req, err := http.NewRequest(entry.Method, entry.URL, nil)
+		if err != nil || requestKey(req.Method, req.URL.Path, req.URL.RawQuery) != key {
+			continue
+		}
+		p.used[i] = true
+		return entry, true
+	}
+	return Entry{}, false
+}
+
+// streamReplay is the body of a replayed stream, ending after the last recorded line
+type streamReplay struct {
+	lines    []Entry
+	start    time.Time
+	opened   time.Time
+	realtime bool
+	pending  []byte
+}
+
+func (s *streamReplay) Read(b []byte) (int, error) {
+	if len(s.pending) == 0 {
+		if len(s.lines) == 0 {
+			return 0, io.EOF
+		}
+		line := s.lines[0]
+		s.lines = s.lines[1:]
+		if s.realtime {
+			time.Sleep(time.Until(s.opened.Add(line.Time.Sub(s.start))))
+		}
+		if line.Error != "" {
+			s.lines = nil
+			return 0, errors.New(line.Error)
+		}
+		s.pending = []byte(line.Line + "\n")
+	}
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *streamReplay) Close() error {
+	s.lines = nil
+	return nil
+}
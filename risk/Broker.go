@@ -0,0 +1,374 @@
+// Package risk checks the orders against configurable limits before they are sent, and provides
+// a kill switch stopping all new orders
+package risk
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+)
+
+// Reason is the reason of the rejection of an order by the risk checks
+type Reason string
+
+// The rejection reasons
+const (
+	ReasonKillSwitch        Reason = "KILL_SWITCH"
+	ReasonMarketClosed      Reason = "MARKET_CLOSED"
+	ReasonUnknownInstrument Reason = "INSTRUMENT_UNKNOWN"
+	ReasonPriceUnknown      Reason = "PRICE_UNKNOWN"
+	ReasonMinimumTradeSize  Reason = "UNITS_MINIMUM_NOT_MET"
+	ReasonMaximumOrderUnits Reason = "UNITS_LIMIT_EXCEEDED"
+	ReasonUnitsPrecision    Reason = "UNITS_PRECISION_EXCEEDED"
+	ReasonMaxUnits          Reason = "MAX_UNITS_EXCEEDED"
+	ReasonMaxNotional       Reason = "MAX_NOTIONAL_EXCEEDED"
+	ReasonMaxOpenPositions  Reason = "MAX_OPEN_POSITIONS_EXCEEDED"
+	ReasonMarginUsage       Reason = "MARGIN_USAGE_EXCEEDED"
+)
+
+// RejectError is returned for an order rejected by the risk checks, it was not sent
+type RejectError struct {
+	Reason     Reason
+	Instrument string
+	Units      int64
+	Message    string
+}
+
+func (e *RejectError) Error() string {
+	return fmt.Sprintf("risk: order of %d %s rejected: %s (%s)", e.Units, e.Instrument, e.Message, e.Reason)
+}
+
+// Instruments gets the instruments by name, it is implemented by catalog.Catalog
+type Instruments interface {
+	Get(name string) (models.Instrument, bool)
+}
+
+// Limits are the limits checked before an order is sent, the zero limits are not checked
+type Limits struct {
+	// Instruments are the tradeable instruments, with their MinimumTradeSize, MaximumOrderUnits,
+	// TradeUnitsPrecision and MarginRate. When set, the orders of other instruments are rejected
+	Instruments []models.Instrument
+	// Catalog gets the tradeable instruments instead of Instruments when set, so that the instruments of a
+	// refreshed catalog.Catalog are checked. The orders of the instruments it does not know are rejected
+	Catalog Instruments
+	// MaxUnits is the maximum absolute units of the position of an instrument, once the order is filled.
+	// The pending orders of the instrument in the direction of the order count as filled when the broker
+	// is a PendingOrderGetter, they are ignored otherwise
+	MaxUnits map[string]int64
+	// DefaultMaxUnits is the MaxUnits of the instruments missing from MaxUnits
+	DefaultMaxUnits int64
+	// MaxNotional is the maximum value of an order, in the account currency
+	MaxNotional float64
+	// MaxOpenPositions is the maximum number of instruments with an open position, or with pending orders
+	// when the broker is a PendingOrderGetter
+	MaxOpenPositions int
+	// MaxMarginUsage is the maximum ratio of the margin used to the NAV, once the order is filled
+	MaxMarginUsage float64
+	// TradingHours reports whether an instrument can be traded at a time, all the times are accepted if nil
+	TradingHours func(instrument string, t time.Time) bool
+	// Price returns the current price of an instrument, to value the market orders. When nil, or when
+	// it has no price, the orders without price are rejected if MaxNotional or MaxMarginUsage is set
+	Price func(instrument string) (models.ClientPrice, bool)
+	// HomeConversion returns the factor converting an amount in the quote currency of an instrument
+	// to the account currency, 0 when unknown, as catalog.Catalog.HomeConversion does. A factor of 1 is
+	// used if nil. The orders without conversion are rejected if MaxNotional or MaxMarginUsage is set
+	HomeConversion func(instrument string) float64
+}
+
+// PendingOrderGetter gets the pending orders of the account, it is implemented by api.API and paper.Broker
+type PendingOrderGetter interface {
+	GetPendingOrders() (*models.Orders, error)
+}
+
+// Broker is an api.Broker checking the orders against Limits before passing them to another Broker.
+// The orders are checked and sent one at a time, so that concurrent orders cannot exceed the limits
+type Broker struct {
+	broker      api.Broker
+	limits      Limits
+	instruments map[string]models.Instrument
+	now         func() time.Time
+
+	orderMutex sync.Mutex
+	mutex      sync.Mutex
+	killed     bool
+	killReason string
+}
+
+var _ api.Broker = (*Broker)(nil)
+
+// NewBroker creates a Broker checking the orders sent to broker against limits
+func NewBroker(broker api.Broker, limits Limits) *Broker {
+	b := &Broker{
+		broker:      broker,
+		limits:      limits,
+		instruments: make(map[string]models.Instrument),
+		now:         time.Now,
+	}
+	for _, instrument := range limits.Instruments {
+		b.instruments[instrument.Name] = instrument
+	}
+	return b
+}
+
+// Kill engages the kill switch: all the new orders are rejected until Resume is called.
+// Cancelling orders and closing trades remain possible
+func (b *Broker) Kill(reason string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.killed = true
+	b.killReason = reason
+}
+
+// Resume releases the kill switch
+func (b *Broker) Resume() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.killed = false
+	b.killReason = ""
+}
+
+// Killed reports whether the kill switch is engaged, and why
+func (b *Broker) Killed() (bool, string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.killed, b.killReason
+}
+
+// Check checks an order against the limits without sending it, it returns a *RejectError
+// when the order would be rejected, or the error of the broker when the account cannot be read
+func (b *Broker) Check(order models.Order) error {
+	b.orderMutex.Lock()
+	defer b.orderMutex.Unlock()
+	return b.check(&order)
+}
+
+// CreateOrder sends an order to the broker when it passes the checks
+func (b *Broker) CreateOrder(order models.Order) (*models.OrderCreateResponse, error) {
+	b.orderMutex.Lock()
+	defer b.orderMutex.Unlock()
+	if err := b.check(&order); err != nil {
+		return nil, err
+	}
+	return b.broker.CreateOrder(order)
+}
+
+// PostMarketOrder sends a market order for units of an instrument when it passes the checks
+func (b *Broker) PostMarketOrder(instrument string, units int64) (*models.OrderCreateResponse, error) {
+	return b.CreateOrder(models.MakeMarketOrder(instrument, units))
+}
+
+// CancelOrder cancels a pending order, it is never rejected
+func (b *Broker) CancelOrder(orderID string) (*models.Transaction, error) {
+	return b.broker.CancelOrder(orderID)
+}
+
+// GetOpenTrades gets the open trades of the account
+func (b *Broker) GetOpenTrades() (*models.Trades, error) {
+	return b.broker.GetOpenTrades()
+}
+
+// CloseTrade closes units of a trade, it is never rejected as it reduces the exposure
+func (b *Broker) CloseTrade(tradeID string, units int64) (*models.OrderCreateResponse, error) {
+	return b.broker.CloseTrade(tradeID, units)
+}
+
+// GetOpenPositions gets the open positions of the account
+func (b *Broker) GetOpenPositions() (*models.AccountPositions, error) {
+	return b.broker.GetOpenPositions()
+}
+
+// GetPosition gets the position of an instrument
+func (b *Broker) GetPosition(instrument string) (*models.AccountPosition, error) {
+	return b.broker.GetPosition(instrument)
+}
+
+// GetAccountSummary gets the summary of the account
+func (b *Broker) GetAccountSummary() (*models.AccountSummary, error) {
+	return b.broker.GetAccountSummary()
+}
+
+// check runs the checks in order: kill switch, trading hours, instrument limits, then the limits
+// depending on the position and the account, which are read from the broker
+func (b *Broker) check(order *models.Order) error {
+	reject := func(reason Reason, format string, args ...interface{}) error {
+		return &RejectError{Reason: reason, Instrument: order.Instrument, Units: order.Units, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if killed, reason := b.Killed(); killed {
+		return reject(ReasonKillSwitch, "kill switch engaged: %s", reason)
+	}
+	if b.limits.TradingHours != nil && order.Instrument != "" && !b.limits.TradingHours(order.Instrument, b.now()) {
+		return reject(ReasonMarketClosed, "market closed")
+	}
+	if order.Units == 0 {
+		// take profit, stop loss and trailing stop loss orders only close an existing trade
+		return nil
+	}
+
+	units := abs(order.Units)
+	instrument, known := b.instrument(order.Instrument)
+	if (b.limits.Catalog != nil || len(b.instruments) > 0) && !known {
+		return reject(ReasonUnknownInstrument, "instrument not tradeable")
+	}
+	if known {
+		if minimum := float64(instrument.MinimumTradeSize); float64(units) < minimum {
+			return reject(ReasonMinimumTradeSize, "minimum trade size is %g", minimum)
+		}
+		if maximum := float64(instrument.MaximumOrderUnits); maximum > 0 && float64(units) > maximum {
+			return reject(ReasonMaximumOrderUnits, "maximum order units is %g", maximum)
+		}
+		if instrument.RoundUnits(float64(units)) != float64(units) {
+			return reject(ReasonUnitsPrecision, "units precision is %d", instrument.TradeUnitsPrecision)
+		}
+	}
+
+	maxUnits, ok := b.limits.MaxUnits[order.Instrument]
+	if !ok {
+		maxUnits = b.limits.DefaultMaxUnits
+	}
+	var position models.Position
+	if maxUnits > 0 || b.limits.MaxOpenPositions > 0 || b.limits.MaxMarginUsage > 0 {
+		response, err := b.broker.GetPosition(order.Instrument)
+		if err != nil {
+			return err
+		}
+		position = response.Position
+	}
+	pendingGetter, hasPending := b.broker.(PendingOrderGetter)
+	var pending []models.Order
+	if hasPending && (maxUnits > 0 || b.limits.MaxOpenPositions > 0) {
+		response, err := pendingGetter.GetPendingOrders()
+		if err != nil {
+			return err
+		}
+		pending = response.Orders
+	}
+	current := position.Long.Units + position.Short.Units
+	after := current + order.Units
+	// an order reducing the position is not limited by the exposure limits
+	increasing := abs(after) > abs(current)
+	if exposure := after + pendingUnits(pending, order.Instrument, order.Units); maxUnits > 0 && increasing && abs(exposure) > maxUnits {
+		return reject(ReasonMaxUnits, "position of %d units with the pending orders exceeds %d", exposure, maxUnits)
+	}
+
+	var price float64
+	conversion := 1.0
+	if b.limits.MaxNotional > 0 || (b.limits.MaxMarginUsage > 0 && increasing) {
+		if price, ok = b.price(order); !ok {
+			return reject(ReasonPriceUnknown, "no price to value the order")
+		}
+		if conversion, ok = b.conversion(order.Instrument); !ok {
+			return reject(ReasonPriceUnknown, "no home conversion to value the order")
+		}
+	}
+	notional := float64(units) * price * conversion
+	if b.limits.MaxNotional > 0 && notional > b.limits.MaxNotional {
+		return reject(ReasonMaxNotional, "notional %.2f exceeds %.2f", notional, b.limits.MaxNotional)
+	}
+
+	if !increasing || (b.limits.MaxOpenPositions <= 0 && b.limits.MaxMarginUsage <= 0) {
+		return nil
+	}
+	summary, err := b.broker.GetAccountSummary()
+	if err != nil {
+		return err
+	}
+	if b.limits.MaxOpenPositions > 0 && hasPending {
+		exposed, err := b.exposed(pending)
+		if err != nil {
+			return err
+		}
+		if !exposed[order.Instrument] && len(exposed) >= b.limits.MaxOpenPositions {
+			return reject(ReasonMaxOpenPositions, "%d positions open or pending", len(exposed))
+		}
+	} else if b.limits.MaxOpenPositions > 0 && current == 0 && summary.OpenPositionCount >= b.limits.MaxOpenPositions {
+		return reject(ReasonMaxOpenPositions, "%d positions open", summary.OpenPositionCount)
+	}
+	if b.limits.MaxMarginUsage > 0 {
+		marginRate := math.Max(float64(instrument.MarginRate), summary.MarginRate)
+		marginUsed := summary.MarginUsed + notional*marginRate
+		if summary.NAV <= 0 || marginUsed/summary.NAV > b.limits.MaxMarginUsage {
+			return reject(ReasonMarginUsage, "margin used %.2f of NAV %.2f exceeds %g%%", marginUsed, summary.NAV, b.limits.MaxMarginUsage*100)
+		}
+	}
+	return nil
+}
+
+// price is the price of the order, or the current price it would be filled at
+func (b *Broker) price(order *models.Order) (float64, bool) {
+	if order.Price > 0 {
+		return order.Price, true
+	}
+	if b.limits.Price == nil {
+		return 0, false
+	}
+	price, ok := b.limits.Price(order.Instrument)
+	if !ok || len(price.Bids) == 0 || len(price.Asks) == 0 {
+		return 0, false
+	}
+	if order.Units > 0 {
+		return price.Asks[0].Price, true
+	}
+	return price.Bids[0].Price, true
+}
+
+// exposed returns the instruments with an open position or with pending orders opening one
+func (b *Broker) exposed(pending []models.Order) (map[string]bool, error) {
+	response, err := b.broker.GetOpenPositions()
+	if err != nil {
+		return nil, err
+	}
+	exposed := make(map[string]bool)
+	for _, position := range response.Positions {
+		if position.Long.Units != 0 || position.Short.Units != 0 {
+			exposed[position.Instrument] = true
+		}
+	}
+	for _, order := range pending {
+		if order.Units != 0 {
+			exposed[order.Instrument] = true
+		}
+	}
+	return exposed, nil
+}
+
+// pendingUnits is the sum of the units of the pending orders of an instrument in the direction of units,
+// the take profit, stop loss and trailing stop loss orders have none
+func pendingUnits(pending []models.Order, instrument string, units int64) int64 {
+	var sum int64
+	for _, order := range pending {
+		if order.Instrument == instrument && (order.Units > 0) == (units > 0) {
+			sum += order.Units
+		}
+	}
+	return sum
+}
+
+// instrument gets an instrument from the Catalog when set, or from the Instruments
+func (b *Broker) instrument(name string) (models.Instrument, bool) {
+	if b.limits.Catalog != nil {
+		return b.limits.Catalog.Get(name)
+	}
+	instrument, ok := b.instruments[name]
+	return instrument, ok
+}
+
+// conversion is the HomeConversion of an instrument, false when it is unknown
+func (b *Broker) conversion(instrument string) (float64, bool) {
+	if b.limits.HomeConversion == nil {
+		return 1, true
+	}
+	conversion := b.limits.HomeConversion(instrument)
+	return conversion, conversion > 0
+}
+
+func abs(units int64) int64 {
+	if units < 0 {
+		return -units
+	}
+	return units
+}
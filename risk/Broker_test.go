@@ -0,0 +1,57 @@
+package risk
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/burbru/goanda/models"
+	"github.com/burbru/goanda/paper"
+	"github.com/burbru/goanda/sim"
+)
+
+func newPaperBroker() *paper.Broker {
+	b := paper.NewBroker(sim.Config{
+		Balance:     10000,
+		Instruments: []models.Instrument{{Name: "EUR_USD", MarginRate: 0.02}, {Name: "USD_JPY", MarginRate: 0.02}},
+	})
+	for _, price := range []models.ClientPrice{
+		{Instrument: "EUR_USD", Bids: []models.PriceBucket{{Price: 1.2000}}, Asks: []models.PriceBucket{{Price: 1.2002}}},
+		{Instrument: "USD_JPY", Bids: []models.PriceBucket{{Price: 110.00}}, Asks: []models.PriceBucket{{Price: 110.02}}},
+	} {
+		price.Time = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+		b.Update(&price)
+	}
+	return b
+}
+
+func rejected(err error, reason Reason) bool {
+	var rejectErr *RejectError
+	return errors.As(err, &rejectErr) && rejectErr.Reason == reason
+}
+
+func TestMaxUnitsPendingOrders(t *testing.T) {
+	guard := NewBroker(newPaperBroker(), Limits{MaxUnits: map[string]int64{"EUR_USD": 1000}})
+	if _, err := guard.CreateOrder(models.MakeLimitOrder("EUR_USD", 800, 1.1990)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := guard.CreateOrder(models.MakeLimitOrder("EUR_USD", 800, 1.1980)); !rejected(err, ReasonMaxUnits) {
+		t.Errorf("error %v, want %s", err, ReasonMaxUnits)
+	}
+	if err := guard.Check(models.MakeLimitOrder("EUR_USD", -800, 1.2100)); err != nil {
+		t.Errorf("error %v, the orders of the other direction are not counted", err)
+	}
+}
+
+func TestMaxOpenPositionsPendingOrders(t *testing.T) {
+	guard := NewBroker(newPaperBroker(), Limits{MaxOpenPositions: 1})
+	if _, err := guard.CreateOrder(models.MakeLimitOrder("EUR_USD", 1000, 1.1990)); err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.Check(models.MakeMarketOrder("USD_JPY", 1000)); !rejected(err, ReasonMaxOpenPositions) {
+		t.Errorf("error %v, want %s", err, ReasonMaxOpenPositions)
+	}
+	if err := guard.Check(models.MakeMarketOrder("EUR_USD", 100)); err != nil {
+		t.Errorf("error %v, the instrument of a pending order is exposed already", err)
+	}
+}
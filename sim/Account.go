@@ -0,0 +1,390 @@
+package sim
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/burbru/goanda/models"
+)
+
+// Config is the configuration of a simulated Account
+type Config struct {
+	// ID of the account, "sim" if empty
+	ID string
+	// Alias of the account
+	Alias string
+	// Currency of the account, "USD" if empty
+	Currency string
+	// Balance is the initial balance of the account
+	Balance float64
+	// Instruments are the tradeable instruments, with their margin rate and financing
+	Instruments []models.Instrument
+	// HomeConversion returns the factor converting an amount in the quote currency of the instrument
+	// to the account currency, a factor of 1 is used if nil
+	HomeConversion func(instrument string) float64
+	// MarginCloseoutPercent is the ratio NAV / marginUsed under which all trades are closed, 0.5 if zero
+	MarginCloseoutPercent float64
+}
+
+// Account is a simulated v20 account, orders are matched against the prices given to Update
+type Account struct {
+	mutex        sync.Mutex
+	config       Config
+	instruments  map[string]models.Instrument
+	prices       map[string]models.ClientPrice
+	now          time.Time
+	nextRollover time.Time
+	balance      float64
+	pl           float64
+	financing    float64
+	instrumentPL map[string]float64
+	orders       []*pendingOrder
+	history      []*pendingOrder
+	trades       []*models.Trade
+	closed       []models.Trade
+	transactions []models.Transaction
+	lastID       int64
+	batchID      string
+	listeners    []func(models.Transaction)
+}
+
+// NewAccount creates a simulated Account from a Config
+func NewAccount(config Config) *Account {
+	if config.ID == "" {
+		config.ID = "sim"
+	}
+	if config.Currency == "" {
+		config.Currency = "USD"
+	}
+	if config.MarginCloseoutPercent == 0 {
+		config.MarginCloseoutPercent = 0.5
+	}
+	instruments := make(map[string]models.Instrument)
+	for _, instrument := range config.Instruments {
+		instruments[instrument.Name] = instrument
+	}
+	return &Account{
+		config:       config,
+		instruments:  instruments,
+		prices:       make(map[string]models.ClientPrice),
+		balance:      config.Balance,
+		instrumentPL: make(map[string]float64),
+	}
+}
+
+// OnTransaction registers a function called for every transaction of the account,
+// it is called while the account is locked and must not call back into the Account
+func (a *Account) OnTransaction(f func(models.Transaction)) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.listeners = append(a.listeners, f)
+}
+
+// Time is the time of the last price received by the account
+func (a *Account) Time() time.Time {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.now
+}
+
+// Price returns the last price received for an instrument
+func (a *Account) Price(instrument string) (models.ClientPrice, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	price, ok := a.prices[instrument]
+	return price, ok
+}
+
+// Update moves the account to the time of the price, charging financing at the daily rollovers,
+// then triggers the pending orders of the instrument and closes out the account if margin is exhausted
+func (a *Account) Update(price *models.ClientPrice) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.advance(price.Time)
+	a.prices[price.Instrument] = *price
+	a.batchID = ""
+	a.matchOrders(price.Instrument)
+	a.checkMarginCloseout()
+}
+
+// Summary returns the current state of the account
+func (a *Account) Summary() models.AccountSummary {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	unrealizedPL, marginUsed, positionValue := 0.0, 0.0, 0.0
+	positions := make(map[string]bool)
+	for _, trade := range a.trades {
+		unrealizedPL += a.unrealizedPL(trade)
+		marginUsed += a.marginUsed(trade)
+		positionValue += a.positionValue(trade)
+		positions[trade.Instrument] = true
+	}
+	nav := a.balance + unrealizedPL
+	return models.AccountSummary{
+		ID:                a.config.ID,
+		Alias:             a.config.Alias,
+		Currency:          a.config.Currency,
+		Balance:           a.balance,
+		NAV:               nav,
+		UnrealizedPL:      unrealizedPL,
+		PL:                a.pl,
+		Financing:         a.financing,
+		MarginUsed:        marginUsed,
+		MarginAvailable:   nav - marginUsed,
+		PositionValue:     positionValue,
+		OpenTradeCount:    len(a.trades),
+		OpenPositionCount: len(positions),
+		PendingOrderCount: len(a.orders),
+		LastTransactionID: a.lastTransactionID(),
+	}
+}
+
+// OpenTrades returns the open trades, valued at the last prices
+func (a *Account) OpenTrades() []models.Trade {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	trades := make([]models.Trade, 0, len(a.trades))
+	for _, trade := range a.trades {
+		trades = append(trades, a.valued(trade))
+	}
+	return trades
+}
+
+// Trade returns an open or closed trade by ID
+func (a *Account) Trade(tradeID string) (models.Trade, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if trade := a.openTrade(tradeID); trade != nil {
+		return a.valued(trade), true
+	}
+	for _, trade := range a.closed {
+		if trade.ID == tradeID {
+			return trade, true
+		}
+	}
+	return models.Trade{}, false
+}
+
+// ClosedTrades returns the closed trades, in the order they were closed
+func (a *Account) ClosedTrades() []models.Trade {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return append([]models.Trade(nil), a.closed...)
+}
+
+// PendingOrders returns the pending orders
+func (a *Account) PendingOrders() []models.Order {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	orders := make([]models.Order, 0, len(a.orders))
+	for _, p := range a.orders {
+		orders = append(orders, p.order)
+	}
+	return orders
+}
+
+// Positions returns the open positions, aggregated from the open trades
+func (a *Account) Positions() []models.Position {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	byInstrument := make(map[string]*models.Position)
+	var names []string
+	for _, trade := range a.trades {
+		position, ok := byInstrument[trade.Instrument]
+		if !ok {
+			position = &models.Position{Instrument: trade.Instrument}
+			byInstrument[trade.Instrument] = position
+			names = append(names, trade.Instrument)
+		}
+		side := &position.Long
+		if trade.CurrentUnits < 0 {
+			side = &position.Short
+		}
+		units := side.Units + trade.CurrentUnits
+		side.AveragePrice = (side.AveragePrice*float64(side.Units) + trade.Price*float64(trade.CurrentUnits)) / float64(units)
+		side.Units = units
+		side.TradeIDs = append(side.TradeIDs, trade.ID)
+		side.UnrealizedPL += a.unrealizedPL(trade)
+		position.UnrealizedPL += a.unrealizedPL(trade)
+		position.MarginUsed += a.marginUsed(trade)
+		position.Financing += trade.Financing
+	}
+	sort.Strings(names)
+	positions := make([]models.Position, 0, len(names))
+	for _, name := range names {
+		position := byInstrument[name]
+		position.PL = a.instrumentPL[name]
+		positions = append(positions, *position)
+	}
+	return positions
+}
+
+// Transactions returns all the transactions of the account
+func (a *Account) Transactions() []models.Transaction {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return append([]models.Transaction(nil), a.transactions...)
+}
+
+// TransactionsSince returns the transactions with an ID greater than id
+func (a *Account) TransactionsSince(id string) []models.Transaction {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	since, _ := strconv.ParseInt(id, 10, 64)
+	if since < 0 || since > int64(len(a.transactions)) {
+		return nil
+	}
+	return append([]models.Transaction(nil), a.transactions[since:]...)
+}
+
+func (a *Account) lastTransactionID() string {
+	return strconv.FormatInt(a.lastID, 10)
+}
+
+// newTransaction creates a transaction of type, with the next ID, in the current batch
+func (a *Account) newTransaction(transactionType string) models.Transaction {
+	a.lastID++
+	id := strconv.FormatInt(a.lastID, 10)
+	if a.batchID == "" {
+		a.batchID = id
+	}
+	return models.Transaction{
+		ID:        id,
+		Type:      transactionType,
+		Time:      a.now,
+		AccountID: a.config.ID,
+		BatchID:   a.batchID,
+	}
+}
+
+// record stores a transaction and notifies the listeners
+func (a *Account) record(transaction models.Transaction) *models.Transaction {
+	a.transactions = append(a.transactions, transaction)
+	for _, listener := range a.listeners {
+		listener(transaction)
+	}
+	return &transaction
+}
+
+func (a *Account) conversion(instrument string) float64 {
+	if a.config.HomeConversion == nil {
+		return 1
+	}
+	return a.config.HomeConversion(instrument)
+}
+
+func (a *Account) openTrade(tradeID string) *models.Trade {
+	for _, trade := range a.trades {
+		if trade.ID == tradeID {
+			return trade
+		}
+	}
+	return nil
+}
+
+// closePrice is the price at which a trade would be closed now
+func (a *Account) closePrice(instrument string, units int64) (float64, bool) {
+	price, ok := a.prices[instrument]
+	if !ok {
+		return 0, false
+	}
+	if units > 0 {
+		return bid(&price)
+	}
+	return ask(&price)
+}
+
+func (a *Account) unrealizedPL(trade *models.Trade) float64 {
+	price, ok := a.closePrice(trade.Instrument, trade.CurrentUnits)
+	if !ok {
+		return 0
+	}
+	return float64(trade.CurrentUnits) * (price - trade.Price) * a.conversion(trade.Instrument)
+}
+
+func (a *Account) positionValue(trade *models.Trade) float64 {
+	price, ok := a.prices[trade.Instrument]
+	if !ok {
+		return 0
+	}
+	return math.Abs(float64(trade.CurrentUnits)) * mid(&price) * a.conversion(trade.Instrument)
+}
+
+func (a *Account) marginUsed(trade *models.Trade) float64 {
+	instrument := a.instruments[trade.Instrument]
+	return a.positionValue(trade) * float64(instrument.MarginRate)
+}
+
+// valued returns a copy of the trade with its unrealized P/L and margin
+func (a *Account) valued(trade *models.Trade) models.Trade {
+	t := *trade
+	t.UnrealizedPL = a.unrealizedPL(trade)
+	t.MarginUsed = a.marginUsed(trade)
+	return t
+}
+
+func (a *Account) nav() (float64, float64) {
+	nav, marginUsed := a.balance, 0.0
+	for _, trade := range a.trades {
+		nav += a.unrealizedPL(trade)
+		marginUsed += a.marginUsed(trade)
+	}
+	return nav, marginUsed
+}
+
+// checkMarginCloseout closes all the trades when the NAV falls under the closeout level
+func (a *Account) checkMarginCloseout() {
+	nav, marginUsed := a.nav()
+	if marginUsed == 0 || nav > marginUsed*a.config.MarginCloseoutPercent {
+		return
+	}
+	for len(a.trades) > 0 {
+		trade := a.trades[0]
+		price, ok := a.closePrice(trade.Instrument, trade.CurrentUnits)
+		if !ok {
+			return
+		}
+		order := a.newTransaction(models.TransactionTypeMarketOrder)
+		order.Instrument = trade.Instrument
+		order.Units = -trade.CurrentUnits
+		order.TimeInForce = models.TimeInForceFOK
+		order.Reason = "MARGIN_CLOSEOUT"
+		a.record(order)
+		fill := a.fillTransaction(order.ID, trade.Instrument, -trade.CurrentUnits, price, "MARKET_ORDER_MARGIN_CLOSEOUT")
+		reduce := a.reduceTrade(trade, trade.CurrentUnits, price, fill.ID)
+		fill.TradesClosed = append(fill.TradesClosed, reduce)
+		a.recordFill(&fill)
+	}
+}
+
+func bid(price *models.ClientPrice) (float64, bool) {
+	if len(price.Bids) == 0 {
+		return 0, false
+	}
+	return price.Bids[0].Price, true
+}
+
+func ask(price *models.ClientPrice) (float64, bool) {
+	if len(price.Asks) == 0 {
+		return 0, false
+	}
+	return price.Asks[0].Price, true
+}
+
+func mid(price *models.ClientPrice) float64 {
+	b, okb := bid(price)
+	a, oka := ask(price)
+	switch {
+	case okb && oka:
+		return (a + b) / 2
+	case okb:
+		return b
+	}
+	return a
+}
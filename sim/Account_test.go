@@ -0,0 +1,154 @@
+package sim
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/burbru/goanda/models"
+)
+
+// monday is a Monday 07:00 in New York, before the 17:00 rollover
+var monday = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newAccount() *Account {
+	return NewAccount(Config{
+		Balance: 10000,
+		Instruments: []models.Instrument{{
+			Name:       "EUR_USD",
+			MarginRate: 0.02,
+			Financing:  models.Financing{LongRate: -0.0365, ShortRate: 0.0073},
+		}},
+	})
+}
+
+func setPrice(a *Account, at time.Time, bid float64, ask float64) {
+	a.Update(&models.ClientPrice{
+		Instrument: "EUR_USD",
+		Time:       at,
+		Bids:       []models.PriceBucket{{Price: bid, Liquidity: 1000000}},
+		Asks:       []models.PriceBucket{{Price: ask, Liquidity: 1000000}},
+	})
+}
+
+func market(units int64) models.Order {
+	return models.Order{Type: models.OrderTypeMarket, Instrument: "EUR_USD", Units: units}
+}
+
+func almostEqual(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestMarketFill(t *testing.T) {
+	a := newAccount()
+	setPrice(a, monday, 1.2000, 1.2002)
+
+	response, err := a.CreateOrder(market(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill := response.OrderFillTransaction
+	if fill == nil || fill.TradeOpened == nil || fill.Price != 1.2002 || fill.TradeOpened.Units != 1000 {
+		t.Fatalf("fill %+v, want a trade opened at the ask", fill)
+	}
+	summary := a.Summary()
+	if summary.Balance != 10000 || !almostEqual(summary.UnrealizedPL, -0.2) || !almostEqual(summary.MarginUsed, 1000*1.2001*0.02) {
+		t.Errorf("summary %+v", summary)
+	}
+
+	if _, err := a.CreateOrder(market(0)); err == nil {
+		t.Error("order without units filled")
+	}
+}
+
+func TestNetting(t *testing.T) {
+	a := newAccount()
+	setPrice(a, monday, 1.2000, 1.2002)
+	if _, err := a.CreateOrder(market(1000)); err != nil {
+		t.Fatal(err)
+	}
+	setPrice(a, monday.Add(time.Minute), 1.2012, 1.2014)
+
+	// a sell reduces the long trade
+	response, err := a.CreateOrder(market(-400))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill := response.OrderFillTransaction
+	if fill.TradeReduced == nil || fill.TradeReduced.Units != -400 || fill.TradeOpened != nil {
+		t.Fatalf("fill %+v, want the trade reduced", fill)
+	}
+	if !almostEqual(fill.PL, 400*0.001) {
+		t.Errorf("realized P/L %g, want %g", fill.PL, 400*0.001)
+	}
+
+	// a larger sell closes the trade and opens a short one with the remaining units
+	response, err = a.CreateOrder(market(-1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill = response.OrderFillTransaction
+	if len(fill.TradesClosed) != 1 || fill.TradesClosed[0].Units != -600 || fill.TradeOpened == nil || fill.TradeOpened.Units != -400 {
+		t.Fatalf("fill %+v, want the trade closed and a short trade opened", fill)
+	}
+	trades := a.OpenTrades()
+	if len(trades) != 1 || trades[0].CurrentUnits != -400 {
+		t.Fatalf("open trades %+v", trades)
+	}
+	if summary := a.Summary(); !almostEqual(summary.Balance, 10000+1000*0.001) || !almostEqual(summary.PL, 1000*0.001) {
+		t.Errorf("balance %g P/L %g", summary.Balance, summary.PL)
+	}
+}
+
+func TestPendingOrder(t *testing.T) {
+	a := newAccount()
+	setPrice(a, monday, 1.2000, 1.2002)
+	response, err := a.CreateOrder(models.Order{Type: models.OrderTypeLimit, Instrument: "EUR_USD", Units: 1000, Price: 1.1990})
+	if err != nil || response.OrderFillTransaction != nil {
+		t.Fatalf("%+v %v, want a pending order", response, err)
+	}
+	setPrice(a, monday.Add(time.Minute), 1.1993, 1.1995)
+	if len(a.OpenTrades()) != 0 {
+		t.Fatal("limit order filled above its price")
+	}
+	setPrice(a, monday.Add(2*time.Minute), 1.1986, 1.1988)
+	trades := a.OpenTrades()
+	if len(trades) != 1 || trades[0].Price != 1.1988 {
+		t.Fatalf("open trades %+v, want a trade at the ask", trades)
+	}
+	if order, _ := a.Order(response.OrderCreateTransaction.ID); order.State != models.OrderStateFilled {
+		t.Errorf("order %s, want filled", order.State)
+	}
+}
+
+func TestDailyFinancing(t *testing.T) {
+	a := newAccount()
+	setPrice(a, monday, 1.2000, 1.2002)
+	if _, err := a.CreateOrder(market(1000)); err != nil {
+		t.Fatal(err)
+	}
+	// the netting reduces the trade, the financing is charged on the 600 units left
+	if _, err := a.CreateOrder(market(-400)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the 17:00 New York rollover of a Monday charges one day
+	setPrice(a, monday.Add(11*time.Hour), 1.2000, 1.2002)
+	var financing *models.Transaction
+	for _, transaction := range a.Transactions() {
+		if transaction.Type == models.TransactionTypeDailyFinancing {
+			transaction := transaction
+			financing = &transaction
+		}
+	}
+	want := 600 * 1.2001 * -0.0365 / 365
+	if financing == nil || !almostEqual(financing.Financing, want) {
+		t.Fatalf("financing %+v, want %g", financing, want)
+	}
+	if len(financing.PositionFinancings) != 1 || len(financing.PositionFinancings[0].OpenTradeFinancings) != 1 {
+		t.Errorf("position financings %+v", financing.PositionFinancings)
+	}
+	if summary := a.Summary(); !almostEqual(summary.Financing, want) || !almostEqual(financing.AccountBalance, summary.Balance) {
+		t.Errorf("summary %+v", summary)
+	}
+}
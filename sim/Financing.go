@@ -0,0 +1,87 @@
+package sim
+
+import (
+	"math"
+	"time"
+
+	"github.com/burbru/goanda/calendar"
+	"github.com/burbru/goanda/models"
+)
+
+// newYork is the location of the daily rollover, at 17:00
+var newYork = calendar.NewYork
+
+// RolloverAfter returns the first daily rollover (17:00 New York time) strictly after t
+func RolloverAfter(t time.Time) time.Time {
+	return calendar.RolloverAfter(t)
+}
+
+// advance moves the account time to t, charging financing and expiring orders at each rollover crossed
+func (a *Account) advance(t time.Time) {
+	if t.Before(a.now) {
+		return
+	}
+	if a.nextRollover.IsZero() {
+		a.nextRollover = RolloverAfter(t)
+	}
+	for !t.Before(a.nextRollover) {
+		a.now = a.nextRollover
+		a.batchID = ""
+		a.chargeFinancing()
+		a.expireOrders(true)
+		a.nextRollover = RolloverAfter(a.nextRollover)
+	}
+	a.now = t
+	a.batchID = ""
+	a.expireOrders(false)
+}
+
+// chargeFinancing applies the daily financing of the open trades at the last prices,
+// units * price * rate / 365 for each day charged on the weekday of the rollover
+func (a *Account) chargeFinancing() {
+	weekday := a.now.In(newYork).Weekday()
+	var financings []models.PositionFinancing
+	total := 0.0
+	for _, trade := range a.trades {
+		instrument := a.instruments[trade.Instrument]
+		days := instrument.Financing.DaysCharged(weekday)
+		price, ok := a.prices[trade.Instrument]
+		if days == 0 || !ok {
+			continue
+		}
+		rate := float64(instrument.Financing.LongRate)
+		if trade.CurrentUnits < 0 {
+			rate = float64(instrument.Financing.ShortRate)
+		}
+		financing := math.Abs(float64(trade.CurrentUnits)) * mid(&price) * rate * float64(days) / 365 * a.conversion(trade.Instrument)
+
+		trade.Financing += financing
+		a.balance += financing
+		a.financing += financing
+		total += financing
+
+		var position *models.PositionFinancing
+		for i := range financings {
+			if financings[i].Instrument == trade.Instrument {
+				position = &financings[i]
+			}
+		}
+		if position == nil {
+			financings = append(financings, models.PositionFinancing{Instrument: trade.Instrument})
+			position = &financings[len(financings)-1]
+		}
+		position.Financing += financing
+		position.OpenTradeFinancings = append(position.OpenTradeFinancings, models.OpenTradeFinancing{
+			TradeID:   trade.ID,
+			Financing: financing,
+		})
+	}
+	if len(financings) == 0 {
+		return
+	}
+	transaction := a.newTransaction(models.TransactionTypeDailyFinancing)
+	transaction.Financing = total
+	transaction.AccountBalance = a.balance
+	transaction.PositionFinancings = financings
+	a.record(transaction)
+}
@@ -0,0 +1,631 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/burbru/goanda/models"
+)
+
+// pendingOrder is an order waiting for its trigger condition
+type pendingOrder struct {
+	order      models.Order
+	instrument string
+	// above is true when a MarketIfTouched order price was above the market at creation
+	above bool
+	// stop is the current level of a trailing stop loss
+	stop float64
+}
+
+// CreateOrder creates an order, market orders are filled immediately at the last price of the instrument
+// and the other orders are pending until triggered by a price Update
+func (a *Account) CreateOrder(order models.Order) (*models.OrderCreateResponse, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.batchID = ""
+
+	response := &models.OrderCreateResponse{}
+	defer func() {
+		response.LastTransactionID = a.lastTransactionID()
+	}()
+
+	if !validOrderType(order.Type) {
+		return response, fmt.Errorf("sim: unsupported order type %q", order.Type)
+	}
+	if order.TimeInForce == "" {
+		order.TimeInForce = models.TimeInForceGTC
+		if order.Type == models.OrderTypeMarket {
+			order.TimeInForce = models.TimeInForceFOK
+		}
+	}
+	if order.PositionFill == "" && isEntryOrder(order.Type) {
+		order.PositionFill = models.PositionFillDefault
+	}
+
+	instrument, rejectReason := a.validate(&order)
+	if rejectReason != "" {
+		reject := a.orderTransaction(&order, order.Type+"_ORDER_REJECT", models.ReasonClientOrder)
+		reject.RejectReason = rejectReason
+		response.OrderRejectTransaction = a.record(reject)
+		response.RelatedTransactionIDs = []string{reject.ID}
+		return response, errors.New("sim: order rejected: " + rejectReason)
+	}
+
+	create := a.orderTransaction(&order, order.Type+"_ORDER", models.ReasonClientOrder)
+	response.OrderCreateTransaction = a.record(create)
+	order.ID = create.ID
+	order.State = models.OrderStatePending
+	createTime := a.now
+	order.CreateTime = &createTime
+
+	p := &pendingOrder{order: order, instrument: instrument}
+	a.history = append(a.history, p)
+	if order.Type == models.OrderTypeMarket {
+		fill, cancel := a.executeMarket(p)
+		response.OrderFillTransaction, response.OrderCancelTransaction = fill, cancel
+	} else {
+		a.addPending(p)
+		response.OrderFillTransaction, response.OrderCancelTransaction = a.trigger(p)
+	}
+	for i := len(a.transactions) - 1; i >= 0 && a.transactions[i].BatchID == a.batchID; i-- {
+		response.RelatedTransactionIDs = append([]string{a.transactions[i].ID}, response.RelatedTransactionIDs...)
+	}
+	return response, nil
+}
+
+// CancelOrder cancels a pending order by ID or by @clientID
+func (a *Account) CancelOrder(orderID string) (*models.Transaction, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.batchID = ""
+
+	for _, p := range a.orders {
+		if matchesID(orderID, p.order.ID, p.order.ClientExtensions) {
+			return a.cancel(p, models.ReasonClientRequest), nil
+		}
+	}
+	reject := a.newTransaction(models.TransactionTypeOrderCancelReject)
+	reject.OrderID = orderID
+	reject.RejectReason = models.ReasonOrderDoesntExist
+	a.record(reject)
+	return nil, errors.New("sim: order " + orderID + " does not exist")
+}
+
+// Order returns a pending, filled or cancelled order by ID or by @clientID
+func (a *Account) Order(orderID string) (models.Order, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, p := range a.history {
+		if matchesID(orderID, p.order.ID, p.order.ClientExtensions) {
+			return p.order, true
+		}
+	}
+	return models.Order{}, false
+}
+
+// CloseTrade closes units of an open trade at market, all the units are closed when units is 0
+func (a *Account) CloseTrade(tradeID string, units int64) (*models.OrderCreateResponse, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.batchID = ""
+
+	response := &models.OrderCreateResponse{}
+	defer func() {
+		response.LastTransactionID = a.lastTransactionID()
+	}()
+
+	var trade *models.Trade
+	for _, t := range a.trades {
+		if matchesID(tradeID, t.ID, t.ClientExtensions) {
+			trade = t
+		}
+	}
+	if trade == nil {
+		return response, errors.New("sim: trade " + tradeID + " does not exist")
+	}
+	if units == 0 {
+		units = trade.CurrentUnits
+	}
+	units = int64(math.Abs(float64(units)))
+	if trade.CurrentUnits < 0 {
+		units = -units
+	}
+	if math.Abs(float64(units)) > math.Abs(float64(trade.CurrentUnits)) {
+		return response, fmt.Errorf("sim: cannot close %d units of trade %s", units, tradeID)
+	}
+
+	order := models.Order{
+		Type:        models.OrderTypeMarket,
+		Instrument:  trade.Instrument,
+		Units:       -units,
+		TimeInForce: models.TimeInForceFOK,
+		TradeID:     trade.ID,
+	}
+	create := a.orderTransaction(&order, models.TransactionTypeMarketOrder, models.ReasonTradeClose)
+	response.OrderCreateTransaction = a.record(create)
+
+	price, ok := a.closePrice(trade.Instrument, trade.CurrentUnits)
+	if !ok {
+		response.OrderCancelTransaction = a.cancelTransaction(create.ID, "", models.ReasonMarketHalted)
+		return response, nil
+	}
+	fill := a.fillTransaction(create.ID, trade.Instrument, -units, price, models.ReasonMarketOrderTradeClose)
+	reduce := a.reduceTrade(trade, units, price, fill.ID)
+	if trade.CurrentUnits == 0 {
+		fill.TradesClosed = append(fill.TradesClosed, reduce)
+	} else {
+		fill.TradeReduced = &reduce
+	}
+	response.OrderFillTransaction = a.recordFill(&fill)
+	return response, nil
+}
+
+func validOrderType(orderType string) bool {
+	switch orderType {
+	case models.OrderTypeMarket, models.OrderTypeLimit, models.OrderTypeStop, models.OrderTypeMarketIfTouched,
+		models.OrderTypeTakeProfit, models.OrderTypeStopLoss, models.OrderTypeTrailingStopLoss:
+		return true
+	}
+	return false
+}
+
+func isEntryOrder(orderType string) bool {
+	switch orderType {
+	case models.OrderTypeTakeProfit, models.OrderTypeStopLoss, models.OrderTypeTrailingStopLoss:
+		return false
+	}
+	return true
+}
+
+// matchesID matches an ID, or a client ID when id starts with @
+func matchesID(id string, objectID string, extensions *models.ClientExtensions) bool {
+	if strings.HasPrefix(id, "@") {
+		return extensions != nil && extensions.ID == id[1:]
+	}
+	return id == objectID
+}
+
+// validate checks an order and returns its instrument or the reason to reject it
+func (a *Account) validate(order *models.Order) (string, string) {
+	if order.TimeInForce == models.TimeInForceGTD && order.GtdTime == nil {
+		return "", "TIME_IN_FORCE_GTD_TIMESTAMP_MISSING"
+	}
+	if !isEntryOrder(order.Type) {
+		if order.TradeID == "" {
+			return "", "TRADE_ID_MISSING"
+		}
+		trade := a.openTrade(order.TradeID)
+		if trade == nil {
+			return "", models.ReasonTradeDoesntExist
+		}
+		if a.dependentOrderID(trade, order.Type) != "" {
+			return "", order.Type + "_ORDER_ALREADY_EXISTS"
+		}
+		if order.Type == models.OrderTypeTrailingStopLoss && order.Distance <= 0 {
+			return "", "TRAILING_STOP_LOSS_ORDER_DISTANCE_MISSING"
+		}
+		if order.Type != models.OrderTypeTrailingStopLoss && order.Price <= 0 && order.Distance <= 0 {
+			return "", "PRICE_MISSING"
+		}
+		return trade.Instrument, ""
+	}
+	if _, ok := a.instruments[order.Instrument]; !ok {
+		return "", models.ReasonInstrumentUnknown
+	}
+	if order.Units == 0 {
+		return "", "UNITS_INVALID"
+	}
+	if order.Type == models.OrderTypeMarket {
+		if order.TimeInForce != models.TimeInForceFOK && order.TimeInForce != models.TimeInForceIOC {
+			return "", "TIME_IN_FORCE_INVALID"
+		}
+	} else if order.Price <= 0 {
+		return "", "PRICE_MISSING"
+	}
+	return order.Instrument, ""
+}
+
+// orderTransaction creates the creation or rejection transaction of an order
+func (a *Account) orderTransaction(order *models.Order, transactionType string, reason string) models.Transaction {
+	transaction := a.newTransaction(transactionType)
+	transaction.Instrument = order.Instrument
+	transaction.Units = order.Units
+	transaction.Price = order.Price
+	transaction.PriceBound = order.PriceBound
+	transaction.Distance = order.Distance
+	transaction.TimeInForce = order.TimeInForce
+	transaction.PositionFill = order.PositionFill
+	transaction.TradeID = order.TradeID
+	transaction.Reason = reason
+	transaction.ClientExtensions = order.ClientExtensions
+	return transaction
+}
+
+func (a *Account) cancelTransaction(orderID string, clientOrderID string, reason string) *models.Transaction {
+	cancel := a.newTransaction(models.TransactionTypeOrderCancel)
+	cancel.OrderID = orderID
+	cancel.ClientOrderID = clientOrderID
+	cancel.Reason = reason
+	return a.record(cancel)
+}
+
+func (a *Account) fillTransaction(orderID string, instrument string, units int64, price float64, reason string) models.Transaction {
+	fill := a.newTransaction(models.TransactionTypeOrderFill)
+	fill.OrderID = orderID
+	fill.Instrument = instrument
+	fill.Units = units
+	fill.Price = price
+	fill.Reason = reason
+	return fill
+}
+
+// recordFill completes a fill with its P/L and the resulting balance, and cancels the orders of the closed trades
+func (a *Account) recordFill(fill *models.Transaction) *models.Transaction {
+	for _, closed := range fill.TradesClosed {
+		fill.PL += closed.RealizedPL
+	}
+	if fill.TradeReduced != nil {
+		fill.PL += fill.TradeReduced.RealizedPL
+	}
+	fill.AccountBalance = a.balance
+	recorded := a.record(*fill)
+	for _, closed := range fill.TradesClosed {
+		a.cancelLinked(closed.TradeID)
+	}
+	return recorded
+}
+
+func (a *Account) addPending(p *pendingOrder) {
+	price, ok := a.prices[p.instrument]
+	switch p.order.Type {
+	case models.OrderTypeMarketIfTouched:
+		p.above = ok && p.order.Price > mid(&price)
+	case models.OrderTypeTakeProfit, models.OrderTypeStopLoss, models.OrderTypeTrailingStopLoss:
+		trade := a.openTrade(p.order.TradeID)
+		if p.order.Type == models.OrderTypeStopLoss && p.order.Price <= 0 {
+			p.order.Price = trade.Price - p.order.Distance*sign(trade.CurrentUnits)
+		}
+		if p.order.Type == models.OrderTypeTrailingStopLoss {
+			current, ok := a.closePrice(trade.Instrument, trade.CurrentUnits)
+			if !ok {
+				current = trade.Price
+			}
+			p.stop = current - p.order.Distance*sign(trade.CurrentUnits)
+		}
+		a.setDependentOrderID(trade, p.order.Type, p.order.ID)
+	}
+	a.orders = append(a.orders, p)
+}
+
+func (a *Account) removePending(p *pendingOrder) {
+	for i, o := range a.orders {
+		if o == p {
+			a.orders = append(a.orders[:i], a.orders[i+1:]...)
+			return
+		}
+	}
+}
+
+func (a *Account) cancel(p *pendingOrder, reason string) *models.Transaction {
+	a.removePending(p)
+	p.order.State = models.OrderStateCancelled
+	if trade := a.openTrade(p.order.TradeID); trade != nil {
+		a.setDependentOrderID(trade, p.order.Type, "")
+	}
+	clientOrderID := ""
+	if p.order.ClientExtensions != nil {
+		clientOrderID = p.order.ClientExtensions.ID
+	}
+	return a.cancelTransaction(p.order.ID, clientOrderID, reason)
+}
+
+// cancelLinked cancels the take profit, stop loss and trailing stop loss orders of a closed trade
+func (a *Account) cancelLinked(tradeID string) {
+	for _, p := range append([]*pendingOrder(nil), a.orders...) {
+		if p.order.TradeID == tradeID {
+			a.cancel(p, models.ReasonLinkedTradeClosed)
+		}
+	}
+}
+
+func (a *Account) dependentOrderID(trade *models.Trade, orderType string) string {
+	switch orderType {
+	case models.OrderTypeTakeProfit:
+		return trade.TakeProfitOrderID
+	case models.OrderTypeStopLoss:
+		return trade.StopLossOrderID
+	case models.OrderTypeTrailingStopLoss:
+		return trade.TrailingStopLossOrderID
+	}
+	return ""
+}
+
+func (a *Account) setDependentOrderID(trade *models.Trade, orderType string, orderID string) {
+	switch orderType {
+	case models.OrderTypeTakeProfit:
+		trade.TakeProfitOrderID = orderID
+	case models.OrderTypeStopLoss:
+		trade.StopLossOrderID = orderID
+	case models.OrderTypeTrailingStopLoss:
+		trade.TrailingStopLossOrderID = orderID
+	}
+}
+
+// expireOrders cancels the GTD orders past their time, and the GFD orders at the rollover
+func (a *Account) expireOrders(rollover bool) {
+	for _, p := range append([]*pendingOrder(nil), a.orders...) {
+		expired := p.order.TimeInForce == models.TimeInForceGTD && p.order.GtdTime != nil && !a.now.Before(*p.order.GtdTime)
+		if expired || (rollover && p.order.TimeInForce == models.TimeInForceGFD) {
+			a.cancel(p, models.ReasonTimeInForceExpired)
+		}
+	}
+}
+
+// matchOrders triggers the pending orders of an instrument
+func (a *Account) matchOrders(instrument string) {
+	for _, p := range append([]*pendingOrder(nil), a.orders...) {
+		if p.instrument == instrument && p.order.State == models.OrderStatePending {
+			a.trigger(p)
+		}
+	}
+}
+
+// trigger fills a pending order if its price condition is met by the last price
+func (a *Account) trigger(p *pendingOrder) (*models.Transaction, *models.Transaction) {
+	price, ok := a.prices[p.instrument]
+	if !ok {
+		return nil, nil
+	}
+	b, okb := bid(&price)
+	k, oka := ask(&price)
+	if !okb || !oka {
+		return nil, nil
+	}
+	order := &p.order
+
+	if !isEntryOrder(order.Type) {
+		trade := a.openTrade(order.TradeID)
+		if trade == nil {
+			return nil, nil
+		}
+		long := trade.CurrentUnits > 0
+		current := k
+		if long {
+			current = b
+		}
+		triggered := false
+		switch order.Type {
+		case models.OrderTypeTakeProfit:
+			triggered = (long && current >= order.Price) || (!long && current <= order.Price)
+		case models.OrderTypeStopLoss:
+			triggered = (long && current <= order.Price) || (!long && current >= order.Price)
+		case models.OrderTypeTrailingStopLoss:
+			if long {
+				p.stop = math.Max(p.stop, current-order.Distance)
+				triggered = current <= p.stop
+			} else {
+				p.stop = math.Min(p.stop, current+order.Distance)
+				triggered = current >= p.stop
+			}
+		}
+		if !triggered {
+			return nil, nil
+		}
+		a.removePending(p)
+		order.State = models.OrderStateFilled
+		fill := a.fillTransaction(order.ID, trade.Instrument, -trade.CurrentUnits, current, order.Type+"_ORDER")
+		fill.TradesClosed = append(fill.TradesClosed, a.reduceTrade(trade, trade.CurrentUnits, current, fill.ID))
+		return a.recordFill(&fill), nil
+	}
+
+	current := k
+	if order.Units < 0 {
+		current = b
+	}
+	buy := order.Units > 0
+	triggered := false
+	switch order.Type {
+	case models.OrderTypeLimit:
+		triggered = (buy && current <= order.Price) || (!buy && current >= order.Price)
+	case models.OrderTypeStop:
+		triggered = (buy && current >= order.Price) || (!buy && current <= order.Price)
+	case models.OrderTypeMarketIfTouched:
+		triggered = (p.above && current >= order.Price) || (!p.above && current <= order.Price)
+	}
+	if !triggered {
+		return nil, nil
+	}
+	a.removePending(p)
+	return a.execute(p, current)
+}
+
+// executeMarket fills a market order at the last price
+func (a *Account) executeMarket(p *pendingOrder) (*models.Transaction, *models.Transaction) {
+	price, ok := a.prices[p.instrument]
+	current, okp := ask(&price)
+	if p.order.Units < 0 {
+		current, okp = bid(&price)
+	}
+	if !ok || !okp {
+		p.order.State = models.OrderStateCancelled
+		return nil, a.cancelTransaction(p.order.ID, clientID(&p.order), models.ReasonMarketHalted)
+	}
+	return a.execute(p, current)
+}
+
+// execute fills an entry order at price, reducing the opposite trades first unless the order is OPEN_ONLY
+func (a *Account) execute(p *pendingOrder, price float64) (*models.Transaction, *models.Transaction) {
+	order := &p.order
+	if order.PriceBound > 0 && ((order.Units > 0 && price > order.PriceBound) || (order.Units < 0 && price < order.PriceBound)) {
+		order.State = models.OrderStateCancelled
+		return nil, a.cancelTransaction(order.ID, clientID(order), models.ReasonBoundsViolation)
+	}
+
+	remaining := order.Units
+	var reduced []*models.Trade
+	freedMargin := 0.0
+	if order.PositionFill != models.PositionFillOpenOnly {
+		for _, trade := range a.trades {
+			if remaining == 0 {
+				break
+			}
+			if trade.Instrument != p.instrument || sign(trade.CurrentUnits) == sign(remaining) {
+				continue
+			}
+			units := -remaining
+			if math.Abs(float64(units)) > math.Abs(float64(trade.CurrentUnits)) {
+				units = trade.CurrentUnits
+			}
+			freedMargin += a.marginUsed(trade) * float64(units) / float64(trade.CurrentUnits)
+			remaining += units
+			reduced = append(reduced, trade)
+		}
+	}
+	filled := order.Units
+	if order.PositionFill == models.PositionFillReduceOnly {
+		if len(reduced) == 0 {
+			order.State = models.OrderStateCancelled
+			return nil, a.cancelTransaction(order.ID, clientID(order), models.ReasonPositionCloseoutFailed)
+		}
+		filled -= remaining
+		remaining = 0
+	}
+	if remaining != 0 {
+		nav, marginUsed := a.nav()
+		last := a.prices[p.instrument]
+		required := math.Abs(float64(remaining)) * mid(&last) * float64(a.instruments[p.instrument].MarginRate) * a.conversion(p.instrument)
+		if required > nav-marginUsed+freedMargin {
+			order.State = models.OrderStateCancelled
+			return nil, a.cancelTransaction(order.ID, clientID(order), models.ReasonInsufficientMargin)
+		}
+	}
+
+	order.State = models.OrderStateFilled
+	fill := a.fillTransaction(order.ID, p.instrument, filled, price, order.Type+"_ORDER")
+	fill.ClientOrderID = clientID(order)
+	left := order.Units
+	for _, trade := range reduced {
+		units := -left
+		if math.Abs(float64(units)) > math.Abs(float64(trade.CurrentUnits)) {
+			units = trade.CurrentUnits
+		}
+		left += units
+		reduce := a.reduceTrade(trade, units, price, fill.ID)
+		if trade.CurrentUnits == 0 {
+			fill.TradesClosed = append(fill.TradesClosed, reduce)
+		} else {
+			fill.TradeReduced = &reduce
+		}
+	}
+	var opened *models.Trade
+	if remaining != 0 {
+		opened = a.openTradeFromFill(&fill, order, remaining, price)
+	}
+	recorded := a.recordFill(&fill)
+	if opened != nil {
+		a.createOnFillOrders(opened, order)
+	}
+	return recorded, nil
+}
+
+// openTradeFromFill opens a trade with the ID of the fill transaction
+func (a *Account) openTradeFromFill(fill *models.Transaction, order *models.Order, units int64, price float64) *models.Trade {
+	trade := &models.Trade{
+		ID:           fill.ID,
+		Instrument:   fill.Instrument,
+		Price:        price,
+		OpenTime:     a.now,
+		State:        models.TradeStateOpen,
+		InitialUnits: units,
+		CurrentUnits: units,
+	}
+	a.trades = append(a.trades, trade)
+	fill.TradeOpened = &models.TradeOpen{
+		TradeID: trade.ID,
+		Units:   units,
+		Price:   price,
+	}
+	return trade
+}
+
+// createOnFillOrders creates the take profit, stop loss and trailing stop loss orders of a new trade
+func (a *Account) createOnFillOrders(trade *models.Trade, order *models.Order) {
+	if tp := order.TakeProfitOnFill; tp != nil {
+		a.createDependent(trade, models.Order{Type: models.OrderTypeTakeProfit, Price: tp.Price,
+			TimeInForce: tp.TimeInForce, GtdTime: tp.GtdTime, ClientExtensions: tp.ClientExtensions})
+	}
+	if sl := order.StopLossOnFill; sl != nil {
+		a.createDependent(trade, models.Order{Type: models.OrderTypeStopLoss, Price: sl.Price, Distance: sl.Distance,
+			TimeInForce: sl.TimeInForce, GtdTime: sl.GtdTime, ClientExtensions: sl.ClientExtensions})
+	}
+	if ts := order.TrailingStopLossOnFill; ts != nil {
+		a.createDependent(trade, models.Order{Type: models.OrderTypeTrailingStopLoss, Distance: ts.Distance,
+			TimeInForce: ts.TimeInForce, GtdTime: ts.GtdTime, ClientExtensions: ts.ClientExtensions})
+	}
+}
+
+func (a *Account) createDependent(trade *models.Trade, order models.Order) {
+	order.TradeID = trade.ID
+	if order.TimeInForce == "" {
+		order.TimeInForce = models.TimeInForceGTC
+	}
+	create := a.orderTransaction(&order, order.Type+"_ORDER", models.ReasonOnFill)
+	a.record(create)
+	order.ID = create.ID
+	order.State = models.OrderStatePending
+	createTime := a.now
+	order.CreateTime = &createTime
+	p := &pendingOrder{order: order, instrument: trade.Instrument}
+	a.history = append(a.history, p)
+	a.addPending(p)
+}
+
+// reduceTrade closes units of a trade at price, units has the sign of the trade
+func (a *Account) reduceTrade(trade *models.Trade, units int64, price float64, fillID string) models.TradeReduce {
+	realized := float64(units) * (price - trade.Price) * a.conversion(trade.Instrument)
+	closedBefore := float64(trade.InitialUnits - trade.CurrentUnits)
+	trade.AverageClosePrice = (trade.AverageClosePrice*closedBefore + price*float64(units)) / (closedBefore + float64(units))
+	trade.CurrentUnits -= units
+	trade.RealizedPL += realized
+	trade.ClosingTransactionIDs = append(trade.ClosingTransactionIDs, fillID)
+	a.balance += realized
+	a.pl += realized
+	a.instrumentPL[trade.Instrument] += realized
+
+	if trade.CurrentUnits == 0 {
+		closeTime := a.now
+		trade.CloseTime = &closeTime
+		trade.State = models.TradeStateClosed
+		trade.UnrealizedPL = 0
+		trade.MarginUsed = 0
+		for i, t := range a.trades {
+			if t == trade {
+				a.trades = append(a.trades[:i], a.trades[i+1:]...)
+				break
+			}
+		}
+		a.closed = append(a.closed, *trade)
+	}
+	return models.TradeReduce{
+		TradeID:    trade.ID,
+		Units:      -units,
+		Price:      price,
+		RealizedPL: realized,
+	}
+}
+
+func clientID(order *models.Order) string {
+	if order.ClientExtensions == nil {
+		return ""
+	}
+	return order.ClientExtensions.ID
+}
+
+func sign(units int64) float64 {
+	if units < 0 {
+		return -1
+	}
+	return 1
+}
@@ -0,0 +1,153 @@
+// Package sizing computes the units of an order for a risk in the account currency, with its pip value
+// and required margin, from the instrument metadata and the home conversions of the pricing endpoint
+package sizing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/burbru/goanda/models"
+)
+
+// ErrBelowMinimumTradeSize is returned when the units for the risk are under the MinimumTradeSize of the instrument
+var ErrBelowMinimumTradeSize = errors.New("sizing: units below the minimum trade size")
+
+// Conversions are the home conversions of currencies, by currency
+type Conversions map[string]models.HomeConversions
+
+// NewConversions indexes the home conversions returned by GetPricing
+func NewConversions(homeConversions []models.HomeConversions) Conversions {
+	conversions := make(Conversions)
+	for _, conversion := range homeConversions {
+		conversions[conversion.Currency] = conversion
+	}
+	return conversions
+}
+
+// Loss returns the factor converting a loss in a currency to the account currency
+func (c Conversions) Loss(currency string) (float64, error) {
+	conversion, ok := c[currency]
+	if !ok || conversion.AccountLoss == 0 {
+		return 0, fmt.Errorf("sizing: no home conversion for %s", currency)
+	}
+	return conversion.AccountLoss, nil
+}
+
+// PositionValue returns the factor converting a position value in a currency to the account currency
+func (c Conversions) PositionValue(currency string) (float64, error) {
+	conversion, ok := c[currency]
+	if !ok || conversion.PositionValue == 0 {
+		return 0, fmt.Errorf("sizing: no home conversion for %s", currency)
+	}
+	return conversion.PositionValue, nil
+}
+
+// Instruments gets the instruments by name, it is implemented by catalog.Catalog
+type Instruments interface {
+	Get(name string) (models.Instrument, bool)
+}
+
+// Params are the inputs of Compute
+type Params struct {
+	// Balance is the amount the risk is a percentage of, in the account currency
+	Balance float64
+	// RiskPercent is the percentage of the balance lost when the stop is hit, 1 for 1%
+	RiskPercent float64
+	// StopPips is the distance of the stop in pips, used when StopDistance is zero
+	StopPips float64
+	// StopDistance is the distance of the stop in price
+	StopDistance float64
+	// Price is the entry price, for the required margin
+	Price float64
+	// Instrument is the instrument traded, as returned by GetInstruments
+	Instrument models.Instrument
+	// MarginRate is the margin rate of the account, the greatest of it and of the instrument is used
+	MarginRate float64
+}
+
+// Size is the result of Compute, the amounts are in the account currency
+type Size struct {
+	// Units are the absolute units to trade, rounded down to the units precision of the instrument
+	// and capped to its MaximumOrderUnits
+	Units int64
+	// Risk is the loss when the stop is hit, for Units
+	Risk float64
+	// PipValue is the value of a pip, for Units
+	PipValue float64
+	// Margin is the margin required to open Units at Price
+	Margin float64
+}
+
+// Compute computes the units risking RiskPercent of Balance with a stop at StopDistance (or StopPips)
+// of the entry, the pip value and the margin required
+func Compute(params Params, conversions Conversions) (Size, error) {
+	instrument := params.Instrument
+	distance := params.StopDistance
+	if distance == 0 {
+		distance = params.StopPips * instrument.PipSize()
+	}
+	distance = instrument.RoundPrice(distance)
+	if distance <= 0 {
+		return Size{}, errors.New("sizing: the stop distance must be positive")
+	}
+	if params.Balance <= 0 || params.RiskPercent <= 0 {
+		return Size{}, errors.New("sizing: the balance and the risk percentage must be positive")
+	}
+	quote := QuoteCurrency(instrument.Name)
+	loss, err := conversions.Loss(quote)
+	if err != nil {
+		return Size{}, err
+	}
+
+	risk := params.Balance * params.RiskPercent / 100
+	units := int64(instrument.RoundUnits(risk / (distance * loss)))
+	if maximum := int64(instrument.MaximumOrderUnits); maximum > 0 && units > maximum {
+		units = int64(instrument.RoundUnits(float64(maximum)))
+	}
+	if units == 0 || float64(units) < float64(instrument.MinimumTradeSize) {
+		return Size{}, ErrBelowMinimumTradeSize
+	}
+
+	size := Size{
+		Units:    units,
+		Risk:     float64(units) * distance * loss,
+		PipValue: PipValue(instrument, units, loss),
+	}
+	if params.Price > 0 {
+		if size.Margin, err = Margin(instrument, units, params.Price, params.MarginRate, conversions); err != nil {
+			return Size{}, err
+		}
+	}
+	return size, nil
+}
+
+// ComputeFor is Compute for the instrument named instrument, got from instruments
+func ComputeFor(instruments Instruments, instrument string, params Params, conversions Conversions) (Size, error) {
+	var ok bool
+	if params.Instrument, ok = instruments.Get(instrument); !ok {
+		return Size{}, fmt.Errorf("sizing: unknown instrument %s", instrument)
+	}
+	return Compute(params, conversions)
+}
+
+// PipValue returns the value of a pip for units of an instrument, with the factor converting the quote currency
+// to the account currency
+func PipValue(instrument models.Instrument, units int64, conversion float64) float64 {
+	return math.Abs(float64(units)) * instrument.PipSize() * conversion
+}
+
+// Margin returns the margin required for units of an instrument at a price, with the margin rate of the account
+func Margin(instrument models.Instrument, units int64, price float64, marginRate float64, conversions Conversions) (float64, error) {
+	conversion, err := conversions.PositionValue(QuoteCurrency(instrument.Name))
+	if err != nil {
+		return 0, err
+	}
+	return math.Abs(float64(units)) * price * conversion * math.Max(float64(instrument.MarginRate), marginRate), nil
+}
+
+// QuoteCurrency returns the quote currency of an instrument: USD for EUR_USD
+func QuoteCurrency(instrument string) string {
+	return instrument[strings.LastIndex(instrument, "_")+1:]
+}
@@ -0,0 +1,110 @@
+package strategy
+
+import (
+	"sort"
+	"time"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/calendar"
+	"github.com/burbru/goanda/models"
+)
+
+// Bar is a candle built from the prices of an instrument, aligned as the candles of OANDA (see calendar.Align)
+type Bar struct {
+	Instrument  string
+	Granularity api.Granularity
+	// Time is the start of the bar
+	Time time.Time
+	Bid  models.CandleStickData
+	Ask  models.CandleStickData
+	Mid  models.CandleStickData
+	// Ticks is the number of prices of the bar
+	Ticks int
+}
+
+// BarBuilder builds the bars of granularities from prices, a bar is complete when a price or a heartbeat
+// of a later bar arrives
+type BarBuilder struct {
+	granularities []api.Granularity
+	bars          map[barKey]*Bar
+}
+
+type barKey struct {
+	instrument  string
+	granularity api.Granularity
+}
+
+// NewBarBuilder creates a BarBuilder of granularities
+func NewBarBuilder(granularities ...api.Granularity) *BarBuilder {
+	return &BarBuilder{granularities: granularities, bars: make(map[barKey]*Bar)}
+}
+
+// Update adds a price to the bars of its instrument, and returns the bars it completed.
+// The prices without bids or asks are ignored
+func (b *BarBuilder) Update(price *models.ClientPrice) []Bar {
+	tick := models.ClientPrice2Tick(price)
+	if !tick.Complete() {
+		return nil
+	}
+	var completed []Bar
+	for _, granularity := range b.granularities {
+		key := barKey{instrument: price.Instrument, granularity: granularity}
+		start := calendar.Align(price.Time, granularity)
+		bar, ok := b.bars[key]
+		if ok && start.After(bar.Time) {
+			completed = append(completed, *bar)
+			ok = false
+		}
+		if !ok {
+			bar = &Bar{Instrument: price.Instrument, Granularity: granularity, Time: start}
+			b.bars[key] = bar
+		}
+		update(&bar.Bid, tick.Bid, bar.Ticks)
+		update(&bar.Ask, tick.Ask, bar.Ticks)
+		update(&bar.Mid, tick.Price(), bar.Ticks)
+		bar.Ticks++
+	}
+	return completed
+}
+
+// Flush returns the bars completed at a time, such as the time of a heartbeat, sorted by instrument
+// and granularity. They are removed from the builder
+func (b *BarBuilder) Flush(t time.Time) []Bar {
+	var completed []Bar
+	for key, bar := range b.bars {
+		if calendar.Align(t, key.granularity).After(bar.Time) {
+			completed = append(completed, *bar)
+			delete(b.bars, key)
+		}
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		if completed[i].Instrument != completed[j].Instrument {
+			return completed[i].Instrument < completed[j].Instrument
+		}
+		return completed[i].Granularity.Duration() < completed[j].Granularity.Duration()
+	})
+	return completed
+}
+
+// Current returns the bar being built for an instrument and a granularity
+func (b *BarBuilder) Current(instrument string, granularity api.Granularity) (Bar, bool) {
+	bar, ok := b.bars[barKey{instrument: instrument, granularity: granularity}]
+	if !ok {
+		return Bar{}, false
+	}
+	return *bar, true
+}
+
+func update(data *models.CandleStickData, price float64, ticks int) {
+	if ticks == 0 {
+		*data = models.CandleStickData{O: price, H: price, L: price, C: price}
+		return
+	}
+	if price > data.H {
+		data.H = price
+	}
+	if price < data.L {
+		data.L = price
+	}
+	data.C = price
+}
@@ -0,0 +1,414 @@
+// Package strategy hosts trading strategies: it feeds them the prices, the bars and the transactions of the
+// streams, calls each strategy from a single goroutine, routes their orders to a broker, and persists their
+// state across restarts
+package strategy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+)
+
+// DefaultQueueSize is the number of events buffered for a strategy
+const DefaultQueueSize = 1000
+
+// Strategy is implemented by the strategies hosted by a Runtime, the callbacks of a strategy are never
+// called concurrently. Base can be embedded to implement only some of them
+type Strategy interface {
+	// OnStart is called when the strategy starts, after its state is loaded. The strategy does not start
+	// when it returns an error
+	OnStart(env *Env) error
+	OnTick(env *Env, price models.ClientPrice)
+	// OnBar is called when a bar of the granularities of the Runtime is complete
+	OnBar(env *Env, bar Bar)
+	OnTransaction(env *Env, transaction models.Transaction)
+	// OnStop is called when the strategy stops, before its state is saved
+	OnStop(env *Env)
+}
+
+// Stateful is implemented by the strategies whose state is saved when they stop and loaded when they
+// start, in the StateDir of the Runtime
+type Stateful interface {
+	SaveState() ([]byte, error)
+	LoadState(state []byte) error
+}
+
+// Base implements Strategy with callbacks doing nothing
+type Base struct{}
+
+// OnStart does nothing
+func (Base) OnStart(env *Env) error { return nil }
+
+// OnTick does nothing
+func (Base) OnTick(env *Env, price models.ClientPrice) {}
+
+// OnBar does nothing
+func (Base) OnBar(env *Env, bar Bar) {}
+
+// OnTransaction does nothing
+func (Base) OnTransaction(env *Env, transaction models.Transaction) {}
+
+// OnStop does nothing
+func (Base) OnStop(env *Env) {}
+
+// Env is given to the callbacks of a strategy
+type Env struct {
+	Name string
+	// Broker receives the orders of the strategy
+	Broker api.Broker
+	Logger api.Logger
+	// Context is cancelled when the strategy stops
+	Context context.Context
+}
+
+// PriceSource starts a pricing stream, it is implemented by api.StreamAPI
+type PriceSource interface {
+	StartPricingStream(instruments []string, pchan chan models.ClientPrice, hchan chan models.PricingHeartbeat)
+}
+
+// TransactionSource starts a transaction stream, it is implemented by api.TransactionStreamAPI and paper.Broker
+type TransactionSource interface {
+	StartTransactionStream(tchan chan models.Transaction, hchan chan models.TransactionHeartbeat)
+}
+
+// TransactionStopper stops the transaction streams sending to a channel, it is implemented by paper.Broker
+type TransactionStopper interface {
+	StopTransactionStream(tchan chan models.Transaction)
+}
+
+// Config is the configuration of a Runtime
+type Config struct {
+	// Instruments are the instruments of the pricing stream of Run
+	Instruments []string
+	// Granularities are the granularities of the bars given to OnBar
+	Granularities []api.Granularity
+	// StateDir is the directory of the states of the Stateful strategies, name.json for each strategy.
+	// The states are not persisted if empty
+	StateDir string
+	// QueueSize is the number of events buffered for each strategy, DefaultQueueSize if zero. The streams
+	// wait for a strategy whose queue is full
+	QueueSize int
+	// Logger logs the errors and panics of the strategies, they are discarded if nil
+	Logger api.Logger
+}
+
+// Runtime hosts strategies, safe for concurrent use. The callbacks of a strategy must not call the Add, Start,
+// Stop, Restart, Price, Heartbeat and Transaction methods of its Runtime: they hold the lock of the Runtime,
+// which also waits for the strategies whose queue is full. Running can be called
+type Runtime struct {
+	broker api.Broker
+	config Config
+	logger api.Logger
+
+	mutex sync.Mutex
+	// runningMutex guards the hosts and their running flag for Running, they are changed holding both locks
+	runningMutex sync.Mutex
+	hosts        map[string]*host
+	names        []string
+	bars         *BarBuilder
+	started      bool
+}
+
+// event is a price, a bar or a transaction given to a strategy
+type event struct {
+	price       *models.ClientPrice
+	bar         *Bar
+	transaction *models.Transaction
+}
+
+// host runs a strategy in its goroutine
+type host struct {
+	name     string
+	strategy Strategy
+	env      *Env
+	cancel   context.CancelFunc
+	events   chan event
+	done     chan struct{}
+	running  bool
+}
+
+// New creates a Runtime routing the orders of its strategies to broker
+func New(broker api.Broker, config Config) *Runtime {
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = api.NopLogger{}
+	}
+	return &Runtime{
+		broker: broker,
+		config: config,
+		logger: logger,
+		hosts:  make(map[string]*host),
+		bars:   NewBarBuilder(config.Granularities...),
+	}
+}
+
+// Add adds a strategy under a unique name, it is started when the Runtime is started
+func (r *Runtime) Add(name string, strategy Strategy) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.hosts[name]; ok {
+		return fmt.Errorf("strategy: %s already added", name)
+	}
+	h := &host{name: name, strategy: strategy}
+	r.runningMutex.Lock()
+	r.hosts[name] = h
+	r.runningMutex.Unlock()
+	r.names = append(r.names, name)
+	if r.started {
+		return r.start(h)
+	}
+	return nil
+}
+
+// Start starts the strategies in the order they were added, the errors of the strategies which
+// did not start are joined
+func (r *Runtime) Start() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.started = true
+	var failed []string
+	for _, name := range r.names {
+		if err := r.start(r.hosts[name]); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New("strategy: not started: " + strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Stop stops the strategies in the reverse order they were added: the events queued are handled,
+// then OnStop is called and the state is saved
+func (r *Runtime) Stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.started = false
+	for i := len(r.names) - 1; i >= 0; i-- {
+		r.stop(r.hosts[r.names[i]])
+	}
+}
+
+// Restart stops and starts a strategy, its state is saved and loaded again
+func (r *Runtime) Restart(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	h, ok := r.hosts[name]
+	if !ok {
+		return fmt.Errorf("strategy: %s not found", name)
+	}
+	r.stop(h)
+	return r.start(h)
+}
+
+// Running reports whether a strategy is running, it does not wait for the lock of the Runtime
+func (r *Runtime) Running(name string) bool {
+	r.runningMutex.Lock()
+	defer r.runningMutex.Unlock()
+	h, ok := r.hosts[name]
+	return ok && h.running
+}
+
+// Price gives a price to the strategies: first the bars it completed, then the price
+func (r *Runtime) Price(price models.ClientPrice) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, bar := range r.bars.Update(&price) {
+		bar := bar
+		r.dispatch(event{bar: &bar})
+	}
+	r.dispatch(event{price: &price})
+}
+
+// Heartbeat gives the bars completed at the time of a heartbeat to the strategies
+func (r *Runtime) Heartbeat(heartbeat models.PricingHeartbeat) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, bar := range r.bars.Flush(heartbeat.Time) {
+		bar := bar
+		r.dispatch(event{bar: &bar})
+	}
+}
+
+// Transaction gives a transaction to the strategies
+func (r *Runtime) Transaction(transaction models.Transaction) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.dispatch(event{transaction: &transaction})
+}
+
+// Run starts the strategies and the streams, and gives them the prices, heartbeats and transactions until
+// ctx is done, then stops the strategies. A nil source is not streamed. The transaction stream is stopped
+// when Run returns if its source is a TransactionStopper, the other streams cannot be
+func (r *Runtime) Run(ctx context.Context, prices PriceSource, transactions TransactionSource) error {
+	if err := r.Start(); err != nil {
+		r.logger.Error("strategy start failed", "error", err)
+	}
+	defer r.Stop()
+
+	pchan := make(chan models.ClientPrice, 100)
+	phchan := make(chan models.PricingHeartbeat, 10)
+	tchan := make(chan models.Transaction, 100)
+	thchan := make(chan models.TransactionHeartbeat, 10)
+	if prices != nil {
+		prices.StartPricingStream(r.config.Instruments, pchan, phchan)
+	}
+	if transactions != nil {
+		transactions.StartTransactionStream(tchan, thchan)
+		if stopper, ok := transactions.(TransactionStopper); ok {
+			defer stopper.StopTransactionStream(tchan)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case price := <-pchan:
+			r.Price(price)
+		case heartbeat := <-phchan:
+			r.Heartbeat(heartbeat)
+		case transaction := <-tchan:
+			r.Transaction(transaction)
+		case <-thchan:
+		}
+	}
+}
+
+// start loads the state of a strategy, calls OnStart and starts its goroutine. A panic of OnStart is
+// returned as an error
+func (r *Runtime) start(h *host) error {
+	if h.running {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h.env = &Env{Name: h.name, Broker: r.broker, Logger: r.logger, Context: ctx}
+	h.cancel = cancel
+	if err := r.loadState(h); err != nil {
+		cancel()
+		return fmt.Errorf("%s: %v", h.name, err)
+	}
+	var err error
+	if p := h.call("OnStart", r.logger, func() { err = h.strategy.OnStart(h.env) }); p != nil {
+		err = fmt.Errorf("panic: %v", p)
+	}
+	if err != nil {
+		cancel()
+		return fmt.Errorf("%s: %v", h.name, err)
+	}
+	h.events = make(chan event, r.config.QueueSize)
+	h.done = make(chan struct{})
+	r.setRunning(h, true)
+	go h.run(r.logger)
+	return nil
+}
+
+// stop closes the queue of a strategy and waits for its goroutine to call OnStop, then saves its state
+func (r *Runtime) stop(h *host) {
+	if !h.running {
+		return
+	}
+	r.setRunning(h, false)
+	close(h.events)
+	<-h.done
+	h.cancel()
+	if err := r.saveState(h); err != nil {
+		r.logger.Error("strategy state not saved", "strategy", h.name, "error", err)
+	}
+}
+
+func (r *Runtime) setRunning(h *host, running bool) {
+	r.runningMutex.Lock()
+	defer r.runningMutex.Unlock()
+	h.running = running
+}
+
+func (r *Runtime) dispatch(e event) {
+	for _, name := range r.names {
+		if h := r.hosts[name]; h.running {
+			h.events <- e
+		}
+	}
+}
+
+func (r *Runtime) statePath(h *host) (string, bool) {
+	if r.config.StateDir == "" {
+		return "", false
+	}
+	if _, ok := h.strategy.(Stateful); !ok {
+		return "", false
+	}
+	return filepath.Join(r.config.StateDir, h.name+".json"), true
+}
+
+func (r *Runtime) loadState(h *host) error {
+	path, ok := r.statePath(h)
+	if !ok {
+		return nil
+	}
+	state, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return h.strategy.(Stateful).LoadState(state)
+}
+
+// saveState writes the state to a temporary file renamed over the previous state, so that a crash
+// while saving keeps the previous state
+func (r *Runtime) saveState(h *host) error {
+	path, ok := r.statePath(h)
+	if !ok {
+		return nil
+	}
+	state, err := h.strategy.(Stateful).SaveState()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.config.StateDir, 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", state, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// run calls the callbacks of the events until the queue is closed, then OnStop
+func (h *host) run(logger api.Logger) {
+	defer close(h.done)
+	for e := range h.events {
+		switch {
+		case e.price != nil:
+			h.call("OnTick", logger, func() { h.strategy.OnTick(h.env, *e.price) })
+		case e.bar != nil:
+			h.call("OnBar", logger, func() { h.strategy.OnBar(h.env, *e.bar) })
+		case e.transaction != nil:
+			h.call("OnTransaction", logger, func() { h.strategy.OnTransaction(h.env, *e.transaction) })
+		}
+	}
+	h.call("OnStop", logger, func() { h.strategy.OnStop(h.env) })
+}
+
+// call calls a callback, a panic is logged and returned, and the strategy goes on with the next event
+func (h *host) call(callback string, logger api.Logger, f func()) (panicked interface{}) {
+	defer func() {
+		if p := recover(); p != nil {
+			logger.Error("strategy panicked", "strategy", h.name, "callback", callback, "panic", p)
+			panicked = p
+		}
+	}()
+	f()
+	return nil
+}
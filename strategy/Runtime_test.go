@@ -0,0 +1,77 @@
+package strategy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/burbru/goanda/models"
+	"github.com/burbru/goanda/paper"
+	"github.com/burbru/goanda/sim"
+)
+
+// panicking panics in OnStart
+type panicking struct {
+	Base
+}
+
+func (panicking) OnStart(env *Env) error {
+	panic("not configured")
+}
+
+// checking calls Running from OnTick, while the queue is full
+type checking struct {
+	Base
+	runtime *Runtime
+	ticks   chan bool
+}
+
+func (s *checking) OnTick(env *Env, price models.ClientPrice) {
+	s.ticks <- s.runtime.Running(env.Name)
+}
+
+func newRuntime(queueSize int) *Runtime {
+	broker := paper.NewBroker(sim.Config{Balance: 10000})
+	return New(broker, Config{QueueSize: queueSize})
+}
+
+func TestStartPanic(t *testing.T) {
+	r := newRuntime(0)
+	if err := r.Add("panicking", panicking{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start(); err == nil {
+		t.Error("no error for a panic in OnStart")
+	}
+	if r.Running("panicking") {
+		t.Error("strategy running after a panic in OnStart")
+	}
+}
+
+func TestRunningFromCallback(t *testing.T) {
+	r := newRuntime(1)
+	s := &checking{runtime: r, ticks: make(chan bool)}
+	if err := r.Add("checking", s); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	// the third price waits for the queue holding the lock of the Runtime
+	go func() {
+		for i := 0; i < 3; i++ {
+			r.Price(models.ClientPrice{Instrument: "EUR_USD", Time: time.Now()})
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		select {
+		case running := <-s.ticks:
+			if !running {
+				t.Error("strategy not running")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Running blocked by a full queue")
+		}
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"log"
 
 	"github.com/burbru/goanda/api"
 	"github.com/burbru/goanda/models"
@@ -42,13 +42,14 @@ func main() {
 	go tickProcessor(tchan)
 	go heartbeatProcessor(hchan)
 
-	// context to create api
-	ctx := api.Context{
-		ApiURL:       os.Getenv("OANDA_API_URL"),
-		StreamApiURL: os.Getenv("OANDA_STREAM_URL"),
-		Token:        os.Getenv("OANDA_API_KEY"),
-		Account:      os.Getenv("OANDA_ACCOUNT"),
-		Application:  "TestStreaming",
+	// context to create api, from OANDA_CONFIG and the OANDA_* environment variables
+	ctx, err := api.LoadContext("", "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the first account of the token is used when OANDA_ACCOUNT is not set
+	if err := ctx.ResolveAccount(api.AccountSelector{}); err != nil {
+		log.Fatal(err)
 	}
 
 	fmt.Printf("%s\n", ctx.ApiURL)
@@ -59,22 +60,13 @@ func main() {
 
 	api := ctx.CreateAPI()
 
-	if len(ctx.Account) == 0 {
-		accounts, err := api.GetAccounts()
-		if err == nil && len(accounts.Accounts) > 0 {
-			fmt.Printf("Setting Account # in context: %s\n", accounts.Accounts[0].ID)
-			ctx.Account = accounts.Accounts[0].ID
-			api = ctx.CreateAPI()
-		}
-	}
-
 	pos, err := api.GetPricing([]string{"EUR_USD"})
 
 	// err := api.GetAccounts()
 	if err != nil {
 		fmt.Printf("The HTTP request failed with error %s\n", err)
 	}
-	fmt.Printf("%s\n", pos)
+	fmt.Printf("%v\n", pos)
 
 	streamapi := ctx.CreateStreamAPI()
 	//streamapi.PricingStream([]string{"EUR_USD", "BCO_USD", "SPX500_USD", "EUR_JPY"}, pchan, hchan)
@@ -0,0 +1,98 @@
+// Package ticks persists the prices of the pricing stream to daily gzip files per instrument,
+// and reads them back as prices or ticks
+package ticks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/burbru/goanda/models"
+)
+
+// Format is the format of the files
+type Format string
+
+const (
+	// FormatJSONL stores a ClientPrice JSON object per line
+	FormatJSONL Format = "jsonl"
+	// FormatCSV stores a time,bids,asks line per price, each side being price:liquidity levels separated by |
+	FormatCSV Format = "csv"
+)
+
+const csvHeader = "time,bids,asks"
+
+// dayLayout is the date in the file names, files are rotated at midnight UTC
+const dayLayout = "2006-01-02"
+
+// fileName returns the path of the file of an instrument for a day: dir/EUR_USD/EUR_USD-2024-01-02.csv.gz
+func fileName(dir string, instrument string, day string, format Format) string {
+	return filepath.Join(dir, instrument, instrument+"-"+day+"."+string(format)+".gz")
+}
+
+func encode(price *models.ClientPrice, format Format) ([]byte, error) {
+	if format == FormatCSV {
+		line := price.Time.UTC().Format(time.RFC3339Nano) + "," + encodeBuckets(price.Bids) + "," + encodeBuckets(price.Asks)
+		return []byte(line), nil
+	}
+	return json.Marshal(price)
+}
+
+func decode(line []byte, instrument string, format Format) (models.ClientPrice, error) {
+	var price models.ClientPrice
+	if format != FormatCSV {
+		err := json.Unmarshal(line, &price)
+		return price, err
+	}
+	fields := strings.Split(string(line), ",")
+	if len(fields) != 3 {
+		return price, fmt.Errorf("ticks: invalid csv line %q", line)
+	}
+	t, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return price, err
+	}
+	price.Instrument = instrument
+	price.Type = "PRICE"
+	price.Time = t
+	if price.Bids, err = decodeBuckets(fields[1]); err != nil {
+		return price, err
+	}
+	price.Asks, err = decodeBuckets(fields[2])
+	return price, err
+}
+
+func encodeBuckets(buckets []models.PriceBucket) string {
+	levels := make([]string, 0, len(buckets))
+	for _, bucket := range buckets {
+		levels = append(levels, strconv.FormatFloat(bucket.Price, 'f', -1, 64)+":"+strconv.Itoa(bucket.Liquidity))
+	}
+	return strings.Join(levels, "|")
+}
+
+func decodeBuckets(field string) ([]models.PriceBucket, error) {
+	if field == "" {
+		return nil, nil
+	}
+	var buckets []models.PriceBucket
+	for _, level := range strings.Split(field, "|") {
+		parts := strings.Split(level, ":")
+		if len(parts) != 2 {
+			return nil, errors.New("ticks: invalid price level " + level)
+		}
+		price, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		liquidity, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, models.PriceBucket{Price: price, Liquidity: liquidity})
+	}
+	return buckets, nil
+}
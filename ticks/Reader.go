@@ -0,0 +1,144 @@
+package ticks
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/burbru/goanda/models"
+)
+
+// Reader iterates the recorded prices of an instrument between two times, in the order of the files.
+// A file truncated by a crashed recorder is read up to its last complete line
+type Reader struct {
+	instrument string
+	from       time.Time
+	to         time.Time
+	files      []string
+	file       *os.File
+	gz         *gzip.Reader
+	reader     *bufio.Reader
+	format     Format
+}
+
+// NewReader creates a Reader of the files of instrument under dir, a zero from or to is not bounded
+func NewReader(dir string, instrument string, from time.Time, to time.Time) (*Reader, error) {
+	names, err := filepath.Glob(filepath.Join(dir, instrument, instrument+"-*.gz"))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range names {
+		// the names which are not of a day, such as stray files, are skipped
+		suffix := strings.TrimPrefix(filepath.Base(name), instrument+"-")
+		if len(suffix) < len(dayLayout) {
+			continue
+		}
+		day, err := time.Parse(dayLayout, suffix[:len(dayLayout)])
+		if err != nil {
+			continue
+		}
+		if (!from.IsZero() && day.Add(24*time.Hour).Before(from)) || (!to.IsZero() && day.After(to)) {
+			continue
+		}
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return &Reader{instrument: instrument, from: from, to: to, files: files}, nil
+}
+
+// Next returns the next price, io.EOF when all the files have been read
+func (r *Reader) Next() (models.ClientPrice, error) {
+	for {
+		if r.reader == nil {
+			if len(r.files) == 0 {
+				return models.ClientPrice{}, io.EOF
+			}
+			if err := r.open(r.files[0]); err != nil {
+				return models.ClientPrice{}, err
+			}
+			r.files = r.files[1:]
+		}
+		line, err := r.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return models.ClientPrice{}, err
+		}
+		if err != nil {
+			// a line without its end is dropped, it may be truncated
+			r.closeFile()
+			continue
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 || string(line) == csvHeader {
+			continue
+		}
+		price, err := decode(line, r.instrument, r.format)
+		if err != nil {
+			return price, err
+		}
+		if (!r.from.IsZero() && price.Time.Before(r.from)) || (!r.to.IsZero() && price.Time.After(r.to)) {
+			continue
+		}
+		return price, nil
+	}
+}
+
+// NextTick returns the next price with both a bid and an ask as a Tick, io.EOF at the end
+func (r *Reader) NextTick() (models.Tick, error) {
+	for {
+		price, err := r.Next()
+		if err != nil {
+			return models.Tick{}, err
+		}
+		if len(price.Bids) > 0 && len(price.Asks) > 0 {
+			return models.ClientPrice2Tick(&price), nil
+		}
+	}
+}
+
+// Close closes the file being read
+func (r *Reader) Close() error {
+	r.files = nil
+	return r.closeFile()
+}
+
+func (r *Reader) open(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		if err == io.EOF {
+			// an empty file
+			r.reader = bufio.NewReader(bytes.NewReader(nil))
+			return nil
+		}
+		return err
+	}
+	r.file, r.gz, r.reader = file, gz, bufio.NewReader(gz)
+	r.format = FormatJSONL
+	if strings.HasSuffix(name, "."+string(FormatCSV)+".gz") {
+		r.format = FormatCSV
+	}
+	return nil
+}
+
+func (r *Reader) closeFile() error {
+	r.reader = nil
+	if r.file == nil {
+		return nil
+	}
+	r.gz.Close()
+	err := r.file.Close()
+	r.file, r.gz = nil, nil
+	return err
+}
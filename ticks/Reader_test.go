@@ -0,0 +1,70 @@
+package ticks
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/burbru/goanda/models"
+)
+
+func price(at time.Time, bid float64, ask float64) models.ClientPrice {
+	return models.ClientPrice{
+		Instrument: "EUR_USD",
+		Type:       "PRICE",
+		Time:       at,
+		Bids:       []models.PriceBucket{{Price: bid, Liquidity: 1000000}},
+		Asks:       []models.PriceBucket{{Price: ask, Liquidity: 1000000}},
+	}
+}
+
+func TestRecordAndRead(t *testing.T) {
+	for _, format := range []Format{FormatJSONL, FormatCSV} {
+		dir, err := os.MkdirTemp("", "ticks")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		start := time.Date(2021, 3, 1, 23, 59, 0, 0, time.UTC)
+		recorder := NewRecorder(dir, format)
+		for i := 0; i < 3; i++ {
+			p := price(start.Add(time.Duration(i)*time.Minute), 1.2+float64(i)/1000, 1.2002+float64(i)/1000)
+			if err := recorder.Write(&p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := recorder.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// a stray file matching the pattern of the day files is skipped
+		if err := os.WriteFile(filepath.Join(dir, "EUR_USD", "EUR_USD-x.gz"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := NewReader(dir, "EUR_USD", time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ticks []models.Tick
+		for {
+			tick, err := reader.NextTick()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			ticks = append(ticks, tick)
+		}
+		reader.Close()
+		if len(ticks) != 3 {
+			t.Fatalf("%s: %d ticks, want 3", format, len(ticks))
+		}
+		if last := ticks[2]; last.Bid != 1.202 || last.Ask != 1.2022 || !last.Time.Equal(start.Add(2*time.Minute)) {
+			t.Errorf("%s: last tick %+v", format, last)
+		}
+	}
+}
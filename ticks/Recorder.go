@@ -0,0 +1,181 @@
+package ticks
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/burbru/goanda/api"
+	"github.com/burbru/goanda/models"
+)
+
+// Recorder writes prices to a gzip file per instrument and per day (UTC), restarting a recorder
+// on the same day appends a new gzip member to the file
+type Recorder struct {
+	dir    string
+	format Format
+	mutex  sync.Mutex
+	files  map[string]*dayFile
+}
+
+// dayFile is the open file of an instrument
+type dayFile struct {
+	day    string
+	file   *os.File
+	gz     *gzip.Writer
+	writer *bufio.Writer
+}
+
+// NewRecorder creates a Recorder writing files in format under dir
+func NewRecorder(dir string, format Format) *Recorder {
+	return &Recorder{
+		dir:    dir,
+		format: format,
+		files:  make(map[string]*dayFile),
+	}
+}
+
+// Record starts a pricing stream for instruments and writes every price until ctx is done, the files are
+// flushed on each heartbeat so they can be read while recording. It closes the files, stops the stream and
+// returns on the first write error, or when ctx is done. The heartbeats are forwarded to hchan when it is
+// not nil
+func (r *Recorder) Record(ctx context.Context, streamApi *api.StreamAPI, instruments []string, hchan chan models.PricingHeartbeat) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pchan := make(chan models.ClientPrice)
+	heartbeats := make(chan models.PricingHeartbeat)
+	streamApi.StartPricingStreamContext(ctx, instruments, pchan, heartbeats)
+	for {
+		select {
+		case <-ctx.Done():
+			if err := r.Close(); err != nil {
+				return err
+			}
+			return ctx.Err()
+		case price := <-pchan:
+			if err := r.Write(&price); err != nil {
+				r.Close()
+				return err
+			}
+		case heartbeat := <-heartbeats:
+			if err := r.Flush(); err != nil {
+				r.Close()
+				return err
+			}
+			if hchan != nil {
+				select {
+				case hchan <- heartbeat:
+				case <-ctx.Done():
+				}
+			}
+		}
+	}
+}
+
+// Run writes the prices received on pchan until it is closed, then closes the files
+func (r *Recorder) Run(pchan <-chan models.ClientPrice) error {
+	for price := range pchan {
+		if err := r.Write(&price); err != nil {
+			r.Close()
+			return err
+		}
+	}
+	return r.Close()
+}
+
+// Write writes a price, with all its bid and ask levels, to the file of its instrument and day
+func (r *Recorder) Write(price *models.ClientPrice) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	f, err := r.file(price.Instrument, price.Time.UTC().Format(dayLayout))
+	if err != nil {
+		return err
+	}
+	line, err := encode(price, r.format)
+	if err != nil {
+		return err
+	}
+	if _, err := f.writer.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Flush writes the buffered prices so the files can be read while recording
+func (r *Recorder) Flush() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, f := range r.files {
+		if err := f.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes all the files
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var firstErr error
+	for instrument, f := range r.files {
+		if err := f.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.files, instrument)
+	}
+	return firstErr
+}
+
+// file returns the file of an instrument for a day, closing the one of the previous day
+func (r *Recorder) file(instrument string, day string) (*dayFile, error) {
+	if f, ok := r.files[instrument]; ok {
+		if f.day == day {
+			return f, nil
+		}
+		delete(r.files, instrument)
+		if err := f.close(); err != nil {
+			return nil, err
+		}
+	}
+	name := fileName(r.dir, instrument, day, r.format)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(name)
+	empty := err != nil || info.Size() == 0
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	f := &dayFile{day: day, file: file, gz: gz, writer: bufio.NewWriter(gz)}
+	if r.format == FormatCSV && empty {
+		f.writer.WriteString(csvHeader + "\n")
+	}
+	r.files[instrument] = f
+	return f, nil
+}
+
+func (f *dayFile) flush() error {
+	if err := f.writer.Flush(); err != nil {
+		return err
+	}
+	return f.gz.Flush()
+}
+
+func (f *dayFile) close() error {
+	if err := f.writer.Flush(); err != nil {
+		f.file.Close()
+		return err
+	}
+	if err := f.gz.Close(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
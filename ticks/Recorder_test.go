@@ -0,0 +1,80 @@
+package ticks
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/burbru/goanda/models"
+	"github.com/burbru/goanda/oandatest"
+)
+
+func TestRecordStream(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ticks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := oandatest.NewServer(oandatest.Config{})
+	defer server.Close()
+	ctx := server.Context()
+	streamApi := ctx.CreateStreamAPI()
+
+	recording, cancel := context.WithCancel(context.Background())
+	heartbeats := make(chan models.PricingHeartbeat)
+	done := make(chan error, 1)
+	recorder := NewRecorder(dir, FormatJSONL)
+	go func() { done <- recorder.Record(recording, &streamApi, []string{"EUR_USD"}, heartbeats) }()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if n, _ := server.StreamCount(); n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no stream")
+		}
+	}
+
+	now := time.Now().UTC()
+	p := price(now, 1.2, 1.2002)
+	server.SetPrice(p)
+	server.SendHeartbeats()
+	select {
+	case <-heartbeats:
+	case <-time.After(time.Second):
+		t.Fatal("no heartbeat")
+	}
+
+	// the price is flushed by the heartbeat, the file is read while recording
+	reader, err := NewReader(dir, "EUR_USD", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := reader.Next()
+	if err != nil || read.Bids[0].Price != 1.2 {
+		t.Fatalf("%+v %v, want the recorded price", read, err)
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("%v, want io.EOF", err)
+	}
+	reader.Close()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("%v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Record did not return")
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if n, _ := server.StreamCount(); n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stream not stopped")
+		}
+	}
+}